@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/devgenie/scout/internal/couchbase"
+	"github.com/devgenie/scout/internal/raft"
+)
+
+const couchbaseStartTimeout = 5 * time.Minute
+
+func runAgent(args []string) error {
+	set, flags := parseFlags("agent", args)
+	if set.NArg() != 0 {
+		return fmt.Errorf("usage: scout agent [flags]")
+	}
+	return startAgent(set, flags, "")
+}
+
+func runJoin(args []string) error {
+	// The address may be given before the flags, which stop flag parsing.
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		args = append(args[1:], args[0])
+	}
+
+	set, flags := parseFlags("join", args)
+	if set.NArg() != 1 {
+		return fmt.Errorf("usage: scout join <addr> [flags]")
+	}
+	return startAgent(set, flags, set.Arg(0))
+}
+
+// startAgent initializes the local couchbase node and runs the scout node
+// until it stops. A non empty join overrides the configured discovery.
+func startAgent(set *flag.FlagSet, flags *configFlags, join string) error {
+	config, err := flags.load(set, join)
+	if err != nil {
+		return err
+	}
+
+	err = validate(config)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("starting scout %s", version)
+
+	couchbaseNode := couchbase.NewCouchbaseNode("127.0.0.1", config.CouchbasePort)
+	ctx, cancel := context.WithTimeout(context.Background(), couchbaseStartTimeout)
+	defer cancel()
+
+	err = waitForCouchbase(ctx, couchbaseNode)
+	if err != nil {
+		return err
+	}
+
+	err = couchbaseNode.BoootStrap(ctx, config.Username, config.Password, config.CouchbasePort, config.Services, bootstrapSettings(config))
+	if err != nil {
+		return err
+	}
+
+	node := raft.NewNode(config, couchbaseNode, discovery(config))
+	return node.Run()
+}
+
+func runValidateConfig(args []string) error {
+	set, flags := parseFlags("validate-config", args)
+	config, err := flags.load(set, "")
+	if err != nil {
+		return err
+	}
+
+	err = validate(config)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(os.Stdout, "%s is valid\n", flags.file)
+	return nil
+}
+
+func parseFlags(name string, args []string) (*flag.FlagSet, *configFlags) {
+	set := flag.NewFlagSet(name, flag.ExitOnError)
+	flags := &configFlags{}
+	flags.register(set)
+	set.Parse(args)
+	return set, flags
+}
+
+// waitForCouchbase waits for couchbase server, which is started next to scout,
+// to answer on its REST port.
+func waitForCouchbase(ctx context.Context, node *couchbase.CouchbaseNode) error {
+	for {
+		err := node.Ping(ctx)
+		if err == nil {
+			return nil
+		}
+
+		log.Printf("%s, waiting for couchbase to start", err)
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("couchbase did not start : %s", err)
+		case <-time.After(5 * time.Second):
+		}
+	}
+}
+
+// bootstrapSettings sizes the service quotas of the first initialization from
+// the memory of this host, the leader resizes them for the whole cluster.
+func bootstrapSettings(config couchbase.Config) couchbase.ClusterConfig {
+	cluster := config.Cluster
+	if !cluster.MemoryPolicy.Enabled {
+		return cluster
+	}
+
+	memory, err := couchbase.HostMemoryMB()
+	if err != nil {
+		log.Println("error reading host memory", err)
+		return cluster
+	}
+
+	services := strings.Split(config.Services, ",")
+	for i := range services {
+		services[i] = strings.TrimSpace(services[i])
+	}
+
+	quotas, err := cluster.MemoryPolicy.Quotas(memory, services)
+	if err != nil {
+		log.Println("error sizing memory quotas", err)
+		return cluster
+	}
+	return cluster.WithQuotas(quotas)
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+
+	"github.com/devgenie/scout/internal/common"
+	"github.com/devgenie/scout/internal/couchbase"
+	"github.com/devgenie/scout/internal/notify"
+)
+
+const defaultConfigFile = "/etc/config.yml"
+
+// configFlags are the settings that can be given on the command line, they
+// override the values of the config file when they are set.
+type configFlags struct {
+	file           string
+	username       string
+	password       string
+	services       string
+	zone           string
+	couchbasePort  int
+	raftPort       int
+	raftMemberPort int
+	raftVoterPort  int
+	discovery      string
+	join           string
+}
+
+func (flags *configFlags) register(set *flag.FlagSet) {
+	set.StringVar(&flags.file, "config", defaultConfigFile, "path of the config file")
+	set.StringVar(&flags.username, "username", "", "couchbase administrator username")
+	set.StringVar(&flags.password, "password", "", "couchbase administrator password")
+	set.StringVar(&flags.services, "services", "", "couchbase services of this node, e.g. kv,n1ql,index")
+	set.StringVar(&flags.zone, "zone", "", "availability zone of this node")
+	set.IntVar(&flags.couchbasePort, "couchbase-port", 0, "REST port of the local couchbase node")
+	set.IntVar(&flags.raftPort, "raft-port", 0, "raft port")
+	set.IntVar(&flags.raftMemberPort, "raft-member-port", 0, "serf member port")
+	set.IntVar(&flags.raftVoterPort, "raft-voter-port", 0, "raft voter port")
+	set.StringVar(&flags.discovery, "discovery", "", "discovery mode, consul or join")
+	set.StringVar(&flags.join, "discovery-join", "", "address used by the discovery mode")
+}
+
+// flagKeys maps the flags to the config keys they override.
+var flagKeys = map[string]string{
+	"username":         "username",
+	"password":         "password",
+	"services":         "services",
+	"zone":             "zone",
+	"couchbase-port":   "couchbaseport",
+	"raft-port":        "raftport",
+	"raft-member-port": "raftmemberport",
+	"raft-voter-port":  "raftvoterport",
+	"discovery":        "discovery",
+	"discovery-join":   "discovery",
+}
+
+// load reads the config file and applies the flags set on the command line,
+// a non empty join replaces the configured discovery. Problems of values
+// overridden by flags are reported for the flag values, not the file.
+func (flags *configFlags) load(set *flag.FlagSet, join string) (couchbase.Config, error) {
+	if join != "" {
+		flags.discovery = "join"
+		flags.join = join
+	}
+
+	overridden := make(map[string]bool)
+	set.Visit(func(given *flag.Flag) {
+		overridden[flagKeys[given.Name]] = true
+	})
+	if flags.discovery != "" {
+		overridden["discovery"] = true
+	}
+
+	config := couchbase.Config{}
+	problems := make([]common.Problem, 0)
+
+	err := common.ParseYml(flags.file, &config)
+	if configErr, ok := err.(*common.ConfigError); ok {
+		for _, problem := range configErr.Problems {
+			if !overridden[rootKey(problem.Path)] {
+				problems = append(problems, problem)
+			}
+		}
+	} else if err != nil {
+		return config, fmt.Errorf("error reading config %s : %s", flags.file, err)
+	}
+
+	set.Visit(func(given *flag.Flag) {
+		switch given.Name {
+		case "username":
+			config.Username = flags.username
+		case "password":
+			config.Password = flags.password
+		case "services":
+			config.Services = flags.services
+		case "zone":
+			config.Zone = flags.zone
+		case "couchbase-port":
+			config.CouchbasePort = flags.couchbasePort
+		case "raft-port":
+			config.RaftPort = flags.raftPort
+		case "raft-member-port":
+			config.RaftMemberPort = flags.raftMemberPort
+		case "raft-voter-port":
+			config.RaftVoterPort = flags.raftVoterPort
+		}
+	})
+
+	if flags.discovery != "" {
+		config.Discovery = []couchbase.Discovery{{Mode: flags.discovery, Join: flags.join}}
+	} else if flags.join != "" && len(config.Discovery) > 0 {
+		config.Discovery[0].Join = flags.join
+	}
+
+	for _, problem := range config.Validate() {
+		if overridden[rootKey(problem.Path)] {
+			problem.Message += " (set by a flag)"
+			problems = append(problems, problem)
+		}
+	}
+
+	if len(problems) > 0 {
+		return config, &common.ConfigError{File: flags.file, Problems: problems}
+	}
+	return config, nil
+}
+
+// validate runs the checks that need more than the config values.
+func validate(config couchbase.Config) error {
+	// Building the channels checks their addresses and templates.
+	_, err := notify.NewDispatcher(config.Notify, "")
+	return err
+}
+
+// rootKey returns the top level key of a YAML path.
+func rootKey(path string) string {
+	if index := strings.IndexAny(path, ".["); index >= 0 {
+		return path[:index]
+	}
+	return path
+}
+
+// discovery returns the discovery mode the agent starts with, the first one
+// configured.
+func discovery(config couchbase.Config) couchbase.Discovery {
+	if len(config.Discovery) == 0 {
+		return couchbase.Discovery{}
+	}
+	return config.Discovery[0]
+}
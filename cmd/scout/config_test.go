@@ -0,0 +1,99 @@
+package main
+
+import (
+	"flag"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/devgenie/scout/internal/common"
+)
+
+func TestLoad(t *testing.T) {
+	tests := []struct {
+		name     string
+		source   string
+		args     []string
+		join     string
+		problems []common.Problem
+		check    func(t *testing.T, username string, raftPort int, discovery string)
+	}{
+		{
+			name:   "flags fill in missing values",
+			source: "services: kv\n",
+			args:   []string{"-username", "admin", "-password", "secret", "-raft-port", "9300"},
+			check: func(t *testing.T, username string, raftPort int, discovery string) {
+				if username != "admin" || raftPort != 9300 {
+					t.Fatalf("expected admin on 9300, got %s on %d", username, raftPort)
+				}
+			},
+		},
+		{
+			name:   "flag overrides an invalid file value",
+			source: "username: admin\npassword: secret\nservices: kv\nraftport: 0\n",
+			args:   []string{"-raft-port", "9300"},
+		},
+		{
+			name:     "invalid flag value",
+			source:   "username: admin\npassword: secret\nservices: kv\n",
+			args:     []string{"-raft-port", "0"},
+			problems: []common.Problem{{Path: "raftport", Message: "0 is not a valid port (set by a flag)"}},
+		},
+		{
+			name:     "nested unknown key is kept when a flag of the same name is set",
+			source:   "username: admin\npassword: secret\nservices: kv\nbuckets:\n  - name: a\n    ramquotamb: 100\n    zone: b\n",
+			args:     []string{"-zone", "a"},
+			problems: []common.Problem{{Path: "buckets[0].zone", Line: 7, Message: "unknown key"}},
+		},
+		{
+			name:   "join replaces the discovery",
+			source: "username: admin\npassword: secret\nservices: kv\ndiscovery:\n  - mode: consul\n",
+			join:   "10.0.0.1",
+			check: func(t *testing.T, username string, raftPort int, discovery string) {
+				if discovery != "join 10.0.0.1" {
+					t.Fatalf("expected to join 10.0.0.1, got %s", discovery)
+				}
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			file, err := ioutil.TempFile("", "config")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.Remove(file.Name())
+			file.WriteString(test.source)
+			file.Close()
+
+			set := flag.NewFlagSet("test", flag.ContinueOnError)
+			flags := &configFlags{}
+			flags.register(set)
+			if err = set.Parse(append([]string{"-config", file.Name()}, test.args...)); err != nil {
+				t.Fatal(err)
+			}
+
+			config, err := flags.load(set, test.join)
+			if len(test.problems) > 0 {
+				configErr, ok := err.(*common.ConfigError)
+				if !ok {
+					t.Fatalf("expected a config error, got %v", err)
+				}
+				if !reflect.DeepEqual(configErr.Problems, test.problems) {
+					t.Fatalf("expected %+v, got %+v", test.problems, configErr.Problems)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("expected no error, got %s", err)
+			}
+			if test.check != nil {
+				selected := discovery(config)
+				test.check(t, config.Username, config.RaftPort, selected.Mode+" "+selected.Join)
+			}
+		})
+	}
+}
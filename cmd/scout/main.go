@@ -0,0 +1,51 @@
+// scout runs next to a couchbase node, joins it to the cluster and keeps the
+// cluster in the state declared in its config.
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+// version is set at build time with -ldflags "-X main.version=...".
+var version = "dev"
+
+const usage = `usage: scout <command> [flags]
+
+commands:
+  agent            run scout next to the local couchbase node
+  join <addr>      run the agent and join the cluster of the scout at addr
+  validate-config  check a config file and exit
+  version          print the version
+
+run scout <command> -h for the flags of a command.
+`
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	var err error
+	switch os.Args[1] {
+	case "agent":
+		err = runAgent(os.Args[2:])
+	case "join":
+		err = runJoin(os.Args[2:])
+	case "validate-config":
+		err = runValidateConfig(os.Args[2:])
+	case "version", "-version", "--version":
+		fmt.Println("scout", version)
+	case "help", "-h", "-help", "--help":
+		fmt.Print(usage)
+	default:
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		os.Exit(1)
+	}
+}
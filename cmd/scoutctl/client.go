@@ -0,0 +1,160 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// client talks to the admin API of a scout node, authenticating with the
+// token when one is set and with the couchbase admin credentials otherwise.
+type client struct {
+	address  string
+	username string
+	password string
+	token    string
+	http     *http.Client
+}
+
+type apiError struct {
+	Error string `json:"error"`
+}
+
+// statusError is an answer of the API other than 200 to a streaming request.
+type statusError struct {
+	method  string
+	path    string
+	status  int
+	message string
+}
+
+func (err *statusError) Error() string {
+	return fmt.Sprintf("%s %s returned %d: %s", err.method, err.path, err.status, err.message)
+}
+
+// retryable reports whether the request may succeed once the cluster
+// recovers, like while a new leader is elected.
+func retryable(err error) bool {
+	failure, ok := err.(*statusError)
+	if !ok {
+		return true
+	}
+	return failure.status == http.StatusTooManyRequests || failure.status >= 500
+}
+
+func newClient(address string) *client {
+	if !strings.HasPrefix(address, "http://") && !strings.HasPrefix(address, "https://") {
+		address = "http://" + address
+	}
+
+	return &client{
+		address: strings.TrimSuffix(address, "/"),
+		http:    &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+func (c *client) authorize(req *http.Request) {
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	} else if c.username != "" {
+		req.SetBasicAuth(c.username, c.password)
+	}
+}
+
+func (c *client) get(path string, out interface{}) error {
+	return c.do("GET", path, nil, out)
+}
+
+func (c *client) post(path string, in interface{}, out interface{}) error {
+	return c.do("POST", path, in, out)
+}
+
+func (c *client) delete(path string) error {
+	return c.do("DELETE", path, nil, nil)
+}
+
+func (c *client) do(method string, path string, in interface{}, out interface{}) error {
+	var body io.Reader
+	if in != nil {
+		encoded, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(encoded)
+	}
+
+	req, err := http.NewRequest(method, c.address+path, body)
+	if err != nil {
+		return err
+	}
+	c.authorize(req)
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	respBody, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("error reading response of %s %s: %s", method, path, err)
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		failure := apiError{}
+		if json.Unmarshal(respBody, &failure) == nil && failure.Error != "" {
+			return fmt.Errorf("%s", failure.Error)
+		}
+		return fmt.Errorf("%s %s returned %d: %s", method, path, resp.StatusCode, strings.TrimSpace(string(respBody)))
+	}
+
+	if out == nil || len(respBody) == 0 {
+		return nil
+	}
+	return json.Unmarshal(respBody, out)
+}
+
+// stream calls handle with every JSON line of a streaming response until the
+// server ends it. established reports whether the server accepted the
+// request, the stream may still have failed later on.
+func (c *client) stream(path string, handle func(line []byte) error) (established bool, err error) {
+	req, err := http.NewRequest("GET", c.address+path, nil)
+	if err != nil {
+		return false, err
+	}
+	c.authorize(req)
+
+	resp, err := (&http.Client{}).Do(req)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		respBody, _ := ioutil.ReadAll(resp.Body)
+		return false, &statusError{method: "GET", path: path, status: resp.StatusCode, message: strings.TrimSpace(string(respBody))}
+	}
+
+	decoder := json.NewDecoder(resp.Body)
+	for {
+		var line json.RawMessage
+		err = decoder.Decode(&line)
+		if err == io.EOF {
+			return true, nil
+		}
+		if err != nil {
+			return true, err
+		}
+		if err = handle(line); err != nil {
+			return true, err
+		}
+	}
+}
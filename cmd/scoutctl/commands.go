@@ -0,0 +1,459 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/url"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+var errUsage = errors.New("usage")
+
+// maxStreamAttempts bounds the attempts in a row to open the event stream.
+const maxStreamAttempts = 5
+
+var streamRetryDelay = 2 * time.Second
+
+type ctl struct {
+	client *client
+	json   bool
+	out    io.Writer
+}
+
+type cluster struct {
+	Leader    string         `json:"leader"`
+	RaftState string         `json:"raftState"`
+	Nodes     map[string]int `json:"nodes"`
+	Buckets   int            `json:"buckets"`
+	Rebalance *struct {
+		Status   string  `json:"status"`
+		Progress float64 `json:"progress"`
+	} `json:"rebalance"`
+	LastReconcile *struct {
+		Finished time.Time `json:"finished"`
+		Changes  []string  `json:"changes"`
+		Errors   []string  `json:"errors"`
+	} `json:"lastReconcile"`
+	Alerts []struct {
+		ID       string `json:"id"`
+		Severity string `json:"severity"`
+		Message  string `json:"message"`
+	} `json:"alerts"`
+	Errors []string `json:"errors"`
+}
+
+type member struct {
+	Name       string   `json:"name"`
+	Address    string   `json:"address"`
+	Services   []string `json:"services"`
+	Zone       string   `json:"zone"`
+	Status     string   `json:"status"`
+	Serf       string   `json:"serf"`
+	Membership string   `json:"membership"`
+	Health     string   `json:"health"`
+}
+
+type bucket struct {
+	Name          string `json:"name"`
+	BucketType    string `json:"type"`
+	RAMQuotaMB    int    `json:"ramQuotaMB"`
+	ReplicaNumber int    `json:"replicas"`
+	Declared      bool   `json:"declared"`
+	Stats         *struct {
+		QuotaPercentUsed float64 `json:"quotaPercentUsed"`
+		OpsPerSec        float64 `json:"opsPerSec"`
+		ItemCount        int64   `json:"itemCount"`
+	} `json:"stats"`
+}
+
+type raftInfo struct {
+	State   string `json:"state"`
+	Leader  string `json:"leader"`
+	Servers []struct {
+		ID       string `json:"id"`
+		Address  string `json:"address"`
+		Suffrage string `json:"suffrage"`
+	} `json:"servers"`
+}
+
+type event struct {
+	Type     string    `json:"type"`
+	Severity string    `json:"severity"`
+	Subject  string    `json:"subject"`
+	Message  string    `json:"message"`
+	Node     string    `json:"node"`
+	Time     time.Time `json:"time"`
+}
+
+func (c *ctl) run(command string, args []string) error {
+	switch command {
+	case "status":
+		return c.status()
+	case "members":
+		return c.members()
+	case "leader":
+		return c.leader()
+	case "buckets":
+		return c.buckets(args)
+	case "rebalance":
+		return c.rebalance()
+	case "failover":
+		return c.failover(args)
+	case "backup":
+		return c.backup(args)
+	case "events":
+		return c.events(args)
+	}
+	return errUsage
+}
+
+func (c *ctl) status() error {
+	var raw json.RawMessage
+	if err := c.client.get("/v1/cluster", &raw); err != nil {
+		return err
+	}
+	if c.json {
+		return c.printJSON(raw)
+	}
+
+	view := cluster{}
+	if err := json.Unmarshal(raw, &view); err != nil {
+		return err
+	}
+
+	table := c.table()
+	fmt.Fprintf(table, "Leader:\t%s\n", orNone(view.Leader))
+	fmt.Fprintf(table, "Raft state:\t%s\n", view.RaftState)
+
+	nodes := make([]string, 0, len(view.Nodes))
+	for status, count := range view.Nodes {
+		nodes = append(nodes, fmt.Sprintf("%d %s", count, status))
+	}
+	fmt.Fprintf(table, "Nodes:\t%s\n", orNone(strings.Join(nodes, ", ")))
+	fmt.Fprintf(table, "Declared buckets:\t%d\n", view.Buckets)
+
+	if view.Rebalance != nil {
+		rebalance := view.Rebalance.Status
+		if rebalance == "running" {
+			rebalance = fmt.Sprintf("running, %.0f%%", view.Rebalance.Progress)
+		}
+		fmt.Fprintf(table, "Rebalance:\t%s\n", rebalance)
+	}
+
+	if view.LastReconcile != nil {
+		fmt.Fprintf(table, "Last reconcile:\t%s, %d changes, %d errors\n",
+			view.LastReconcile.Finished.Local().Format(time.RFC3339), len(view.LastReconcile.Changes), len(view.LastReconcile.Errors))
+	}
+
+	fmt.Fprintf(table, "Firing alerts:\t%d\n", len(view.Alerts))
+	for _, alert := range view.Alerts {
+		fmt.Fprintf(table, "  %s\t[%s] %s\n", alert.ID, alert.Severity, alert.Message)
+	}
+
+	for _, problem := range view.Errors {
+		fmt.Fprintf(table, "Error:\t%s\n", problem)
+	}
+	return table.Flush()
+}
+
+func (c *ctl) members() error {
+	var raw json.RawMessage
+	if err := c.client.get("/v1/nodes", &raw); err != nil {
+		return err
+	}
+	if c.json {
+		return c.printJSON(raw)
+	}
+
+	members := make([]member, 0)
+	if err := json.Unmarshal(raw, &members); err != nil {
+		return err
+	}
+
+	table := c.table()
+	fmt.Fprintln(table, "NAME\tADDRESS\tSTATUS\tSERF\tCOUCHBASE\tHEALTH\tZONE\tSERVICES")
+	for _, node := range members {
+		fmt.Fprintf(table, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n", node.Name, node.Address, node.Status,
+			orNone(node.Serf), orNone(node.Membership), orNone(node.Health), orNone(node.Zone), strings.Join(node.Services, ","))
+	}
+	return table.Flush()
+}
+
+func (c *ctl) leader() error {
+	var raw json.RawMessage
+	if err := c.client.get("/v1/raft", &raw); err != nil {
+		return err
+	}
+
+	info := raftInfo{}
+	if err := json.Unmarshal(raw, &info); err != nil {
+		return err
+	}
+
+	if c.json {
+		return c.printJSON(map[string]string{"leader": info.Leader})
+	}
+
+	if info.Leader == "" {
+		return fmt.Errorf("the cluster has no leader")
+	}
+	fmt.Fprintln(c.out, info.Leader)
+	return nil
+}
+
+func (c *ctl) buckets(args []string) error {
+	if len(args) == 0 {
+		return errUsage
+	}
+
+	switch args[0] {
+	case "list":
+		return c.listBuckets()
+	case "create":
+		return c.createBucket(args[1:])
+	case "delete":
+		return c.deleteBucket(args[1:])
+	}
+	return errUsage
+}
+
+func (c *ctl) listBuckets() error {
+	var raw json.RawMessage
+	if err := c.client.get("/v1/buckets", &raw); err != nil {
+		return err
+	}
+	if c.json {
+		return c.printJSON(raw)
+	}
+
+	buckets := make([]bucket, 0)
+	if err := json.Unmarshal(raw, &buckets); err != nil {
+		return err
+	}
+
+	table := c.table()
+	fmt.Fprintln(table, "NAME\tTYPE\tRAM MB\tREPLICAS\tDECLARED\tITEMS\tOPS/S\tQUOTA USED")
+	for _, listed := range buckets {
+		items, ops, used := "-", "-", "-"
+		if listed.Stats != nil {
+			items = fmt.Sprint(listed.Stats.ItemCount)
+			ops = fmt.Sprintf("%.0f", listed.Stats.OpsPerSec)
+			used = fmt.Sprintf("%.1f%%", listed.Stats.QuotaPercentUsed)
+		}
+		fmt.Fprintf(table, "%s\t%s\t%d\t%d\t%t\t%s\t%s\t%s\n", listed.Name, listed.BucketType,
+			listed.RAMQuotaMB, listed.ReplicaNumber, listed.Declared, items, ops, used)
+	}
+	return table.Flush()
+}
+
+func (c *ctl) createBucket(args []string) error {
+	flags := flag.NewFlagSet("buckets create", flag.ContinueOnError)
+	bucketType := flags.String("type", "couchbase", "couchbase, ephemeral or memcached")
+	ramQuota := flags.Int("ram", 256, "RAM quota per node in MB")
+	replicas := flags.Int("replicas", 1, "number of replicas")
+	eviction := flags.String("eviction", "", "eviction policy")
+	flush := flags.Bool("flush", false, "enable flushing the bucket")
+	if err := flags.Parse(args); err != nil || flags.NArg() != 1 {
+		return errUsage
+	}
+
+	request := map[string]interface{}{
+		"name":         flags.Arg(0),
+		"type":         *bucketType,
+		"ramQuotaMB":   *ramQuota,
+		"replicas":     *replicas,
+		"flushEnabled": *flush,
+	}
+	if *eviction != "" {
+		request["evictionPolicy"] = *eviction
+	}
+
+	var raw json.RawMessage
+	if err := c.client.post("/v1/buckets", request, &raw); err != nil {
+		return err
+	}
+	return c.done(raw, fmt.Sprintf("created bucket %s", flags.Arg(0)))
+}
+
+func (c *ctl) deleteBucket(args []string) error {
+	flags := flag.NewFlagSet("buckets delete", flag.ContinueOnError)
+	force := flags.Bool("force", false, "delete the bucket even when it holds items")
+	if err := flags.Parse(args); err != nil || flags.NArg() != 1 {
+		return errUsage
+	}
+
+	path := "/v1/buckets/" + url.PathEscape(flags.Arg(0))
+	if *force {
+		path += "?force=true"
+	}
+
+	if err := c.client.delete(path); err != nil {
+		return err
+	}
+	return c.done(nil, fmt.Sprintf("deleted bucket %s", flags.Arg(0)))
+}
+
+func (c *ctl) rebalance() error {
+	var raw json.RawMessage
+	if err := c.client.post("/v1/operations", map[string]string{"type": "rebalance"}, &raw); err != nil {
+		return err
+	}
+	return c.done(raw, "rebalance started, follow it with scoutctl status")
+}
+
+func (c *ctl) failover(args []string) error {
+	flags := flag.NewFlagSet("failover", flag.ContinueOnError)
+	graceful := flags.Bool("graceful", false, "move the active data off the node before failing it over")
+	if err := flags.Parse(args); err != nil || flags.NArg() != 1 {
+		return errUsage
+	}
+
+	request := map[string]interface{}{
+		"type":     "failover",
+		"node":     flags.Arg(0),
+		"graceful": *graceful,
+	}
+
+	var raw json.RawMessage
+	if err := c.client.post("/v1/operations", request, &raw); err != nil {
+		return err
+	}
+	return c.done(raw, fmt.Sprintf("failover of %s started", flags.Arg(0)))
+}
+
+func (c *ctl) backup(args []string) error {
+	if len(args) == 2 && args[0] == "restore" {
+		var raw json.RawMessage
+		if err := c.client.post("/v1/backups/"+url.PathEscape(args[1])+"/restore", nil, &raw); err != nil {
+			return err
+		}
+		return c.done(raw, fmt.Sprintf("restore of backup %s started, follow it with scoutctl status", args[1]))
+	}
+
+	if len(args) == 0 || args[0] != "now" {
+		return errUsage
+	}
+
+	flags := flag.NewFlagSet("backup now", flag.ContinueOnError)
+	kind := flags.String("kind", "full", "full or incremental")
+	if err := flags.Parse(args[1:]); err != nil || flags.NArg() != 0 {
+		return errUsage
+	}
+
+	var raw json.RawMessage
+	if err := c.client.post("/v1/backups", map[string]string{"kind": *kind}, &raw); err != nil {
+		return err
+	}
+	return c.done(raw, fmt.Sprintf("%s backup started", *kind))
+}
+
+func (c *ctl) events(args []string) error {
+	flags := flag.NewFlagSet("events", flag.ContinueOnError)
+	follow := flags.Bool("follow", false, "keep printing events as they happen")
+	if err := flags.Parse(args); err != nil || flags.NArg() != 0 {
+		return errUsage
+	}
+
+	if !*follow {
+		var raw json.RawMessage
+		if err := c.client.get("/v1/events", &raw); err != nil {
+			return err
+		}
+		if c.json {
+			return c.printJSON(raw)
+		}
+
+		events := make([]event, 0)
+		if err := json.Unmarshal(raw, &events); err != nil {
+			return err
+		}
+		for _, listed := range events {
+			c.printEvent(listed)
+		}
+		return nil
+	}
+
+	// The stream ends when the leader changes, it is opened again against
+	// whichever node becomes the leader. Failing to open it is retried a few
+	// times, unless the API refuses the request for good.
+	attempts := 0
+	for {
+		var failed error
+		established, err := c.client.stream("/v1/events?follow=true", func(line []byte) error {
+			if c.json {
+				fmt.Fprintln(c.out, string(line))
+				return nil
+			}
+
+			streamed := event{}
+			if failed = json.Unmarshal(line, &streamed); failed != nil {
+				return failed
+			}
+			c.printEvent(streamed)
+			return nil
+		})
+		if failed != nil {
+			return fmt.Errorf("error reading event : %s", failed)
+		}
+
+		if established {
+			attempts = 0
+		} else {
+			if !retryable(err) {
+				return err
+			}
+			attempts++
+			if attempts >= maxStreamAttempts {
+				return fmt.Errorf("error following events after %d attempts : %s", attempts, err)
+			}
+		}
+
+		if err != nil {
+			log.Printf("event stream ended: %s, reconnecting", err)
+		}
+		time.Sleep(streamRetryDelay)
+	}
+}
+
+func (c *ctl) printEvent(printed event) {
+	fmt.Fprintf(c.out, "%s  %-8s %-20s %s: %s\n", printed.Time.Local().Format(time.RFC3339),
+		printed.Severity, printed.Type, printed.Subject, printed.Message)
+}
+
+// done reports a successful mutation, raw is the answer of the API.
+func (c *ctl) done(raw json.RawMessage, message string) error {
+	if c.json {
+		if raw == nil {
+			return c.printJSON(map[string]string{"status": message})
+		}
+		return c.printJSON(raw)
+	}
+	fmt.Fprintln(c.out, message)
+	return nil
+}
+
+func (c *ctl) printJSON(value interface{}) error {
+	encoded, err := json.MarshalIndent(value, "", "  ")
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(c.out, string(encoded))
+	return nil
+}
+
+func (c *ctl) table() *tabwriter.Writer {
+	return tabwriter.NewWriter(c.out, 0, 4, 2, ' ', 0)
+}
+
+func orNone(value string) string {
+	if value == "" {
+		return "-"
+	}
+	return value
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestEventsFollow(t *testing.T) {
+	streamRetryDelay = 0
+
+	event := `{"type":"node.joined","severity":"info","subject":"node-a","message":"joined","time":"2026-10-18T12:00:00Z"}`
+	tests := []struct {
+		name      string
+		responses []int
+		wantCalls int
+		wantError string
+		wantEvent bool
+	}{
+		{
+			name:      "unauthorized is not retried",
+			responses: []int{http.StatusUnauthorized},
+			wantCalls: 1,
+			wantError: "returned 401",
+		},
+		{
+			name:      "unavailable gives up after the attempts",
+			responses: []int{http.StatusServiceUnavailable},
+			wantCalls: maxStreamAttempts,
+			wantError: fmt.Sprintf("after %d attempts", maxStreamAttempts),
+		},
+		{
+			name:      "established stream resets the attempts",
+			responses: []int{503, 503, 503, 503, 200, 503, 503, 503, 503, 404},
+			wantCalls: 10,
+			wantError: "returned 404",
+			wantEvent: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			calls := 0
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				status := test.responses[len(test.responses)-1]
+				if calls < len(test.responses) {
+					status = test.responses[calls]
+				}
+				calls++
+
+				w.WriteHeader(status)
+				if status == http.StatusOK {
+					fmt.Fprintln(w, event)
+				}
+			}))
+			defer server.Close()
+
+			out := &bytes.Buffer{}
+			c := &ctl{client: newClient(server.URL), out: out}
+
+			err := c.events([]string{"-follow"})
+			if err == nil || !strings.Contains(err.Error(), test.wantError) {
+				t.Fatalf("expected an error containing %q, got %v", test.wantError, err)
+			}
+			if calls != test.wantCalls {
+				t.Fatalf("expected %d requests, got %d", test.wantCalls, calls)
+			}
+			if strings.Contains(out.String(), "node.joined") != test.wantEvent {
+				t.Fatalf("unexpected output %q", out.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,69 @@
+// scoutctl inspects and operates a scout cluster through the admin API of
+// any of its nodes.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+)
+
+const usage = `usage: scoutctl [-addr host:port] [-user name] [-token token] [-json] <command>
+
+commands:
+  status                         cluster overview
+  members                        scout and couchbase nodes
+  leader                         current raft leader
+  buckets list                   buckets with their basic stats
+  buckets create [flags] <name>  create a bucket not declared in the config
+  buckets delete [-force] <name> delete a bucket not declared in the config
+  rebalance                      rebalance the current members
+  failover [-graceful] <node>    fail over a node
+  backup now [-kind full]        start a backup
+  backup restore <id>            restore the cluster from a backup
+  events [-follow]               recent cluster events
+`
+
+func main() {
+	flags := flag.NewFlagSet("scoutctl", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprint(os.Stderr, usage)
+		flags.PrintDefaults()
+	}
+
+	address := os.Getenv("SCOUT_ADDR")
+	if address == "" {
+		address = "127.0.0.1:8600"
+	}
+	flags.StringVar(&address, "addr", address, "address of a scout node, defaults to $SCOUT_ADDR")
+	username := flags.String("user", os.Getenv("SCOUT_USER"), "couchbase admin user, defaults to $SCOUT_USER, the password is read from $SCOUT_PASSWORD")
+	token := flags.String("token", os.Getenv("SCOUT_TOKEN"), "API token used instead of the admin credentials, defaults to $SCOUT_TOKEN")
+	jsonOutput := flags.Bool("json", false, "print JSON instead of tables")
+	flags.Parse(os.Args[1:])
+
+	if flags.NArg() == 0 {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	client := newClient(address)
+	client.username = *username
+	client.password = os.Getenv("SCOUT_PASSWORD")
+	client.token = *token
+
+	ctl := &ctl{
+		client: client,
+		json:   *jsonOutput,
+		out:    os.Stdout,
+	}
+
+	err := ctl.run(flags.Arg(0), flags.Args()[1:])
+	if err == errUsage {
+		flags.Usage()
+		os.Exit(2)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,246 @@
+package backup
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	Full        = "full"
+	Incremental = "incremental"
+)
+
+const (
+	RunRunning   = "running"
+	RunCompleted = "completed"
+	RunFailed    = "failed"
+)
+
+const (
+	defaultBinary        = "cbbackupmgr"
+	defaultRepository    = "scout"
+	defaultInterval      = 24 * time.Hour
+	defaultRetryInterval = 15 * time.Minute
+	defaultTimeout       = 6 * time.Hour
+)
+
+// Config is the backup: section of config.yml. Backups are incremental
+// every Interval and full every FullInterval, a failed backup is retried
+// after RetryInterval. Retention is the number of backups kept in the
+// repository, with Merge the oldest backups are merged instead of removed.
+// When S3 has an endpoint the repository is uploaded after every backup.
+type Config struct {
+	Enabled       bool          `yaml:"enabled"`
+	Binary        string        `yaml:"binary"`
+	Archive       string        `yaml:"archive"`
+	Repository    string        `yaml:"repository"`
+	Interval      time.Duration `yaml:"interval"`
+	FullInterval  time.Duration `yaml:"fullinterval"`
+	RetryInterval time.Duration `yaml:"retryinterval"`
+	Timeout       time.Duration `yaml:"timeout"`
+	Retention     int           `yaml:"retention"`
+	Merge         bool          `yaml:"merge"`
+	Threads       int           `yaml:"threads"`
+	S3            S3Config      `yaml:"s3"`
+}
+
+// Run records a backup started by the leader, it is replicated so a new
+// leader continues the schedule of its predecessor.
+type Run struct {
+	ID       string    `json:"id"`
+	Kind     string    `json:"kind"`
+	Status   string    `json:"status"`
+	Node     string    `json:"node"`
+	Backup   string    `json:"backup,omitempty"`
+	Uploaded bool      `json:"uploaded"`
+	Message  string    `json:"message,omitempty"`
+	Started  time.Time `json:"started"`
+	Finished time.Time `json:"finished"`
+}
+
+// Manager runs cbbackupmgr against a cluster.
+type Manager struct {
+	config   Config
+	cluster  string
+	username string
+	password string
+}
+
+func NewManager(config Config, cluster string, username string, password string) *Manager {
+	return &Manager{
+		config:   config,
+		cluster:  cluster,
+		username: username,
+		password: password,
+	}
+}
+
+// Backup takes a backup into the repository, creating the repository first
+// if needed. It returns the name of the new backup.
+func (manager *Manager) Backup(ctx context.Context, kind string) (string, error) {
+	err := manager.configure(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	before, err := manager.Backups()
+	if err != nil {
+		return "", err
+	}
+
+	args := []string{"backup",
+		"--archive", manager.config.Archive,
+		"--repo", manager.config.repository(),
+		"--cluster", manager.cluster,
+		"--username", manager.username,
+	}
+	if kind == Full {
+		args = append(args, "--full-backup")
+	}
+	if manager.config.Threads > 0 {
+		args = append(args, "--threads", strconv.Itoa(manager.config.Threads))
+	}
+
+	_, err = manager.run(ctx, args...)
+	if err != nil {
+		return "", err
+	}
+
+	after, err := manager.Backups()
+	if err != nil || len(after) == len(before) {
+		return "", err
+	}
+	return after[len(after)-1], nil
+}
+
+// ApplyRetention merges or removes the oldest backups so no more than
+// Retention remain. It returns the backups that are gone from the repository.
+func (manager *Manager) ApplyRetention(ctx context.Context) ([]string, error) {
+	if manager.config.Retention <= 0 {
+		return nil, nil
+	}
+
+	backups, err := manager.Backups()
+	if err != nil {
+		return nil, err
+	}
+
+	excess := len(backups) - manager.config.Retention
+	if excess <= 0 {
+		return nil, nil
+	}
+
+	if manager.config.Merge {
+		// Merging the oldest excess+1 backups leaves Retention backups.
+		_, err = manager.run(ctx, "merge",
+			"--archive", manager.config.Archive,
+			"--repo", manager.config.repository(),
+			"--start", backups[0],
+			"--end", backups[excess])
+	} else {
+		log.Printf("removing backups %v", backups[:excess])
+		_, err = manager.run(ctx, "remove",
+			"--archive", manager.config.Archive,
+			"--repo", manager.config.repository(),
+			"--backups", backups[0]+","+backups[excess-1])
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	left, err := manager.Backups()
+	if err != nil {
+		return nil, err
+	}
+	kept := make(map[string]bool)
+	for _, name := range left {
+		kept[name] = true
+	}
+
+	removed := make([]string, 0)
+	for _, name := range backups {
+		if !kept[name] {
+			removed = append(removed, name)
+		}
+	}
+	return removed, nil
+}
+
+// Backups lists the backups of the repository from oldest to newest. Backups
+// are directories named after the time they were taken.
+func (manager *Manager) Backups() ([]string, error) {
+	entries, err := ioutil.ReadDir(manager.RepositoryPath())
+	if os.IsNotExist(err) {
+		return []string{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	backups := make([]string, 0)
+	for _, entry := range entries {
+		if entry.IsDir() && !strings.HasPrefix(entry.Name(), ".") {
+			backups = append(backups, entry.Name())
+		}
+	}
+	sort.Strings(backups)
+	return backups, nil
+}
+
+func (manager *Manager) RepositoryPath() string {
+	return filepath.Join(manager.config.Archive, manager.config.repository())
+}
+
+func (manager *Manager) configure(ctx context.Context) error {
+	if _, err := os.Stat(manager.RepositoryPath()); err == nil {
+		return nil
+	}
+
+	err := os.MkdirAll(manager.config.Archive, 0755)
+	if err != nil {
+		return err
+	}
+
+	_, err = manager.run(ctx, "config", "--archive", manager.config.Archive, "--repo", manager.config.repository())
+	return err
+}
+
+func (manager *Manager) run(ctx context.Context, args ...string) (string, error) {
+	binary := manager.config.Binary
+	if binary == "" {
+		binary = defaultBinary
+	}
+
+	var output bytes.Buffer
+	cmd := exec.CommandContext(ctx, binary, args...)
+	// The password is passed through the environment, arguments are
+	// visible to every user of the host.
+	if manager.password != "" {
+		cmd.Env = append(os.Environ(), "CB_PASSWORD="+manager.password)
+	}
+	cmd.Stdout = &output
+	cmd.Stderr = &output
+
+	err := cmd.Run()
+	if err != nil {
+		return output.String(), fmt.Errorf("%s %s failed: %s: %s", binary, args[0], err, strings.TrimSpace(output.String()))
+	}
+	return output.String(), nil
+}
+
+func (config Config) repository() string {
+	if config.Repository != "" {
+		return config.Repository
+	}
+	return defaultRepository
+}
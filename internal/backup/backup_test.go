@@ -0,0 +1,167 @@
+package backup
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// fakeBinary writes a cbbackupmgr stand-in that records its arguments and
+// the password it was given, creates a backup directory for backups and
+// deletes the directories of removed or merged backups, keeping the last
+// merged one.
+func fakeBinary(t *testing.T, dir string) (string, string) {
+	t.Helper()
+	log := filepath.Join(dir, "calls")
+	script := `#!/bin/sh
+echo "$* password=$CB_PASSWORD" >> ` + log + `
+if [ "$1" = backup ]; then
+	mkdir -p "$3/$5/2026-10-18T12_00_00"
+fi
+if [ "$1" = remove ]; then
+	first=${7%,*}
+	last=${7#*,}
+fi
+if [ "$1" = merge ]; then
+	first=$7
+	last=$9
+fi
+if [ -n "$first" ]; then
+	for name in $(ls "$3/$5"); do
+		if expr "$name" \>= "$first" >/dev/null && expr "$name" \<= "$last" >/dev/null; then
+			[ "$1" = merge ] && [ "$name" = "$last" ] || rm -r "$3/$5/$name"
+		fi
+	done
+fi
+`
+	binary := filepath.Join(dir, "cbbackupmgr")
+	if err := ioutil.WriteFile(binary, []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	return binary, log
+}
+
+func calls(t *testing.T, log string) []string {
+	t.Helper()
+	content, err := ioutil.ReadFile(log)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return strings.Split(strings.TrimSpace(string(content)), "\n")
+}
+
+func TestBackupPassesPasswordInEnvironment(t *testing.T) {
+	dir, err := ioutil.TempDir("", "backup")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	binary, log := fakeBinary(t, dir)
+	archive := filepath.Join(dir, "archive")
+	manager := NewManager(Config{Binary: binary, Archive: archive}, "couchbase://127.0.0.1", "admin", "s3cret")
+
+	name, err := manager.Backup(context.Background(), Full)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if name != "2026-10-18T12_00_00" {
+		t.Fatalf("unexpected backup %q", name)
+	}
+
+	for _, call := range calls(t, log) {
+		arguments := strings.SplitN(call, " password=", 2)
+		if strings.Contains(arguments[0], "s3cret") {
+			t.Fatalf("password passed as an argument: %s", call)
+		}
+		if arguments[1] != "s3cret" {
+			t.Fatalf("password missing from the environment: %s", call)
+		}
+	}
+}
+
+func TestApplyRetention(t *testing.T) {
+	tests := []struct {
+		name      string
+		config    Config
+		backups   []string
+		want      string
+		removed   []string
+		untouched bool
+	}{
+		{
+			name:    "removes the oldest backups",
+			config:  Config{Retention: 2},
+			backups: []string{"b1", "b2", "b3", "b4"},
+			want:    "remove --archive ARCHIVE --repo scout --backups b1,b2",
+			removed: []string{"b1", "b2"},
+		},
+		{
+			name:    "merges the oldest backups",
+			config:  Config{Retention: 2, Merge: true},
+			backups: []string{"b1", "b2", "b3", "b4"},
+			want:    "merge --archive ARCHIVE --repo scout --start b1 --end b3",
+			removed: []string{"b1", "b2"},
+		},
+		{
+			name:      "nothing beyond retention",
+			config:    Config{Retention: 4},
+			backups:   []string{"b1", "b2", "b3", "b4"},
+			untouched: true,
+		},
+		{
+			name:      "no retention keeps everything",
+			backups:   []string{"b1", "b2"},
+			untouched: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "backup")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(dir)
+
+			binary, log := fakeBinary(t, dir)
+			config := test.config
+			config.Binary = binary
+			config.Archive = filepath.Join(dir, "archive")
+			for _, name := range test.backups {
+				if err := os.MkdirAll(filepath.Join(config.Archive, "scout", name), 0755); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			removed, err := NewManager(config, "", "admin", "").ApplyRetention(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			made := calls(t, log)
+			if test.untouched {
+				if len(made) != 0 {
+					t.Fatalf("expected no calls, got %v", made)
+				}
+				return
+			}
+
+			want := strings.Replace(test.want, "ARCHIVE", config.Archive, 1) + " password="
+			if len(made) != 1 || made[0] != want {
+				t.Fatalf("expected %q, got %q", want, made)
+			}
+
+			if !reflect.DeepEqual(removed, test.removed) {
+				t.Fatalf("expected %v to be reported as removed, got %v", test.removed, removed)
+			}
+		})
+	}
+}
@@ -0,0 +1,73 @@
+package backup
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+)
+
+// Restore loads the backups from start to end of the repository back into
+// the cluster, documents that exist in the cluster are overwritten.
+func (manager *Manager) Restore(ctx context.Context, start string, end string) error {
+	args := []string{"restore",
+		"--archive", manager.config.Archive,
+		"--repo", manager.config.repository(),
+		"--cluster", manager.cluster,
+		"--username", manager.username,
+		"--start", start,
+		"--end", end,
+		"--force-updates",
+	}
+	if manager.config.Threads > 0 {
+		args = append(args, "--threads", strconv.Itoa(manager.config.Threads))
+	}
+
+	_, err := manager.run(ctx, args...)
+	return err
+}
+
+// RestoreRange returns the backups of local to restore to get the cluster
+// back to the state of run id. An incremental backup is restored together
+// with the full backup it builds on, or with the oldest backup left when
+// retention merged or removed that one.
+func RestoreRange(runs []Run, id string, local []string) (string, string, error) {
+	sorted := append([]Run(nil), runs...)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].Started.Before(sorted[j].Started)
+	})
+
+	available := make(map[string]bool)
+	for _, name := range local {
+		available[name] = true
+	}
+
+	var target *Run
+	start := ""
+	for i := range sorted {
+		run := &sorted[i]
+		if run.Status == RunCompleted && run.Kind == Full && available[run.Backup] {
+			start = run.Backup
+		}
+		if run.ID == id {
+			target = run
+			break
+		}
+	}
+
+	switch {
+	case target == nil:
+		return "", "", fmt.Errorf("unknown backup %s", id)
+	case target.Status != RunCompleted || target.Backup == "":
+		return "", "", fmt.Errorf("backup %s is %s, only completed backups can be restored", id, target.Status)
+	case !available[target.Backup]:
+		return "", "", fmt.Errorf("backup %s is no longer in the repository", target.Backup)
+	}
+
+	if start == "" {
+		sortedLocal := append([]string(nil), local...)
+		sort.Strings(sortedLocal)
+		start = sortedLocal[0]
+	}
+	return start, target.Backup, nil
+}
@@ -0,0 +1,58 @@
+package backup
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRestoreRange(t *testing.T) {
+	base := time.Date(2026, 10, 18, 0, 0, 0, 0, time.UTC)
+	run := func(id string, kind string, status string, hour int) Run {
+		return Run{ID: id, Kind: kind, Status: status, Backup: "b" + id, Started: base.Add(time.Duration(hour) * time.Hour)}
+	}
+	runs := []Run{
+		run("1", Full, RunCompleted, 1),
+		run("2", Incremental, RunCompleted, 2),
+		run("3", Full, RunFailed, 3),
+		run("4", Incremental, RunCompleted, 4),
+		run("5", Full, RunCompleted, 5),
+		run("6", Incremental, RunCompleted, 6),
+		{ID: "7", Kind: Incremental, Status: RunRunning, Started: base.Add(7 * time.Hour)},
+	}
+	all := []string{"b1", "b2", "b4", "b5", "b6"}
+
+	tests := []struct {
+		name  string
+		id    string
+		local []string
+		start string
+		end   string
+		fails bool
+	}{
+		{name: "full backup", id: "5", local: all, start: "b5", end: "b5"},
+		{name: "incremental from its full backup", id: "4", local: all, start: "b1", end: "b4"},
+		{name: "incremental after a later full backup", id: "6", local: all, start: "b5", end: "b6"},
+		{name: "full backup merged away", id: "4", local: []string{"b2", "b4"}, start: "b2", end: "b4"},
+		{name: "unknown run", id: "9", local: all, fails: true},
+		{name: "run still running", id: "7", local: all, fails: true},
+		{name: "backup removed by retention", id: "2", local: []string{"b4", "b5", "b6"}, fails: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			start, end, err := RestoreRange(runs, test.id, test.local)
+			if test.fails {
+				if err == nil {
+					t.Fatalf("expected an error, got %s to %s", start, end)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if start != test.start || end != test.end {
+				t.Fatalf("expected %s to %s, got %s to %s", test.start, test.end, start, end)
+			}
+		})
+	}
+}
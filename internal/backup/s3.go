@@ -0,0 +1,520 @@
+package backup
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultRegion   = "us-east-1"
+	emptyPayloadSum = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+	// Files larger than a part are uploaded in parts, a single PUT is limited
+	// to 5GB and a multipart upload to 10000 parts.
+	defaultPartSize = 512 << 20
+)
+
+// S3Config points at an S3 compatible object store such as MinIO. Retention
+// is the number of backups kept in the store.
+type S3Config struct {
+	Endpoint  string `yaml:"endpoint"`
+	Region    string `yaml:"region"`
+	Bucket    string `yaml:"bucket"`
+	Prefix    string `yaml:"prefix"`
+	AccessKey string `yaml:"accesskey"`
+	SecretKey string `yaml:"secretkey"`
+	Retention int    `yaml:"retention"`
+}
+
+// S3Client is a minimal client for the object store using path style
+// requests signed with AWS signature version 4.
+type S3Client struct {
+	config     S3Config
+	httpClient *http.Client
+	partSize   int64
+}
+
+type Object struct {
+	Key  string
+	Size int64
+	ETag string
+}
+
+type listBucketResult struct {
+	Contents []struct {
+		Key  string `xml:"Key"`
+		Size int64  `xml:"Size"`
+		ETag string `xml:"ETag"`
+	} `xml:"Contents"`
+	IsTruncated           bool   `xml:"IsTruncated"`
+	NextContinuationToken string `xml:"NextContinuationToken"`
+}
+
+type initiateMultipartUploadResult struct {
+	UploadID string `xml:"UploadId"`
+}
+
+type completeMultipartUpload struct {
+	XMLName xml.Name        `xml:"CompleteMultipartUpload"`
+	Parts   []completedPart `xml:"Part"`
+}
+
+type completedPart struct {
+	PartNumber int    `xml:"PartNumber"`
+	ETag       string `xml:"ETag"`
+}
+
+func NewS3Client(config S3Config) *S3Client {
+	return &S3Client{
+		config: config,
+		httpClient: &http.Client{
+			Timeout: time.Hour,
+		},
+		partSize: defaultPartSize,
+	}
+}
+
+// PutObject uploads a file, md5Sum is checked by the store on arrival. Files
+// larger than a part are uploaded in parts, each checked on its own.
+func (client *S3Client) PutObject(ctx context.Context, key string, path string, sha256Sum string, md5Sum []byte) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+
+	if info.Size() > client.partSize {
+		return client.putMultipart(ctx, key, file, info.Size())
+	}
+
+	req, err := client.newRequest(ctx, "PUT", key, nil, file, sha256Sum)
+	if err != nil {
+		return err
+	}
+	req.ContentLength = info.Size()
+	req.Header.Set("Content-MD5", base64.StdEncoding.EncodeToString(md5Sum))
+	client.sign(req, sha256Sum)
+
+	_, err = client.do(req)
+	return err
+}
+
+func (client *S3Client) putMultipart(ctx context.Context, key string, file *os.File, size int64) error {
+	uploadID, err := client.createMultipartUpload(ctx, key)
+	if err != nil {
+		return err
+	}
+
+	upload := completeMultipartUpload{}
+	for offset := int64(0); offset < size; offset += client.partSize {
+		length := client.partSize
+		if size-offset < length {
+			length = size - offset
+		}
+
+		number := len(upload.Parts) + 1
+		etag, err := client.uploadPart(ctx, key, uploadID, number, io.NewSectionReader(file, offset, length))
+		if err != nil {
+			client.abortMultipartUpload(ctx, key, uploadID)
+			return fmt.Errorf("error uploading part %d : %s", number, err)
+		}
+		upload.Parts = append(upload.Parts, completedPart{PartNumber: number, ETag: etag})
+	}
+
+	err = client.completeMultipartUpload(ctx, key, uploadID, upload)
+	if err != nil {
+		client.abortMultipartUpload(ctx, key, uploadID)
+		return err
+	}
+	return nil
+}
+
+func (client *S3Client) createMultipartUpload(ctx context.Context, key string) (string, error) {
+	req, err := client.newRequest(ctx, "POST", key, url.Values{"uploads": {""}}, nil, emptyPayloadSum)
+	if err != nil {
+		return "", err
+	}
+	client.sign(req, emptyPayloadSum)
+
+	resp, err := client.do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	result := initiateMultipartUploadResult{}
+	err = xml.NewDecoder(resp.Body).Decode(&result)
+	if err != nil {
+		return "", fmt.Errorf("error decoding multipart upload of %s: %s", key, err)
+	}
+	return result.UploadID, nil
+}
+
+// uploadPart uploads a part and returns its etag.
+func (client *S3Client) uploadPart(ctx context.Context, key string, uploadID string, number int, part *io.SectionReader) (string, error) {
+	sha256Hash := sha256.New()
+	md5Hash := md5.New()
+	_, err := io.Copy(io.MultiWriter(sha256Hash, md5Hash), part)
+	if err != nil {
+		return "", err
+	}
+	_, err = part.Seek(0, io.SeekStart)
+	if err != nil {
+		return "", err
+	}
+	sha256Sum := hex.EncodeToString(sha256Hash.Sum(nil))
+
+	query := url.Values{}
+	query.Set("partNumber", strconv.Itoa(number))
+	query.Set("uploadId", uploadID)
+	req, err := client.newRequest(ctx, "PUT", key, query, part, sha256Sum)
+	if err != nil {
+		return "", err
+	}
+	req.ContentLength = part.Size()
+	req.Header.Set("Content-MD5", base64.StdEncoding.EncodeToString(md5Hash.Sum(nil)))
+	client.sign(req, sha256Sum)
+
+	resp, err := client.do(req)
+	if err != nil {
+		return "", err
+	}
+	return resp.Header.Get("ETag"), nil
+}
+
+func (client *S3Client) completeMultipartUpload(ctx context.Context, key string, uploadID string, upload completeMultipartUpload) error {
+	body, err := xml.Marshal(upload)
+	if err != nil {
+		return err
+	}
+	bodySum := sha256.Sum256(body)
+	payloadSum := hex.EncodeToString(bodySum[:])
+
+	req, err := client.newRequest(ctx, "POST", key, url.Values{"uploadId": {uploadID}}, bytes.NewReader(body), payloadSum)
+	if err != nil {
+		return err
+	}
+	client.sign(req, payloadSum)
+
+	resp, err := client.do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	// The store answers 200 and reports errors that happen while the parts
+	// are assembled in the body.
+	respBody, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if bytes.Contains(respBody, []byte("<Error>")) {
+		return fmt.Errorf("error completing multipart upload of %s: %s", key, strings.TrimSpace(string(respBody)))
+	}
+	return nil
+}
+
+func (client *S3Client) abortMultipartUpload(ctx context.Context, key string, uploadID string) {
+	req, err := client.newRequest(ctx, "DELETE", key, url.Values{"uploadId": {uploadID}}, nil, emptyPayloadSum)
+	if err != nil {
+		return
+	}
+	client.sign(req, emptyPayloadSum)
+
+	_, err = client.do(req)
+	if err != nil {
+		log.Printf("error aborting multipart upload of %s: %s", key, err)
+	}
+}
+
+// ETag returns the etag the store reports for the file once PutObject
+// uploaded it. Objects uploaded in parts get the md5 of the md5 sums of their
+// parts followed by the number of parts.
+func (client *S3Client) ETag(path string, md5Sum []byte) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return "", err
+	}
+	if info.Size() <= client.partSize {
+		return hex.EncodeToString(md5Sum), nil
+	}
+
+	sums := md5.New()
+	parts := 0
+	for offset := int64(0); offset < info.Size(); offset += client.partSize {
+		part := md5.New()
+		_, err = io.Copy(part, io.NewSectionReader(file, offset, client.partSize))
+		if err != nil {
+			return "", err
+		}
+		sums.Write(part.Sum(nil))
+		parts++
+	}
+	return fmt.Sprintf("%s-%d", hex.EncodeToString(sums.Sum(nil)), parts), nil
+}
+
+// HeadObject returns the size and etag of an object.
+func (client *S3Client) HeadObject(ctx context.Context, key string) (Object, error) {
+	req, err := client.newRequest(ctx, "HEAD", key, nil, nil, emptyPayloadSum)
+	if err != nil {
+		return Object{}, err
+	}
+	client.sign(req, emptyPayloadSum)
+
+	resp, err := client.do(req)
+	if err != nil {
+		return Object{}, err
+	}
+
+	return Object{
+		Key:  key,
+		Size: resp.ContentLength,
+		ETag: strings.Trim(resp.Header.Get("ETag"), `"`),
+	}, nil
+}
+
+// GetObject downloads an object to path.
+func (client *S3Client) GetObject(ctx context.Context, key string, path string) error {
+	req, err := client.newRequest(ctx, "GET", key, nil, nil, emptyPayloadSum)
+	if err != nil {
+		return err
+	}
+	client.sign(req, emptyPayloadSum)
+
+	resp, err := client.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("GET %s returned %d: %s", key, resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(file, resp.Body)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+func (client *S3Client) DeleteObject(ctx context.Context, key string) error {
+	req, err := client.newRequest(ctx, "DELETE", key, nil, nil, emptyPayloadSum)
+	if err != nil {
+		return err
+	}
+	client.sign(req, emptyPayloadSum)
+
+	_, err = client.do(req)
+	return err
+}
+
+// ListObjects returns every object whose key starts with prefix.
+func (client *S3Client) ListObjects(ctx context.Context, prefix string) ([]Object, error) {
+	objects := make([]Object, 0)
+	token := ""
+
+	for {
+		query := url.Values{}
+		query.Set("list-type", "2")
+		query.Set("prefix", prefix)
+		if token != "" {
+			query.Set("continuation-token", token)
+		}
+
+		req, err := client.newRequest(ctx, "GET", "", query, nil, emptyPayloadSum)
+		if err != nil {
+			return nil, err
+		}
+		client.sign(req, emptyPayloadSum)
+
+		resp, err := client.do(req)
+		if err != nil {
+			return nil, err
+		}
+
+		result := listBucketResult{}
+		err = xml.NewDecoder(resp.Body).Decode(&result)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("error decoding object list: %s", err)
+		}
+
+		for _, content := range result.Contents {
+			objects = append(objects, Object{
+				Key:  content.Key,
+				Size: content.Size,
+				ETag: strings.Trim(content.ETag, `"`),
+			})
+		}
+
+		if !result.IsTruncated {
+			return objects, nil
+		}
+		token = result.NextContinuationToken
+	}
+}
+
+func (client *S3Client) newRequest(ctx context.Context, method string, key string, query url.Values, body io.Reader, payloadSum string) (*http.Request, error) {
+	endpoint := strings.TrimRight(client.config.Endpoint, "/") + "/" + client.config.Bucket
+	if key != "" {
+		endpoint += "/" + escapePath(key)
+	}
+	if query != nil {
+		endpoint += "?" + canonicalQuery(query)
+	}
+
+	req, err := http.NewRequest(method, endpoint, body)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("x-amz-content-sha256", payloadSum)
+	return req, nil
+}
+
+// do sends a signed request and turns error responses into errors. The
+// bodies of GET and POST responses are left for the caller to read and close.
+func (client *S3Client) do(req *http.Request) (*http.Response, error) {
+	resp, err := client.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		body, _ := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		return nil, fmt.Errorf("%s %s returned %d: %s", req.Method, req.URL.Path, resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+
+	if req.Method != "GET" && req.Method != "POST" {
+		resp.Body.Close()
+	}
+	return resp, nil
+}
+
+// sign adds an AWS signature version 4 authorization header to req.
+func (client *S3Client) sign(req *http.Request, payloadSum string) {
+	region := client.config.Region
+	if region == "" {
+		region = defaultRegion
+	}
+	signV4(req, payloadSum, client.config.AccessKey, client.config.SecretKey, region, time.Now().UTC())
+}
+
+// signV4 signs req for the s3 service at now. Every header set on req is
+// signed along with the host.
+func signV4(req *http.Request, payloadSum string, accessKey string, secretKey string, region string, now time.Time) {
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+
+	req.Header.Set("x-amz-date", amzDate)
+
+	signedHeaders := []string{"host"}
+	for name := range req.Header {
+		if name := strings.ToLower(name); name != "authorization" {
+			signedHeaders = append(signedHeaders, name)
+		}
+	}
+	sort.Strings(signedHeaders)
+
+	canonicalHeaders := ""
+	for _, name := range signedHeaders {
+		value := strings.Join(req.Header[http.CanonicalHeaderKey(name)], ",")
+		if name == "host" {
+			value = req.URL.Host
+		}
+		canonicalHeaders += name + ":" + strings.Join(strings.Fields(value), " ") + "\n"
+	}
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		canonicalQuery(req.URL.Query()),
+		canonicalHeaders,
+		strings.Join(signedHeaders, ";"),
+		payloadSum,
+	}, "\n")
+
+	scope := fmt.Sprintf("%s/%s/s3/aws4_request", date, region)
+	requestSum := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := strings.Join([]string{"AWS4-HMAC-SHA256", amzDate, scope, hex.EncodeToString(requestSum[:])}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+secretKey), date)
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		accessKey, scope, strings.Join(signedHeaders, ";"), signature))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// canonicalQuery encodes a query string the way signature version 4 expects
+// it, sorted and with spaces as %20.
+func canonicalQuery(query url.Values) string {
+	keys := make([]string, 0, len(query))
+	for key := range query {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	pairs := make([]string, 0, len(keys))
+	for _, key := range keys {
+		for _, value := range query[key] {
+			pairs = append(pairs, escapeComponent(key)+"="+escapeComponent(value))
+		}
+	}
+	return strings.Join(pairs, "&")
+}
+
+func escapePath(key string) string {
+	segments := strings.Split(key, "/")
+	for i, segment := range segments {
+		segments[i] = escapeComponent(segment)
+	}
+	return strings.Join(segments, "/")
+}
+
+func escapeComponent(value string) string {
+	return strings.Replace(url.QueryEscape(value), "+", "%20", -1)
+}
@@ -0,0 +1,93 @@
+package backup
+
+import (
+	"sort"
+	"time"
+)
+
+// Next decides from the recorded runs whether a backup is due at now and of
+// which kind. The interval is measured from the end of the last completed
+// run, a run that failed after it is retried once the retry interval passed.
+// The schedule only depends on replicated runs, so a new leader neither
+// repeats nor skips the run of its predecessor.
+func (config Config) Next(runs []Run, now time.Time) (string, bool) {
+	sorted := append([]Run(nil), runs...)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].Started.Before(sorted[j].Started)
+	})
+
+	var lastCompleted *Run
+	var lastFull *Run
+	var lastFailed *Run
+	for i := range sorted {
+		run := &sorted[i]
+		switch {
+		case run.Status == RunRunning && !config.Stale(*run, now):
+			return "", false
+		case run.Status == RunCompleted:
+			lastCompleted = run
+			lastFailed = nil
+			if run.Kind == Full {
+				lastFull = run
+			}
+		default:
+			// Failed, or abandoned by a leader that died.
+			lastFailed = run
+		}
+	}
+
+	kind := Incremental
+	if lastFull == nil || (config.FullInterval > 0 && now.Sub(lastFull.Started) >= config.FullInterval) {
+		kind = Full
+	}
+
+	if lastFailed != nil {
+		return kind, now.Sub(lastFailed.ended()) >= config.retryInterval()
+	}
+	if lastCompleted == nil {
+		return kind, true
+	}
+	return kind, now.Sub(lastCompleted.ended()) >= config.interval()
+}
+
+// Stale reports whether a run is still marked running long after it should
+// have finished, which happens when its leader died.
+func (config Config) Stale(run Run, now time.Time) bool {
+	return run.Status == RunRunning && now.Sub(run.Started) >= config.TimeoutOrDefault()
+}
+
+func (config Config) TimeoutOrDefault() time.Duration {
+	if config.Timeout > 0 {
+		return config.Timeout
+	}
+	return defaultTimeout
+}
+
+// retryInterval is the wait after a failed run, never longer than the
+// interval itself.
+func (config Config) retryInterval() time.Duration {
+	retry := config.RetryInterval
+	if retry <= 0 {
+		retry = defaultRetryInterval
+	}
+	if interval := config.interval(); retry > interval {
+		return interval
+	}
+	return retry
+}
+
+// ended is when the run finished, or when it started for runs that never
+// recorded their end.
+func (run Run) ended() time.Time {
+	if run.Finished.IsZero() {
+		return run.Started
+	}
+	return run.Finished
+}
+
+func (config Config) interval() time.Duration {
+	if config.Interval > 0 {
+		return config.Interval
+	}
+	return defaultInterval
+}
@@ -0,0 +1,182 @@
+package backup
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNext(t *testing.T) {
+	now := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+	ago := func(d time.Duration) time.Time { return now.Add(-d) }
+	// run started at started and took took.
+	run := func(kind string, status string, started time.Duration, took time.Duration) Run {
+		return Run{Kind: kind, Status: status, Started: ago(started), Finished: ago(started - took)}
+	}
+
+	config := Config{Interval: time.Hour, FullInterval: 24 * time.Hour, Timeout: 2 * time.Hour}
+
+	tests := []struct {
+		name   string
+		config Config
+		runs   []Run
+		kind   string
+		due    bool
+	}{
+		{
+			name:   "first backup is full",
+			config: config,
+			kind:   Full,
+			due:    true,
+		},
+		{
+			name:   "not due within the interval",
+			config: config,
+			runs:   []Run{run(Full, RunCompleted, 30*time.Minute, 10*time.Minute)},
+			due:    false,
+		},
+		{
+			name:   "incremental after the interval",
+			config: config,
+			runs: []Run{
+				run(Full, RunCompleted, 3*time.Hour, time.Minute),
+				run(Incremental, RunCompleted, 90*time.Minute, time.Minute),
+			},
+			kind: Incremental,
+			due:  true,
+		},
+		{
+			name:   "interval starts when the last run finished",
+			config: config,
+			runs: []Run{
+				run(Full, RunCompleted, 3*time.Hour, time.Minute),
+				run(Incremental, RunCompleted, 90*time.Minute, 40*time.Minute),
+			},
+			due: false,
+		},
+		{
+			name:   "full after the full interval",
+			config: config,
+			runs: []Run{
+				run(Full, RunCompleted, 25*time.Hour, time.Minute),
+				run(Incremental, RunCompleted, 2*time.Hour, time.Minute),
+			},
+			kind: Full,
+			due:  true,
+		},
+		{
+			name:   "failure retried after the retry interval",
+			config: config,
+			runs: []Run{
+				run(Full, RunCompleted, 3*time.Hour, time.Minute),
+				run(Incremental, RunCompleted, 90*time.Minute, time.Minute),
+				run(Incremental, RunFailed, 20*time.Minute, time.Minute),
+			},
+			kind: Incremental,
+			due:  true,
+		},
+		{
+			name:   "failure not retried within the retry interval",
+			config: config,
+			runs: []Run{
+				run(Full, RunCompleted, 3*time.Hour, time.Minute),
+				run(Incremental, RunFailed, 10*time.Minute, time.Minute),
+			},
+			due: false,
+		},
+		{
+			name:   "retry interval is configurable",
+			config: Config{Interval: time.Hour, RetryInterval: 5 * time.Minute},
+			runs: []Run{
+				run(Full, RunCompleted, 3*time.Hour, time.Minute),
+				run(Incremental, RunFailed, 10*time.Minute, time.Minute),
+			},
+			kind: Incremental,
+			due:  true,
+		},
+		{
+			name:   "retry interval never exceeds the interval",
+			config: Config{Interval: 10 * time.Minute, RetryInterval: time.Hour},
+			runs: []Run{
+				run(Full, RunCompleted, 3*time.Hour, time.Minute),
+				run(Incremental, RunFailed, 12*time.Minute, time.Minute),
+			},
+			kind: Incremental,
+			due:  true,
+		},
+		{
+			name:   "full when no full backup completed",
+			config: config,
+			runs:   []Run{run(Full, RunFailed, 2*time.Hour, time.Minute)},
+			kind:   Full,
+			due:    true,
+		},
+		{
+			name:   "nothing while a run is in progress",
+			config: config,
+			runs: []Run{
+				run(Full, RunCompleted, 3*time.Hour, time.Minute),
+				{Kind: Incremental, Status: RunRunning, Started: ago(10 * time.Minute)},
+			},
+			due: false,
+		},
+		{
+			name:   "stale run is retried",
+			config: config,
+			runs: []Run{
+				run(Full, RunCompleted, 5*time.Hour, time.Minute),
+				{Kind: Incremental, Status: RunRunning, Started: ago(3 * time.Hour)},
+			},
+			kind: Incremental,
+			due:  true,
+		},
+		{
+			name:   "order of runs does not matter",
+			config: config,
+			runs: []Run{
+				run(Incremental, RunCompleted, 20*time.Minute, time.Minute),
+				run(Full, RunCompleted, 3*time.Hour, time.Minute),
+			},
+			due: false,
+		},
+		{
+			name: "default interval is a day",
+			runs: []Run{run(Full, RunCompleted, 23*time.Hour, time.Minute)},
+			due:  false,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			kind, due := test.config.Next(test.runs, now)
+			if due != test.due {
+				t.Fatalf("expected due %t, got %t", test.due, due)
+			}
+			if due && kind != test.kind {
+				t.Fatalf("expected a %s backup, got %s", test.kind, kind)
+			}
+		})
+	}
+}
+
+func TestStale(t *testing.T) {
+	now := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+	config := Config{Timeout: time.Hour}
+
+	tests := []struct {
+		name  string
+		run   Run
+		stale bool
+	}{
+		{"running within timeout", Run{Status: RunRunning, Started: now.Add(-30 * time.Minute)}, false},
+		{"running past timeout", Run{Status: RunRunning, Started: now.Add(-time.Hour)}, true},
+		{"completed long ago", Run{Status: RunCompleted, Started: now.Add(-48 * time.Hour)}, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if stale := config.Stale(test.run, now); stale != test.stale {
+				t.Fatalf("expected stale %t, got %t", test.stale, stale)
+			}
+		})
+	}
+}
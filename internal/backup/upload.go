@@ -0,0 +1,217 @@
+package backup
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Uploader mirrors a backup repository to an object store so backups survive
+// the loss of the node that took them.
+type Uploader struct {
+	config S3Config
+	client *S3Client
+}
+
+func NewUploader(config S3Config) *Uploader {
+	return &Uploader{
+		config: config,
+		client: NewS3Client(config),
+	}
+}
+
+// Upload copies the files of the repository that are missing or changed in
+// the store and verifies every uploaded object against its local checksum.
+func (uploader *Uploader) Upload(ctx context.Context, manager *Manager) error {
+	root := manager.RepositoryPath()
+	prefix := uploader.repositoryPrefix(manager)
+
+	remote, err := uploader.objects(ctx, prefix)
+	if err != nil {
+		return err
+	}
+
+	return filepath.Walk(root, func(file string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+
+		relative, err := filepath.Rel(root, file)
+		if err != nil {
+			return err
+		}
+		key := prefix + filepath.ToSlash(relative)
+
+		sha256Sum, md5Sum, err := checksums(file)
+		if err != nil {
+			return err
+		}
+		etag, err := uploader.client.ETag(file, md5Sum)
+		if err != nil {
+			return err
+		}
+
+		if object, ok := remote[key]; ok && object.Size == info.Size() && object.ETag == etag {
+			return nil
+		}
+
+		err = uploader.client.PutObject(ctx, key, file, sha256Sum, md5Sum)
+		if err != nil {
+			return fmt.Errorf("error uploading %s: %s", key, err)
+		}
+
+		uploaded, err := uploader.client.HeadObject(ctx, key)
+		if err != nil {
+			return fmt.Errorf("error verifying %s: %s", key, err)
+		}
+		if uploaded.Size != info.Size() || uploaded.ETag != etag {
+			return fmt.Errorf("checksum mismatch for %s: uploaded %s (%d bytes), local %s (%d bytes)", key, uploaded.ETag, uploaded.Size, etag, info.Size())
+		}
+		return nil
+	})
+}
+
+// Prune removes the backups that were merged or removed from the local
+// repository from the store, then the oldest backups so no more than the
+// configured retention remain. Repository metadata is kept.
+func (uploader *Uploader) Prune(ctx context.Context, manager *Manager, removed []string) error {
+	if uploader.config.Retention <= 0 && len(removed) == 0 {
+		return nil
+	}
+
+	prefix := uploader.repositoryPrefix(manager)
+	remote, err := uploader.objects(ctx, prefix)
+	if err != nil {
+		return err
+	}
+
+	backups := make(map[string][]string)
+	for key := range remote {
+		parts := strings.SplitN(strings.TrimPrefix(key, prefix), "/", 2)
+		// Files at the top of the repository are metadata, not backups.
+		if len(parts) == 2 {
+			backups[parts[0]] = append(backups[parts[0]], key)
+		}
+	}
+
+	gone := make(map[string]bool)
+	for _, name := range removed {
+		gone[name] = true
+	}
+
+	names := make([]string, 0, len(backups))
+	for name := range backups {
+		if !gone[name] {
+			names = append(names, name)
+			continue
+		}
+
+		log.Printf("removing backup %s from the object store, it is gone from the repository", name)
+		err = uploader.deleteObjects(ctx, backups[name])
+		if err != nil {
+			return err
+		}
+	}
+	sort.Strings(names)
+
+	for uploader.config.Retention > 0 && len(names) > uploader.config.Retention {
+		log.Printf("removing backup %s from the object store", names[0])
+		err = uploader.deleteObjects(ctx, backups[names[0]])
+		if err != nil {
+			return err
+		}
+		names = names[1:]
+	}
+	return nil
+}
+
+func (uploader *Uploader) deleteObjects(ctx context.Context, keys []string) error {
+	for _, key := range keys {
+		err := uploader.client.DeleteObject(ctx, key)
+		if err != nil {
+			return fmt.Errorf("error deleting %s: %s", key, err)
+		}
+	}
+	return nil
+}
+
+// Download restores the repository from the store into the archive of
+// manager, verifying each file against the checksum of its object.
+func (uploader *Uploader) Download(ctx context.Context, manager *Manager) error {
+	prefix := uploader.repositoryPrefix(manager)
+	remote, err := uploader.objects(ctx, prefix)
+	if err != nil {
+		return err
+	}
+
+	if len(remote) == 0 {
+		return fmt.Errorf("no backups found under %s", prefix)
+	}
+
+	root := manager.RepositoryPath()
+	for key, object := range remote {
+		file := filepath.Join(root, filepath.FromSlash(strings.TrimPrefix(key, prefix)))
+
+		err = os.MkdirAll(filepath.Dir(file), 0755)
+		if err != nil {
+			return err
+		}
+
+		err = uploader.client.GetObject(ctx, key, file)
+		if err != nil {
+			return fmt.Errorf("error downloading %s: %s", key, err)
+		}
+
+		_, md5Sum, err := checksums(file)
+		if err != nil {
+			return err
+		}
+		// Objects uploaded in several parts have no md5 etag to check.
+		if !strings.Contains(object.ETag, "-") && hex.EncodeToString(md5Sum) != object.ETag {
+			return fmt.Errorf("checksum mismatch for %s", key)
+		}
+	}
+	return nil
+}
+
+func (uploader *Uploader) objects(ctx context.Context, prefix string) (map[string]Object, error) {
+	objects, err := uploader.client.ListObjects(ctx, prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	byKey := make(map[string]Object)
+	for _, object := range objects {
+		byKey[object.Key] = object
+	}
+	return byKey, nil
+}
+
+func (uploader *Uploader) repositoryPrefix(manager *Manager) string {
+	return path.Join(uploader.config.Prefix, manager.config.repository()) + "/"
+}
+
+func checksums(file string) (string, []byte, error) {
+	reader, err := os.Open(file)
+	if err != nil {
+		return "", nil, err
+	}
+	defer reader.Close()
+
+	sha256Hash := sha256.New()
+	md5Hash := md5.New()
+	_, err = io.Copy(io.MultiWriter(sha256Hash, md5Hash), reader)
+	if err != nil {
+		return "", nil, err
+	}
+	return hex.EncodeToString(sha256Hash.Sum(nil)), md5Hash.Sum(nil), nil
+}
@@ -0,0 +1,220 @@
+package backup
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+type fakeObject struct {
+	data []byte
+	etag string
+}
+
+// fakeStore is an object store keeping a single bucket in memory, it checks
+// Content-MD5 and assembles multipart uploads like S3 does.
+type fakeStore struct {
+	mutex   sync.Mutex
+	objects map[string]fakeObject
+	parts   map[string][]byte
+	puts    int
+}
+
+func newFakeStore() *fakeStore {
+	return &fakeStore{objects: make(map[string]fakeObject), parts: make(map[string][]byte)}
+}
+
+func (store *fakeStore) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	key := strings.TrimPrefix(r.URL.Path, "/backups/")
+	query := r.URL.Query()
+	body, _ := ioutil.ReadAll(r.Body)
+
+	switch {
+	case r.Method == "GET" && query.Get("list-type") == "2":
+		result := struct {
+			XMLName  xml.Name `xml:"ListBucketResult"`
+			Contents []struct {
+				Key  string
+				Size int
+				ETag string
+			}
+		}{}
+		for name, object := range store.objects {
+			if strings.HasPrefix(name, query.Get("prefix")) {
+				result.Contents = append(result.Contents, struct {
+					Key  string
+					Size int
+					ETag string
+				}{name, len(object.data), `"` + object.etag + `"`})
+			}
+		}
+		xml.NewEncoder(w).Encode(result)
+	case r.Method == "HEAD":
+		object, ok := store.objects[key]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Length", strconv.Itoa(len(object.data)))
+		w.Header().Set("ETag", `"`+object.etag+`"`)
+	case r.Method == "PUT":
+		sum := md5.Sum(body)
+		if r.Header.Get("Content-MD5") != base64.StdEncoding.EncodeToString(sum[:]) {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		store.puts++
+		if number := query.Get("partNumber"); number != "" {
+			store.parts[number] = body
+		} else {
+			store.objects[key] = fakeObject{data: body, etag: hex.EncodeToString(sum[:])}
+		}
+		w.Header().Set("ETag", `"`+hex.EncodeToString(sum[:])+`"`)
+	case r.Method == "POST" && query.Get("uploadId") == "" && query["uploads"] != nil:
+		store.parts = make(map[string][]byte)
+		w.Write([]byte(`<InitiateMultipartUploadResult><UploadId>upload-1</UploadId></InitiateMultipartUploadResult>`))
+	case r.Method == "POST" && query.Get("uploadId") == "upload-1":
+		upload := completeMultipartUpload{}
+		xml.Unmarshal(body, &upload)
+
+		data := make([]byte, 0)
+		sums := md5.New()
+		for _, part := range upload.Parts {
+			partData := store.parts[strconv.Itoa(part.PartNumber)]
+			sum := md5.Sum(partData)
+			if part.ETag != `"`+hex.EncodeToString(sum[:])+`"` {
+				w.Write([]byte(`<Error><Code>InvalidPart</Code></Error>`))
+				return
+			}
+			data = append(data, partData...)
+			sums.Write(sum[:])
+		}
+		store.objects[key] = fakeObject{data: data, etag: fmt.Sprintf("%s-%d", hex.EncodeToString(sums.Sum(nil)), len(upload.Parts))}
+	case r.Method == "DELETE":
+		delete(store.objects, key)
+	}
+}
+
+func (store *fakeStore) keys() []string {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	keys := make([]string, 0, len(store.objects))
+	for key := range store.objects {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// testUploader returns an uploader for a fake store splitting files in parts
+// of 10 bytes, and a function stopping the store.
+func testUploader(store *fakeStore, retention int) (*Uploader, func()) {
+	server := httptest.NewServer(store)
+	uploader := NewUploader(S3Config{Endpoint: server.URL, Bucket: "backups", Retention: retention})
+	uploader.client.partSize = 10
+	return uploader, server.Close
+}
+
+func TestUploadInParts(t *testing.T) {
+	dir, err := ioutil.TempDir("", "upload")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	manager := NewManager(Config{Archive: dir}, "", "", "")
+	files := map[string]string{
+		"backup-meta.json":     "{}",
+		"b1/data/shard.sqlite": strings.Repeat("0123456789", 2) + "01234",
+	}
+	for name, content := range files {
+		file := filepath.Join(manager.RepositoryPath(), filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(file, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	store := newFakeStore()
+	uploader, stop := testUploader(store, 0)
+	defer stop()
+
+	err = uploader.Upload(context.Background(), manager)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, content := range files {
+		object := store.objects["scout/"+name]
+		if !bytes.Equal(object.data, []byte(content)) {
+			t.Fatalf("expected %s to hold %q, got %q", name, content, object.data)
+		}
+	}
+	if etag := store.objects["scout/b1/data/shard.sqlite"].etag; !strings.HasSuffix(etag, "-3") {
+		t.Fatalf("expected the data file to be uploaded in 3 parts, got etag %s", etag)
+	}
+
+	// Unchanged files are recognized by their etag and not uploaded again.
+	puts := store.puts
+	err = uploader.Upload(context.Background(), manager)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if store.puts != puts {
+		t.Fatalf("expected no uploads for unchanged files, got %d", store.puts-puts)
+	}
+}
+
+func TestPrune(t *testing.T) {
+	tests := []struct {
+		name      string
+		retention int
+		removed   []string
+		want      []string
+	}{
+		{"retention", 2, nil, []string{"scout/b3/data", "scout/b4/data", "scout/backup-meta.json"}},
+		{"merged backups", 0, []string{"b1", "b2"}, []string{"scout/b3/data", "scout/b4/data", "scout/backup-meta.json"}},
+		{"merged backups and retention", 2, []string{"b2"}, []string{"scout/b3/data", "scout/b4/data", "scout/backup-meta.json"}},
+		{"nothing to prune", 0, nil, []string{"scout/b1/data", "scout/b2/data", "scout/b3/data", "scout/b4/data", "scout/backup-meta.json"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			store := newFakeStore()
+			for _, key := range []string{"scout/backup-meta.json", "scout/b1/data", "scout/b2/data", "scout/b3/data", "scout/b4/data"} {
+				store.objects[key] = fakeObject{}
+			}
+			uploader, stop := testUploader(store, test.retention)
+			defer stop()
+
+			err := uploader.Prune(context.Background(), NewManager(Config{}, "", "", ""), test.removed)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if keys := store.keys(); !reflect.DeepEqual(keys, test.want) {
+				t.Fatalf("expected %v, got %v", test.want, keys)
+			}
+		})
+	}
+}
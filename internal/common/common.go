@@ -1,7 +1,14 @@
 package common
 
 import (
+	"bytes"
+	"fmt"
+	"io"
 	"io/ioutil"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
 
 	yaml "gopkg.in/yaml.v3"
 )
@@ -10,6 +17,59 @@ type configuration struct {
 	name string
 }
 
+// Problem is something wrong with a config. Path is the YAML path of the
+// offending value, such as discovery[0].mode, Line its line in the file or
+// 0 when the value is not in the file.
+type Problem struct {
+	Path    string
+	Line    int
+	Message string
+}
+
+// ConfigError lists every problem found in a config file.
+type ConfigError struct {
+	File     string
+	Problems []Problem
+}
+
+// Defaulter is implemented by configs that fill in defaults for the values
+// missing from the file, present reports whether the file sets the value at
+// a YAML path, so that an explicit zero is not mistaken for a missing value.
+type Defaulter interface {
+	SetDefaults(present func(path string) bool)
+}
+
+// Validator is implemented by configs that check their values, Line is
+// filled in by ParseYml.
+type Validator interface {
+	Validate() []Problem
+}
+
+var unknownField = regexp.MustCompile(`^line (\d+): field (\S+) not found in type \S+$`)
+var lineError = regexp.MustCompile(`^line (\d+): (.*)$`)
+
+func (problem Problem) String() string {
+	message := problem.Message
+	if problem.Path != "" {
+		message = problem.Path + ": " + message
+	}
+	if problem.Line > 0 {
+		return fmt.Sprintf("line %d: %s", problem.Line, message)
+	}
+	return message
+}
+
+func (err *ConfigError) Error() string {
+	lines := make([]string, 0, len(err.Problems))
+	for _, problem := range err.Problems {
+		lines = append(lines, "  "+problem.String())
+	}
+	return fmt.Sprintf("%s has %d problems:\n%s", err.File, len(err.Problems), strings.Join(lines, "\n"))
+}
+
+// ParseYml decodes filename into config, rejecting keys config has no field
+// for. Configs implementing Defaulter and Validator get their defaults filled
+// in and are validated, every problem found is returned in a *ConfigError.
 func ParseYml(filename string, config interface{}) error {
 	source, err := ioutil.ReadFile(filename)
 
@@ -17,10 +77,159 @@ func ParseYml(filename string, config interface{}) error {
 		return err
 	}
 
-	err = yaml.Unmarshal(source, config)
-	if err != nil {
+	problems := make([]Problem, 0)
+	root := yaml.Node{}
+	yaml.Unmarshal(source, &root)
+
+	decoder := yaml.NewDecoder(bytes.NewReader(source))
+	decoder.KnownFields(true)
+	err = decoder.Decode(config)
+	if typeErr, ok := err.(*yaml.TypeError); ok {
+		problems = append(problems, decodeProblems(&root, typeErr)...)
+	} else if err != nil && err != io.EOF {
 		return err
 	}
 
-	return nil
+	if defaulter, ok := config.(Defaulter); ok {
+		defaulter.SetDefaults(func(path string) bool {
+			value, _ := find(&root, path)
+			return value != nil
+		})
+	}
+
+	if validator, ok := config.(Validator); ok {
+		for _, problem := range validator.Validate() {
+			problem.Line = lineOf(&root, problem.Path)
+			problems = append(problems, problem)
+		}
+	}
+
+	if len(problems) == 0 {
+		return nil
+	}
+
+	sort.SliceStable(problems, func(i, j int) bool {
+		return problems[i].Line < problems[j].Line
+	})
+	return &ConfigError{File: filename, Problems: problems}
+}
+
+// decodeProblems turns the errors of the decoder into problems, their paths
+// are looked up in root by the line the decoder reports.
+func decodeProblems(root *yaml.Node, err *yaml.TypeError) []Problem {
+	problems := make([]Problem, 0, len(err.Errors))
+	for _, message := range err.Errors {
+		if match := unknownField.FindStringSubmatch(message); match != nil {
+			line, _ := strconv.Atoi(match[1])
+			path := pathOf(root, line, match[2])
+			if path == "" {
+				path = match[2]
+			}
+			problems = append(problems, Problem{Path: path, Line: line, Message: "unknown key"})
+			continue
+		}
+
+		if match := lineError.FindStringSubmatch(message); match != nil {
+			line, _ := strconv.Atoi(match[1])
+			problems = append(problems, Problem{Path: pathOf(root, line, ""), Line: line, Message: match[2]})
+			continue
+		}
+
+		problems = append(problems, Problem{Message: message})
+	}
+	return problems
+}
+
+// lineOf returns the line of the value at path, or of its closest parent
+// in the file when the value itself is missing.
+func lineOf(root *yaml.Node, path string) int {
+	_, line := find(root, path)
+	return line
+}
+
+// find returns the value at path, nil when the file does not set it, and the
+// line of the value or of its closest parent.
+func find(root *yaml.Node, path string) (*yaml.Node, int) {
+	node := root
+	if node.Kind == yaml.DocumentNode && len(node.Content) > 0 {
+		node = node.Content[0]
+	}
+
+	line := 0
+	for _, segment := range strings.Split(path, ".") {
+		key, index := segment, -1
+		if open := strings.Index(segment, "["); open >= 0 && strings.HasSuffix(segment, "]") {
+			key = segment[:open]
+			index, _ = strconv.Atoi(segment[open+1 : len(segment)-1])
+		}
+
+		if node.Kind != yaml.MappingNode {
+			return nil, line
+		}
+
+		var value *yaml.Node
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			if node.Content[i].Value == key {
+				line = node.Content[i].Line
+				value = node.Content[i+1]
+				break
+			}
+		}
+		if value == nil {
+			return nil, line
+		}
+		node = value
+
+		if index >= 0 {
+			if node.Kind != yaml.SequenceNode || index >= len(node.Content) {
+				return nil, line
+			}
+			node = node.Content[index]
+			line = node.Line
+		}
+	}
+	return node, line
+}
+
+// pathOf returns the path of the key named key on line, or of the first
+// scalar value on line when key is empty. It is empty when there is none.
+func pathOf(root *yaml.Node, line int, key string) string {
+	var walk func(node *yaml.Node, path string) string
+	walk = func(node *yaml.Node, path string) string {
+		switch node.Kind {
+		case yaml.DocumentNode:
+			for _, child := range node.Content {
+				if found := walk(child, path); found != "" {
+					return found
+				}
+			}
+		case yaml.MappingNode:
+			for i := 0; i+1 < len(node.Content); i += 2 {
+				name, value := node.Content[i], node.Content[i+1]
+				child := name.Value
+				if path != "" {
+					child = path + "." + name.Value
+				}
+
+				if name.Line == line && (name.Value == key || key == "" && value.Kind == yaml.ScalarNode) {
+					return child
+				}
+				if found := walk(value, child); found != "" {
+					return found
+				}
+			}
+		case yaml.SequenceNode:
+			for i, item := range node.Content {
+				child := fmt.Sprintf("%s[%d]", path, i)
+				if key == "" && item.Line == line && item.Kind == yaml.ScalarNode {
+					return child
+				}
+				if found := walk(item, child); found != "" {
+					return found
+				}
+			}
+		}
+		return ""
+	}
+	return walk(root, "")
 }
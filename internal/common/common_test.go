@@ -0,0 +1,147 @@
+package common
+
+import (
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+)
+
+type testItem struct {
+	Name string `yaml:"name"`
+	Size int    `yaml:"size"`
+}
+
+type testConfig struct {
+	Name  string     `yaml:"name"`
+	Port  int        `yaml:"port"`
+	Items []testItem `yaml:"items"`
+
+	present map[string]bool
+}
+
+func (config *testConfig) SetDefaults(present func(path string) bool) {
+	config.present = map[string]bool{
+		"port":          present("port"),
+		"items[0].size": present("items[0].size"),
+	}
+}
+
+func (config *testConfig) Validate() []Problem {
+	problems := make([]Problem, 0)
+	if config.Name == "" {
+		problems = append(problems, Problem{Path: "name", Message: "the name is required"})
+	}
+	for _, item := range config.Items {
+		if item.Size < 0 {
+			problems = append(problems, Problem{Path: "items[1].size", Message: "the size is negative"})
+		}
+	}
+	return problems
+}
+
+func writeConfig(t *testing.T, source string) string {
+	file, err := ioutil.TempFile("", "config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	if _, err = file.WriteString(source); err != nil {
+		t.Fatal(err)
+	}
+	return file.Name()
+}
+
+func TestParseYml(t *testing.T) {
+	tests := []struct {
+		name     string
+		source   string
+		problems []Problem
+	}{
+		{
+			name:   "valid",
+			source: "name: scout\nport: 8091\n",
+		},
+		{
+			name:     "unknown top level key",
+			source:   "name: scout\nzone: a\n",
+			problems: []Problem{{Path: "zone", Line: 2, Message: "unknown key"}},
+		},
+		{
+			name:     "unknown nested key",
+			source:   "name: scout\nitems:\n  - name: a\n    zone: b\n",
+			problems: []Problem{{Path: "items[0].zone", Line: 4, Message: "unknown key"}},
+		},
+		{
+			name:     "type error",
+			source:   "name: scout\nitems:\n  - name: a\n    size: large\n",
+			problems: []Problem{{Path: "items[0].size", Line: 4, Message: "cannot unmarshal !!str `large` into int"}},
+		},
+		{
+			name:   "validation problems sorted by line",
+			source: "port: 8091\nitems:\n  - name: a\n  - name: b\n    size: -1\n",
+			problems: []Problem{
+				{Path: "name", Line: 0, Message: "the name is required"},
+				{Path: "items[1].size", Line: 5, Message: "the size is negative"},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			file := writeConfig(t, test.source)
+			defer os.Remove(file)
+
+			err := ParseYml(file, &testConfig{})
+			if len(test.problems) == 0 {
+				if err != nil {
+					t.Fatalf("expected no error, got %s", err)
+				}
+				return
+			}
+
+			configErr, ok := err.(*ConfigError)
+			if !ok {
+				t.Fatalf("expected a config error, got %v", err)
+			}
+			if !reflect.DeepEqual(configErr.Problems, test.problems) {
+				t.Fatalf("expected %+v, got %+v", test.problems, configErr.Problems)
+			}
+		})
+	}
+}
+
+func TestParseYmlPresent(t *testing.T) {
+	tests := []struct {
+		name   string
+		source string
+		want   map[string]bool
+	}{
+		{
+			name:   "missing",
+			source: "name: scout\nitems:\n  - name: a\n",
+			want:   map[string]bool{"port": false, "items[0].size": false},
+		},
+		{
+			name:   "explicit zero",
+			source: "name: scout\nport: 0\nitems:\n  - name: a\n    size: 0\n",
+			want:   map[string]bool{"port": true, "items[0].size": true},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			file := writeConfig(t, test.source)
+			defer os.Remove(file)
+
+			config := &testConfig{}
+			if err := ParseYml(file, config); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(config.present, test.want) {
+				t.Fatalf("expected %v, got %v", test.want, config.present)
+			}
+		})
+	}
+}
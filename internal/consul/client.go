@@ -40,7 +40,7 @@ func (client *ConsulClient) RegisterHost() error {
 	registration.Address = client.clientAddr
 	registration.Port = 8600
 	registration.Check = new(consulapi.AgentServiceCheck)
-	registration.Check.HTTP = fmt.Sprintf("http://%s:%v/health", client.clientAddr, 8600)
+	registration.Check.HTTP = fmt.Sprintf("http://%s:%v/health/ready", client.clientAddr, 8600)
 	registration.Check.Interval = "5s"
 	registration.Check.Timeout = "3s"
 	client.consulClient.Agent().ServiceRegister(registration)
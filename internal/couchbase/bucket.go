@@ -0,0 +1,332 @@
+package couchbase
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strconv"
+
+	"github.com/devgenie/scout/internal/common"
+)
+
+// Bounds and default of the reader and writer threads of a bucket.
+const (
+	MinBucketThreads     = 2
+	MaxBucketThreads     = 8
+	DefaultBucketThreads = 3
+)
+
+// evictionPolicies lists the eviction policies each bucket type accepts, the
+// first one is the default. Memcached buckets have none.
+var evictionPolicies = map[string][]string{
+	"couchbase": {"valueOnly", "fullEviction"},
+	"ephemeral": {"noEviction", "nruEviction"},
+}
+
+// BucketConfig declares a bucket in config.yml, RAMQuotaMB is the quota per
+// node.
+type BucketConfig struct {
+	Name            string `yaml:"name" json:"name"`
+	BucketType      string `yaml:"type" json:"type"`
+	RAMQuotaMB      int    `yaml:"ramquotamb" json:"ramQuotaMB"`
+	ReplicaNumber   int    `yaml:"replicas" json:"replicas"`
+	ReplicaIndex    bool   `yaml:"replicaindex" json:"replicaIndex"`
+	EvictionPolicy  string `yaml:"evictionpolicy" json:"evictionPolicy,omitempty"`
+	FlushEnabled    bool   `yaml:"flushenabled" json:"flushEnabled"`
+	ThreadsNumber   int    `yaml:"threads" json:"threads,omitempty"`
+	CompressionMode string `yaml:"compressionmode" json:"compressionMode,omitempty"`
+}
+
+// SetDefaults fills in the type, eviction policy and threads left out of a
+// declared bucket, memcached buckets have neither eviction nor threads.
+func (bucket *BucketConfig) SetDefaults() {
+	if bucket.BucketType == "" {
+		bucket.BucketType = "couchbase"
+	}
+
+	policies, ok := evictionPolicies[bucket.BucketType]
+	if !ok {
+		return
+	}
+	if bucket.EvictionPolicy == "" {
+		bucket.EvictionPolicy = policies[0]
+	}
+	if bucket.ThreadsNumber == 0 {
+		bucket.ThreadsNumber = DefaultBucketThreads
+	}
+}
+
+// BucketNotEmptyError is returned when deleting a bucket that still holds
+// documents without forcing it.
+type BucketNotEmptyError struct {
+	Name  string
+	Items int64
+}
+
+func (err *BucketNotEmptyError) Error() string {
+	return fmt.Sprintf("bucket %s holds %d items, refusing to delete it", err.Name, err.Items)
+}
+
+type bucketInfo struct {
+	Name            string `json:"name"`
+	BucketType      string `json:"bucketType"`
+	ReplicaNumber   int    `json:"replicaNumber"`
+	ReplicaIndex    bool   `json:"replicaIndex"`
+	EvictionPolicy  string `json:"evictionPolicy"`
+	ThreadsNumber   int    `json:"threadsNumber"`
+	CompressionMode string `json:"compressionMode"`
+	Quota           struct {
+		RawRAM int64 `json:"rawRAM"`
+	} `json:"quota"`
+	Controllers struct {
+		Flush string `json:"flush"`
+	} `json:"controllers"`
+	BasicStats BucketStats `json:"basicStats"`
+}
+
+// BucketStats are the basic stats couchbase reports with every bucket.
+type BucketStats struct {
+	Name             string  `json:"name"`
+	QuotaPercentUsed float64 `json:"quotaPercentUsed"`
+	OpsPerSec        float64 `json:"opsPerSec"`
+	DiskFetches      float64 `json:"diskFetches"`
+	ItemCount        int64   `json:"itemCount"`
+	DiskUsed         int64   `json:"diskUsed"`
+	DataUsed         int64   `json:"dataUsed"`
+	MemUsed          int64   `json:"memUsed"`
+}
+
+func (node *CouchbaseNode) AddBucket(ctx context.Context, bucket BucketConfig) error {
+	requestBody := bucket.form()
+	requestBody.Set("bucketType", bucket.BucketType)
+	requestBody.Set("name", bucket.Name)
+	if bucket.BucketType == "couchbase" {
+		requestBody.Set("replicaIndex", boolFlag(bucket.ReplicaIndex))
+	}
+	if bucket.ThreadsNumber > 0 && bucket.BucketType != "memcached" {
+		requestBody.Set("threadsNumber", strconv.Itoa(bucket.ThreadsNumber))
+	}
+
+	err := node.client().Post(ctx, "/pools/default/buckets", requestBody, nil)
+	if err != nil {
+		return fmt.Errorf("error creating bucket %s : %s", bucket.Name, err)
+	}
+	return nil
+}
+
+// UpdateBucket changes the settings of an existing bucket that couchbase
+// allows to be edited in place.
+func (node *CouchbaseNode) UpdateBucket(ctx context.Context, bucket BucketConfig) error {
+	err := node.client().Do(ctx, Request{Method: "POST", Path: bucketPath(bucket.Name), Form: bucket.form(), Idempotent: true}, nil)
+	if err != nil {
+		return fmt.Errorf("error updating bucket %s : %s", bucket.Name, err)
+	}
+	return nil
+}
+
+// form holds the settings shared by creating and editing a bucket. Settings
+// left unset are omitted so couchbase applies its own defaults, and settings
+// memcached buckets do not have are never sent for them.
+func (bucket BucketConfig) form() url.Values {
+	requestBody := url.Values{}
+	requestBody.Set("ramQuotaMB", strconv.Itoa(bucket.RAMQuotaMB))
+	requestBody.Set("flushEnabled", boolFlag(bucket.FlushEnabled))
+	if bucket.BucketType == "memcached" {
+		return requestBody
+	}
+
+	requestBody.Set("replicaNumber", strconv.Itoa(bucket.ReplicaNumber))
+	if bucket.EvictionPolicy != "" {
+		requestBody.Set("evictionPolicy", bucket.EvictionPolicy)
+	}
+	if bucket.CompressionMode != "" {
+		requestBody.Set("compressionMode", bucket.CompressionMode)
+	}
+	return requestBody
+}
+
+// Problems lists every problem with the settings of the bucket, path is its
+// YAML path.
+func (bucket BucketConfig) Problems(path string) []common.Problem {
+	problems := make([]common.Problem, 0)
+	problem := func(field string, format string, args ...interface{}) {
+		problems = append(problems, common.Problem{Path: path + "." + field, Message: fmt.Sprintf(format, args...)})
+	}
+
+	if bucket.Name == "" {
+		problem("name", "bucket has no name")
+	}
+	if bucket.RAMQuotaMB <= 0 {
+		problem("ramquotamb", "bucket %s needs a RAM quota", bucket.Name)
+	}
+
+	policies, ok := evictionPolicies[bucket.BucketType]
+	switch {
+	case bucket.BucketType == "memcached":
+		if bucket.EvictionPolicy != "" {
+			problem("evictionpolicy", "memcached bucket %s has no eviction policy", bucket.Name)
+		}
+		if bucket.ThreadsNumber != 0 {
+			problem("threads", "memcached bucket %s has no threads setting", bucket.Name)
+		}
+		if bucket.ReplicaNumber != 0 || bucket.ReplicaIndex {
+			problem("replicas", "memcached bucket %s has no replicas", bucket.Name)
+		}
+		return problems
+	case !ok:
+		problem("type", "unknown bucket type %q", bucket.BucketType)
+		return problems
+	}
+
+	if bucket.EvictionPolicy != "" && !contains(policies, bucket.EvictionPolicy) {
+		problem("evictionpolicy", "unknown eviction policy %q for a %s bucket, use one of %v", bucket.EvictionPolicy, bucket.BucketType, policies)
+	}
+	if bucket.ThreadsNumber != 0 && (bucket.ThreadsNumber < MinBucketThreads || bucket.ThreadsNumber > MaxBucketThreads) {
+		problem("threads", "bucket %s has %d threads, it needs between %d and %d", bucket.Name, bucket.ThreadsNumber, MinBucketThreads, MaxBucketThreads)
+	}
+	if bucket.ReplicaIndex && bucket.BucketType != "couchbase" {
+		problem("replicaindex", "only couchbase buckets replicate indexes")
+	}
+	if bucket.ReplicaNumber < 0 || bucket.ReplicaNumber > 3 {
+		problem("replicas", "bucket %s has %d replicas, it can have between 0 and 3", bucket.Name, bucket.ReplicaNumber)
+	}
+	return problems
+}
+
+// FlushBucket removes every document from a bucket, flush has to be enabled
+// on the bucket.
+func (node *CouchbaseNode) FlushBucket(ctx context.Context, name string) error {
+	err := node.client().Post(ctx, bucketPath(name)+"/controller/doFlush", nil, nil)
+	if err != nil {
+		return fmt.Errorf("error flushing bucket %s : %s", name, err)
+	}
+	return nil
+}
+
+// DeleteBucket drops a bucket. Unless force is set a bucket that still holds
+// documents is kept and a *BucketNotEmptyError returned.
+func (node *CouchbaseNode) DeleteBucket(ctx context.Context, name string, force bool) error {
+	client := node.client()
+
+	if !force {
+		info := bucketInfo{}
+		err := client.Get(ctx, bucketPath(name), &info)
+		if err != nil {
+			return fmt.Errorf("error inspecting bucket %s : %s", name, err)
+		}
+
+		if info.BasicStats.ItemCount > 0 {
+			return &BucketNotEmptyError{Name: name, Items: info.BasicStats.ItemCount}
+		}
+	}
+
+	err := client.Delete(ctx, bucketPath(name))
+	if err != nil {
+		if IsNotFound(err) {
+			return err
+		}
+		return fmt.Errorf("error deleting bucket %s : %s", name, err)
+	}
+	return nil
+}
+
+// Buckets lists the buckets that exist in the cluster.
+func (node *CouchbaseNode) Buckets(ctx context.Context) ([]BucketConfig, error) {
+	infos := make([]bucketInfo, 0)
+	err := node.client().Get(ctx, "/pools/default/buckets", &infos)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching buckets : %s", err)
+	}
+
+	buckets := make([]BucketConfig, 0, len(infos))
+	for _, info := range infos {
+		buckets = append(buckets, info.config())
+	}
+	return buckets, nil
+}
+
+// Bucket returns the settings of a single bucket, a missing bucket is
+// reported with an error satisfying IsNotFound.
+func (node *CouchbaseNode) Bucket(ctx context.Context, name string) (BucketConfig, error) {
+	info := bucketInfo{}
+	err := node.client().Get(ctx, bucketPath(name), &info)
+	if err != nil {
+		if IsNotFound(err) {
+			return BucketConfig{}, err
+		}
+		return BucketConfig{}, fmt.Errorf("error fetching bucket %s : %s", name, err)
+	}
+	return info.config(), nil
+}
+
+// BucketStats lists the basic stats of every bucket in the cluster.
+func (node *CouchbaseNode) BucketStats(ctx context.Context) ([]BucketStats, error) {
+	infos := make([]bucketInfo, 0)
+	err := node.client().Get(ctx, "/pools/default/buckets", &infos)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching buckets : %s", err)
+	}
+
+	stats := make([]BucketStats, 0, len(infos))
+	for _, info := range infos {
+		info.BasicStats.Name = info.Name
+		stats = append(stats, info.BasicStats)
+	}
+	return stats, nil
+}
+
+// Drifted reports whether the editable settings of bucket differ from the
+// declared ones.
+func (bucket BucketConfig) Drifted(declared BucketConfig) bool {
+	if declared.EvictionPolicy != "" && bucket.EvictionPolicy != declared.EvictionPolicy {
+		return true
+	}
+
+	if declared.CompressionMode != "" && bucket.CompressionMode != declared.CompressionMode {
+		return true
+	}
+
+	return bucket.RAMQuotaMB != declared.RAMQuotaMB ||
+		bucket.ReplicaNumber != declared.ReplicaNumber ||
+		bucket.FlushEnabled != declared.FlushEnabled
+}
+
+func (info bucketInfo) config() BucketConfig {
+	bucketType := info.BucketType
+	// The REST API reports couchbase buckets by their historic name.
+	if bucketType == "membase" {
+		bucketType = "couchbase"
+	}
+
+	return BucketConfig{
+		Name:            info.Name,
+		BucketType:      bucketType,
+		RAMQuotaMB:      int(info.Quota.RawRAM / 1024 / 1024),
+		ReplicaNumber:   info.ReplicaNumber,
+		ReplicaIndex:    info.ReplicaIndex,
+		EvictionPolicy:  info.EvictionPolicy,
+		FlushEnabled:    info.Controllers.Flush != "",
+		ThreadsNumber:   info.ThreadsNumber,
+		CompressionMode: info.CompressionMode,
+	}
+}
+
+func contains(values []string, value string) bool {
+	for _, candidate := range values {
+		if candidate == value {
+			return true
+		}
+	}
+	return false
+}
+
+func bucketPath(name string) string {
+	return "/pools/default/buckets/" + url.PathEscape(name)
+}
+
+func boolFlag(value bool) string {
+	if value {
+		return "1"
+	}
+	return "0"
+}
@@ -0,0 +1,122 @@
+package couchbase
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+// testNode returns a node talking to a test server running handler, and a
+// function stopping the server.
+func testNode(t *testing.T, handler http.HandlerFunc) (*CouchbaseNode, func()) {
+	t.Helper()
+	server := httptest.NewServer(handler)
+
+	host, port, err := net.SplitHostPort(server.Listener.Addr().String())
+	if err != nil {
+		server.Close()
+		t.Fatal(err)
+	}
+	number, _ := strconv.Atoi(port)
+	return NewCouchbaseNode(host, number), server.Close
+}
+
+func TestAddBucketForm(t *testing.T) {
+	tests := []struct {
+		name   string
+		bucket BucketConfig
+		want   url.Values
+	}{
+		{
+			name:   "unset settings are omitted",
+			bucket: BucketConfig{Name: "a", BucketType: "couchbase", RAMQuotaMB: 256, ReplicaNumber: 1},
+			want: url.Values{
+				"name": {"a"}, "bucketType": {"couchbase"}, "ramQuotaMB": {"256"}, "flushEnabled": {"0"},
+				"replicaNumber": {"1"}, "replicaIndex": {"0"},
+			},
+		},
+		{
+			name: "set settings are sent",
+			bucket: BucketConfig{Name: "a", BucketType: "couchbase", RAMQuotaMB: 256, ReplicaIndex: true, FlushEnabled: true,
+				EvictionPolicy: "fullEviction", ThreadsNumber: 8, CompressionMode: "active"},
+			want: url.Values{
+				"name": {"a"}, "bucketType": {"couchbase"}, "ramQuotaMB": {"256"}, "flushEnabled": {"1"},
+				"replicaNumber": {"0"}, "replicaIndex": {"1"}, "evictionPolicy": {"fullEviction"},
+				"threadsNumber": {"8"}, "compressionMode": {"active"},
+			},
+		},
+		{
+			name:   "ephemeral buckets have no replica index",
+			bucket: BucketConfig{Name: "e", BucketType: "ephemeral", RAMQuotaMB: 100, EvictionPolicy: "nruEviction"},
+			want: url.Values{
+				"name": {"e"}, "bucketType": {"ephemeral"}, "ramQuotaMB": {"100"}, "flushEnabled": {"0"},
+				"replicaNumber": {"0"}, "evictionPolicy": {"nruEviction"},
+			},
+		},
+		{
+			name:   "memcached buckets only get their quota",
+			bucket: BucketConfig{Name: "m", BucketType: "memcached", RAMQuotaMB: 100, ThreadsNumber: 3, EvictionPolicy: "valueOnly"},
+			want: url.Values{
+				"name": {"m"}, "bucketType": {"memcached"}, "ramQuotaMB": {"100"}, "flushEnabled": {"0"},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var got url.Values
+			node, stop := testNode(t, func(w http.ResponseWriter, r *http.Request) {
+				r.ParseForm()
+				got = r.PostForm
+				w.WriteHeader(http.StatusAccepted)
+			})
+			defer stop()
+
+			if err := node.AddBucket(context.Background(), test.bucket); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Fatalf("expected form %v, got %v", test.want, got)
+			}
+		})
+	}
+}
+
+func TestBucketProblems(t *testing.T) {
+	tests := []struct {
+		name   string
+		bucket BucketConfig
+		paths  []string
+	}{
+		{"valid couchbase", BucketConfig{Name: "a", BucketType: "couchbase", RAMQuotaMB: 100, EvictionPolicy: "valueOnly", ThreadsNumber: 3}, nil},
+		{"valid ephemeral", BucketConfig{Name: "a", BucketType: "ephemeral", RAMQuotaMB: 100, EvictionPolicy: "noEviction"}, nil},
+		{"valid memcached", BucketConfig{Name: "a", BucketType: "memcached", RAMQuotaMB: 100}, nil},
+		{"missing name and quota", BucketConfig{BucketType: "couchbase"}, []string{"b.name", "b.ramquotamb"}},
+		{"unknown type", BucketConfig{Name: "a", BucketType: "disk", RAMQuotaMB: 100}, []string{"b.type"}},
+		{"eviction of another type", BucketConfig{Name: "a", BucketType: "ephemeral", RAMQuotaMB: 100, EvictionPolicy: "fullEviction"}, []string{"b.evictionpolicy"}},
+		{"too few threads", BucketConfig{Name: "a", BucketType: "couchbase", RAMQuotaMB: 100, ThreadsNumber: 1}, []string{"b.threads"}},
+		{"too many threads", BucketConfig{Name: "a", BucketType: "couchbase", RAMQuotaMB: 100, ThreadsNumber: 9}, []string{"b.threads"}},
+		{"replica index on ephemeral", BucketConfig{Name: "a", BucketType: "ephemeral", RAMQuotaMB: 100, ReplicaIndex: true}, []string{"b.replicaindex"}},
+		{"too many replicas", BucketConfig{Name: "a", BucketType: "couchbase", RAMQuotaMB: 100, ReplicaNumber: 4}, []string{"b.replicas"}},
+		{"memcached settings", BucketConfig{Name: "a", BucketType: "memcached", RAMQuotaMB: 100, EvictionPolicy: "valueOnly", ThreadsNumber: 3, ReplicaNumber: 1},
+			[]string{"b.evictionpolicy", "b.threads", "b.replicas"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			problems := test.bucket.Problems("b")
+			paths := make([]string, 0, len(problems))
+			for _, problem := range problems {
+				paths = append(paths, problem.Path)
+			}
+			if len(paths) != len(test.paths) || (len(paths) > 0 && !reflect.DeepEqual(paths, test.paths)) {
+				t.Fatalf("expected problems at %v, got %v", test.paths, problems)
+			}
+		})
+	}
+}
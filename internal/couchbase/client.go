@@ -0,0 +1,291 @@
+package couchbase
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/devgenie/scout/internal/metrics"
+)
+
+const DefaultPort = 8091
+
+const (
+	defaultRetries = 3
+	defaultBackoff = 500 * time.Millisecond
+)
+
+var httpClient = &http.Client{
+	Timeout: time.Second * 30,
+}
+
+func init() {
+	metrics.Default.Summary("scout_couchbase_request_duration_seconds", "Duration of couchbase REST requests.")
+	metrics.Default.Counter("scout_couchbase_request_errors_total", "Couchbase REST requests that failed, by status code.")
+}
+
+// collections are path segments followed by the name of an item, the names
+// are left out of metric labels to keep their number bounded.
+var collections = map[string]bool{
+	"buckets":        true,
+	"users":          true,
+	"local":          true,
+	"remoteClusters": true,
+	"replications":   true,
+	"groups":         true,
+}
+
+// Client talks to the REST interface of a single couchbase node.
+type Client struct {
+	address string
+	auth    Auth
+	retries int
+	backoff time.Duration
+}
+
+// Request describes a call to the couchbase REST API. GET, HEAD, PUT and
+// DELETE requests are always retried, POST requests only when they are
+// marked as idempotent. When JSON is set it is sent as the body instead of
+// Form.
+type Request struct {
+	Method     string
+	Path       string
+	Form       url.Values
+	JSON       interface{}
+	Idempotent bool
+}
+
+// Error is returned when couchbase answers with a non 2xx status code.
+type Error struct {
+	Method     string
+	Path       string
+	StatusCode int
+	Message    string
+}
+
+func (err *Error) Error() string {
+	return fmt.Sprintf("%s %s returned %d: %s", err.Method, err.Path, err.StatusCode, err.Message)
+}
+
+// IsNotFound reports whether err is a couchbase 404.
+func IsNotFound(err error) bool {
+	requestErr, ok := err.(*Error)
+	return ok && requestErr.StatusCode == http.StatusNotFound
+}
+
+// NewClient creates a client for the node listening on address, which is a
+// host:port pair.
+func NewClient(address string, auth Auth) *Client {
+	return &Client{
+		address: address,
+		auth:    auth,
+		retries: defaultRetries,
+		backoff: defaultBackoff,
+	}
+}
+
+// ForAddress returns a copy of the client talking to another node or port.
+func (client *Client) ForAddress(address string) *Client {
+	copied := *client
+	copied.address = address
+	return &copied
+}
+
+func (client *Client) Address() string {
+	return client.address
+}
+
+func (client *Client) Get(ctx context.Context, path string, out interface{}) error {
+	return client.Do(ctx, Request{Method: "GET", Path: path}, out)
+}
+
+func (client *Client) Post(ctx context.Context, path string, form url.Values, out interface{}) error {
+	return client.Do(ctx, Request{Method: "POST", Path: path, Form: form}, out)
+}
+
+func (client *Client) Put(ctx context.Context, path string, form url.Values, out interface{}) error {
+	return client.Do(ctx, Request{Method: "PUT", Path: path, Form: form}, out)
+}
+
+func (client *Client) Delete(ctx context.Context, path string) error {
+	return client.Do(ctx, Request{Method: "DELETE", Path: path}, nil)
+}
+
+// Do performs the request and decodes a JSON response into out when out is
+// not nil.
+func (client *Client) Do(ctx context.Context, request Request, out interface{}) error {
+	attempts := 1
+	if request.retryable() {
+		attempts += client.retries
+	}
+
+	backoff := client.backoff
+	var err error
+
+	for attempt := 1; attempt <= attempts; attempt++ {
+		var body []byte
+		body, err = client.send(ctx, request)
+		if err == nil {
+			if out == nil || len(body) == 0 {
+				return nil
+			}
+
+			err = json.Unmarshal(body, out)
+			if err != nil {
+				return fmt.Errorf("error decoding response of %s %s: %s", request.Method, request.Path, err)
+			}
+			return nil
+		}
+
+		if !temporary(err) || attempt == attempts {
+			break
+		}
+
+		log.Printf("%s, retrying in %s", err, backoff)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+
+	return err
+}
+
+func (client *Client) send(ctx context.Context, request Request) ([]byte, error) {
+	endpoint := fmt.Sprintf("http://%s%s", client.address, request.Path)
+	contentType := ""
+	body := request.Form.Encode()
+
+	if request.JSON != nil {
+		encoded, err := json.Marshal(request.JSON)
+		if err != nil {
+			return nil, err
+		}
+		body = string(encoded)
+		contentType = "application/json"
+	} else if request.Form != nil {
+		contentType = "application/x-www-form-urlencoded"
+	}
+
+	req, err := http.NewRequest(request.Method, endpoint, strings.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+
+	req.SetBasicAuth(client.auth.Username, client.auth.Password)
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+
+	started := time.Now()
+	resp, err := httpClient.Do(req)
+	labels := metrics.Labels{"method": request.Method, "path": metricPath(request.Path)}
+	metrics.Default.Observe("scout_couchbase_request_duration_seconds", labels, time.Since(started).Seconds())
+	if err != nil {
+		labels["code"] = "transport"
+		metrics.Default.Add("scout_couchbase_request_errors_total", labels, 1)
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	respBody, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("error reading response of %s %s: %s", request.Method, request.Path, err)
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		labels["code"] = strconv.Itoa(resp.StatusCode)
+		metrics.Default.Add("scout_couchbase_request_errors_total", labels, 1)
+		return nil, &Error{
+			Method:     request.Method,
+			Path:       request.Path,
+			StatusCode: resp.StatusCode,
+			Message:    errorMessage(respBody),
+		}
+	}
+
+	return respBody, nil
+}
+
+// metricPath strips the query and item names from a request path.
+func metricPath(path string) string {
+	if index := strings.Index(path, "?"); index >= 0 {
+		path = path[:index]
+	}
+
+	segments := strings.Split(path, "/")
+	for index := 1; index < len(segments); index++ {
+		if collections[segments[index-1]] && !collections[segments[index]] && segments[index] != "" {
+			segments[index] = ":name"
+		}
+	}
+	return strings.Join(segments, "/")
+}
+
+func (request Request) retryable() bool {
+	switch request.Method {
+	case "GET", "HEAD", "PUT", "DELETE":
+		return true
+	}
+	return request.Idempotent
+}
+
+// temporary reports whether a failed request is worth retrying, couchbase
+// rejecting the request itself is not.
+func temporary(err error) bool {
+	requestErr, ok := err.(*Error)
+	if !ok {
+		return err != context.Canceled && err != context.DeadlineExceeded
+	}
+	return requestErr.StatusCode >= 500 || requestErr.StatusCode == http.StatusTooManyRequests
+}
+
+// errorMessage extracts the message from the different error formats used by
+// the couchbase REST API.
+func errorMessage(body []byte) string {
+	var decoded interface{}
+	if err := json.Unmarshal(body, &decoded); err != nil {
+		return strings.TrimSpace(string(body))
+	}
+
+	if object, ok := decoded.(map[string]interface{}); ok {
+		for _, key := range []string{"errors", "error", "reason", "message"} {
+			if value, ok := object[key]; ok {
+				decoded = value
+				break
+			}
+		}
+	}
+
+	messages := make([]string, 0)
+	switch value := decoded.(type) {
+	case string:
+		messages = append(messages, value)
+	case []interface{}:
+		for _, item := range value {
+			// The query service reports errors as {"code": .., "msg": ..}.
+			if object, ok := item.(map[string]interface{}); ok && object["msg"] != nil {
+				item = object["msg"]
+			}
+			messages = append(messages, fmt.Sprint(item))
+		}
+	case map[string]interface{}:
+		for field, item := range value {
+			messages = append(messages, fmt.Sprintf("%s: %v", field, item))
+		}
+	default:
+		return strings.TrimSpace(string(body))
+	}
+
+	return strings.Join(messages, "; ")
+}
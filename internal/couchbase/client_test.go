@@ -0,0 +1,137 @@
+package couchbase
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// testClient returns a client without backoff talking to a test server
+// running handler, and a function stopping the server.
+func testClient(handler http.HandlerFunc) (*Client, func()) {
+	server := httptest.NewServer(handler)
+	client := NewClient(strings.TrimPrefix(server.URL, "http://"), Auth{Username: "admin", Password: "secret"})
+	client.backoff = time.Millisecond
+	return client, server.Close
+}
+
+func TestClientRetries(t *testing.T) {
+	tests := []struct {
+		name     string
+		request  Request
+		fail     func(w http.ResponseWriter)
+		attempts int
+	}{
+		{"get retried on 5xx", Request{Method: "GET", Path: "/pools"}, respondWith(http.StatusServiceUnavailable), 4},
+		{"put retried on 429", Request{Method: "PUT", Path: "/pools"}, respondWith(http.StatusTooManyRequests), 4},
+		{"delete retried on transport errors", Request{Method: "DELETE", Path: "/pools"}, hangUp, 4},
+		{"get not retried on 4xx", Request{Method: "GET", Path: "/pools"}, respondWith(http.StatusBadRequest), 1},
+		{"post not retried", Request{Method: "POST", Path: "/pools"}, respondWith(http.StatusServiceUnavailable), 1},
+		{"post not retried on transport errors", Request{Method: "POST", Path: "/pools"}, hangUp, 1},
+		{"idempotent post retried", Request{Method: "POST", Path: "/pools", Idempotent: true}, respondWith(http.StatusServiceUnavailable), 4},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var attempts int32
+			client, stop := testClient(func(w http.ResponseWriter, r *http.Request) {
+				atomic.AddInt32(&attempts, 1)
+				test.fail(w)
+			})
+			defer stop()
+
+			err := client.Do(context.Background(), test.request, nil)
+			if err == nil {
+				t.Fatalf("expected an error")
+			}
+			if got := int(atomic.LoadInt32(&attempts)); got != test.attempts {
+				t.Fatalf("expected %d attempts, got %d", test.attempts, got)
+			}
+		})
+	}
+}
+
+func TestClientRecovers(t *testing.T) {
+	var attempts int32
+	client, stop := testClient(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&attempts, 1) < 3 {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.Write([]byte(`{"name":"default"}`))
+	})
+	defer stop()
+
+	out := struct {
+		Name string `json:"name"`
+	}{}
+	err := client.Get(context.Background(), "/pools/default", &out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := atomic.LoadInt32(&attempts); out.Name != "default" || got != 3 {
+		t.Fatalf("expected the third attempt to succeed, got %q after %d", out.Name, got)
+	}
+}
+
+func TestClientErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		status   int
+		body     string
+		message  string
+		notFound bool
+	}{
+		{"plain text", http.StatusBadRequest, "Requested resource not found.\n", "Requested resource not found.", false},
+		{"json string", http.StatusBadRequest, `"bucket is not empty"`, "bucket is not empty", false},
+		{"errors list", http.StatusBadRequest, `{"errors":["a","b"]}`, "a; b", false},
+		{"errors by field", http.StatusBadRequest, `{"errors":{"ramQuotaMB":"too small"}}`, "ramQuotaMB: too small", false},
+		{"reason", http.StatusBadRequest, `{"reason":"unknown bucket"}`, "unknown bucket", false},
+		{"query errors", http.StatusBadRequest, `{"errors":[{"code":4300,"msg":"index exists"}]}`, "index exists", false},
+		{"not found", http.StatusNotFound, `{"message":"no such user"}`, "no such user", true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			client, stop := testClient(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(test.status)
+				w.Write([]byte(test.body))
+			})
+			defer stop()
+
+			err := client.Get(context.Background(), "/pools/default/buckets/a", nil)
+			requestErr, ok := err.(*Error)
+			if !ok {
+				t.Fatalf("expected a couchbase error, got %v", err)
+			}
+			if requestErr.StatusCode != test.status || requestErr.Message != test.message {
+				t.Fatalf("expected %d %q, got %d %q", test.status, test.message, requestErr.StatusCode, requestErr.Message)
+			}
+			if IsNotFound(err) != test.notFound {
+				t.Fatalf("expected IsNotFound %t for %v", test.notFound, err)
+			}
+		})
+	}
+
+	if IsNotFound(context.Canceled) {
+		t.Fatalf("expected IsNotFound to be false for errors not returned by couchbase")
+	}
+}
+
+func respondWith(code int) func(w http.ResponseWriter) {
+	return func(w http.ResponseWriter) {
+		w.WriteHeader(code)
+	}
+}
+
+// hangUp closes the connection without answering.
+func hangUp(w http.ResponseWriter) {
+	conn, _, err := w.(http.Hijacker).Hijack()
+	if err == nil {
+		conn.Close()
+	}
+}
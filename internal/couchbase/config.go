@@ -0,0 +1,130 @@
+package couchbase
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/devgenie/scout/internal/common"
+)
+
+// Defaults of the ports left out of config.yml.
+const (
+	DefaultBroadcastPort  = 1300
+	DefaultRaftPort       = 8300
+	DefaultRaftMemberPort = 7946
+	DefaultRaftVoterPort  = 8301
+)
+
+var knownServices = map[string]bool{
+	"kv":       true,
+	"n1ql":     true,
+	"index":    true,
+	"fts":      true,
+	"eventing": true,
+	"cbas":     true,
+	"backup":   true,
+}
+
+var knownDiscoveryModes = map[string]bool{
+	"consul": true,
+	"join":   true,
+}
+
+// SetDefaults fills in the ports and bucket settings left out of the config.
+// Ports set to 0 in the file are kept for Validate to report.
+func (config *Config) SetDefaults(present func(path string) bool) {
+	defaults := []struct {
+		path  string
+		port  *int
+		value int
+	}{
+		{"couchbaseport", &config.CouchbasePort, DefaultPort},
+		{"broadcastport", &config.BroadcastPort, DefaultBroadcastPort},
+		{"raftport", &config.RaftPort, DefaultRaftPort},
+		{"raftmemberport", &config.RaftMemberPort, DefaultRaftMemberPort},
+		{"raftvoterport", &config.RaftVoterPort, DefaultRaftVoterPort},
+	}
+
+	for _, setting := range defaults {
+		if *setting.port == 0 && !present(setting.path) {
+			*setting.port = setting.value
+		}
+	}
+
+	for i := range config.Buckets {
+		config.Buckets[i].SetDefaults()
+	}
+}
+
+// Validate lists every problem with the config, paths are the YAML keys of
+// the offending values.
+func (config *Config) Validate() []common.Problem {
+	problems := make([]common.Problem, 0)
+	problem := func(path string, format string, args ...interface{}) {
+		problems = append(problems, common.Problem{Path: path, Message: fmt.Sprintf(format, args...)})
+	}
+
+	if config.Username == "" {
+		problem("username", "the couchbase username is required")
+	}
+	if config.Password == "" {
+		problem("password", "the couchbase password is required")
+	}
+
+	ports := []struct {
+		path string
+		port int
+	}{
+		{"couchbaseport", config.CouchbasePort},
+		{"broadcastport", config.BroadcastPort},
+		{"raftport", config.RaftPort},
+		{"raftmemberport", config.RaftMemberPort},
+		{"raftvoterport", config.RaftVoterPort},
+	}
+
+	used := map[int]string{WebServerPort: "the scout web server"}
+	for _, setting := range ports {
+		if setting.port < 1 || setting.port > 65535 {
+			problem(setting.path, "%d is not a valid port", setting.port)
+			continue
+		}
+
+		if other, ok := used[setting.port]; ok {
+			problem(setting.path, "port %d is already used by %s", setting.port, other)
+			continue
+		}
+		used[setting.port] = setting.path
+	}
+
+	if strings.TrimSpace(config.Services) == "" {
+		problem("services", "at least one couchbase service is required")
+	}
+	for _, service := range strings.Split(config.Services, ",") {
+		service = strings.TrimSpace(service)
+		if service != "" && !knownServices[service] {
+			problem("services", "unknown service %q", service)
+		}
+	}
+
+	for i, discovery := range config.Discovery {
+		path := fmt.Sprintf("discovery[%d]", i)
+		if !knownDiscoveryModes[discovery.Mode] {
+			problem(path+".mode", "unknown discovery mode %q, use consul or join", discovery.Mode)
+		}
+		if discovery.Join == "" {
+			problem(path+".join", "discovery mode %s needs an address to join", discovery.Mode)
+		}
+	}
+
+	period := config.Cluster.AutoFailover.DiskIssuesPeriod
+	if period != 0 && (period < MinDiskIssuesPeriod || period > MaxDiskIssuesPeriod) {
+		problem("cluster.autofailover.diskissuesperiod", "disk issues period of %d seconds is out of range, use %d to %d", period, MinDiskIssuesPeriod, MaxDiskIssuesPeriod)
+	}
+
+	for i, bucket := range config.Buckets {
+		problems = append(problems, bucket.Problems(fmt.Sprintf("buckets[%d]", i))...)
+	}
+
+	problems = append(problems, config.Monitor.Problems("monitor")...)
+	return problems
+}
@@ -0,0 +1,87 @@
+package couchbase
+
+import (
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/devgenie/scout/internal/common"
+)
+
+func TestConfigSetDefaults(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  Config
+		present []string
+		want    Config
+	}{
+		{
+			name: "missing ports",
+			want: Config{CouchbasePort: DefaultPort, BroadcastPort: DefaultBroadcastPort, RaftPort: DefaultRaftPort,
+				RaftMemberPort: DefaultRaftMemberPort, RaftVoterPort: DefaultRaftVoterPort},
+		},
+		{
+			name:    "explicit zero port is kept",
+			present: []string{"raftport"},
+			want: Config{CouchbasePort: DefaultPort, BroadcastPort: DefaultBroadcastPort,
+				RaftMemberPort: DefaultRaftMemberPort, RaftVoterPort: DefaultRaftVoterPort},
+		},
+		{
+			name: "bucket defaults per type",
+			config: Config{Buckets: []BucketConfig{
+				{Name: "a"},
+				{Name: "b", BucketType: "ephemeral"},
+				{Name: "c", BucketType: "memcached"},
+				{Name: "d", EvictionPolicy: "fullEviction", ThreadsNumber: 8},
+			}},
+			want: Config{CouchbasePort: DefaultPort, BroadcastPort: DefaultBroadcastPort, RaftPort: DefaultRaftPort,
+				RaftMemberPort: DefaultRaftMemberPort, RaftVoterPort: DefaultRaftVoterPort,
+				Buckets: []BucketConfig{
+					{Name: "a", BucketType: "couchbase", EvictionPolicy: "valueOnly", ThreadsNumber: DefaultBucketThreads},
+					{Name: "b", BucketType: "ephemeral", EvictionPolicy: "noEviction", ThreadsNumber: DefaultBucketThreads},
+					{Name: "c", BucketType: "memcached"},
+					{Name: "d", BucketType: "couchbase", EvictionPolicy: "fullEviction", ThreadsNumber: 8},
+				}},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			config := test.config
+			config.SetDefaults(func(path string) bool {
+				for _, present := range test.present {
+					if present == path {
+						return true
+					}
+				}
+				return false
+			})
+
+			if !reflect.DeepEqual(config, test.want) {
+				t.Fatalf("expected %+v, got %+v", test.want, config)
+			}
+		})
+	}
+}
+
+func TestConfigZeroPort(t *testing.T) {
+	file, err := ioutil.TempFile("", "config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(file.Name())
+	file.WriteString("username: admin\npassword: secret\nservices: kv\nraftport: 0\n")
+	file.Close()
+
+	err = common.ParseYml(file.Name(), &Config{})
+	configErr, ok := err.(*common.ConfigError)
+	if !ok {
+		t.Fatalf("expected a config error, got %v", err)
+	}
+
+	want := []common.Problem{{Path: "raftport", Line: 4, Message: "0 is not a valid port"}}
+	if !reflect.DeepEqual(configErr.Problems, want) {
+		t.Fatalf("expected %+v, got %+v", want, configErr.Problems)
+	}
+}
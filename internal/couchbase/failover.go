@@ -0,0 +1,121 @@
+package couchbase
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+)
+
+// GracefulFailover moves the active vbuckets off a node that is still
+// reachable. Couchbase runs it as a rebalance, use WaitForRebalance to follow
+// it.
+func (node *CouchbaseNode) GracefulFailover(ctx context.Context, name string) error {
+	otpNode, err := node.otpNode(ctx, name)
+	if err != nil {
+		return err
+	}
+
+	requestBody := url.Values{}
+	requestBody.Set("otpNode", otpNode)
+
+	err = node.client().Post(ctx, "/controller/startGracefulFailover", requestBody, nil)
+	if err != nil {
+		return fmt.Errorf("error starting graceful failover of %s : %s", name, err)
+	}
+	return nil
+}
+
+// HardFailover immediately promotes the replicas of a node that is gone.
+func (node *CouchbaseNode) HardFailover(ctx context.Context, name string) error {
+	otpNode, err := node.otpNode(ctx, name)
+	if err != nil {
+		return err
+	}
+
+	requestBody := url.Values{}
+	requestBody.Set("otpNode", otpNode)
+
+	err = node.client().Post(ctx, "/controller/failOver", requestBody, nil)
+	if err != nil {
+		return fmt.Errorf("error failing over %s : %s", name, err)
+	}
+	return nil
+}
+
+// MinReplicas returns the lowest replica count of the buckets that keep
+// replicas, or -1 when there are no such buckets.
+func (node *CouchbaseNode) MinReplicas(ctx context.Context) (int, error) {
+	buckets, err := node.Buckets(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	minReplicas := -1
+	for _, bucket := range buckets {
+		if bucket.BucketType == "memcached" {
+			continue
+		}
+		if minReplicas == -1 || bucket.ReplicaNumber < minReplicas {
+			minReplicas = bucket.ReplicaNumber
+		}
+	}
+	return minReplicas, nil
+}
+
+func (node *CouchbaseNode) otpNode(ctx context.Context, name string) (string, error) {
+	members, err := node.Nodes(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	for _, member := range members {
+		if member.Matches(name) {
+			return member.OTPNode, nil
+		}
+	}
+	return "", fmt.Errorf("%s is not a member of the cluster", name)
+}
+
+const (
+	RecoveryDelta = "delta"
+	RecoveryFull  = "full"
+)
+
+// SetRecoveryType marks a failed over node to be added back by the next
+// rebalance, with delta recovery reusing the data it still holds.
+func (node *CouchbaseNode) SetRecoveryType(ctx context.Context, name string, recoveryType string) error {
+	otpNode, err := node.otpNode(ctx, name)
+	if err != nil {
+		return err
+	}
+
+	requestBody := url.Values{}
+	requestBody.Set("otpNode", otpNode)
+	requestBody.Set("recoveryType", recoveryType)
+
+	err = node.client().Do(ctx, Request{Method: "POST", Path: "/controller/setRecoveryType", Form: requestBody, Idempotent: true}, nil)
+	if err != nil {
+		return fmt.Errorf("error setting %s recovery of %s : %s", recoveryType, name, err)
+	}
+	return nil
+}
+
+// MembershipIn returns how the cluster reachable at remoteAddress knows this
+// node, an empty string when it is not a member.
+func (node *CouchbaseNode) MembershipIn(ctx context.Context, remoteAddress string) (string, error) {
+	pool := struct {
+		Nodes []ClusterNode `json:"nodes"`
+	}{}
+
+	err := node.client().ForAddress(remoteAddress).Get(ctx, "/pools/default", &pool)
+	if err != nil {
+		return "", fmt.Errorf("error fetching cluster nodes of %s : %s", remoteAddress, err)
+	}
+
+	for _, member := range pool.Nodes {
+		if member.Matches(node.Hostname) {
+			return member.ClusterMembership, nil
+		}
+	}
+	return "", nil
+}
@@ -0,0 +1,237 @@
+package couchbase
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// IndexConfig declares a GSI secondary index in config.yml. Fields are N1QL
+// expressions and used as written.
+type IndexConfig struct {
+	Name     string   `yaml:"name"`
+	Bucket   string   `yaml:"bucket"`
+	Fields   []string `yaml:"fields"`
+	Where    string   `yaml:"where"`
+	Replicas int      `yaml:"replicas"`
+	Deferred bool     `yaml:"deferred"`
+}
+
+// IndexInfo is an index as reported by system:indexes.
+type IndexInfo struct {
+	Name      string   `json:"name"`
+	Bucket    string   `json:"keyspace_id"`
+	State     string   `json:"state"`
+	Fields    []string `json:"index_key"`
+	Condition string   `json:"condition"`
+	Primary   bool     `json:"is_primary"`
+}
+
+type nodeServices struct {
+	Hostname string         `json:"hostname"`
+	ThisNode bool           `json:"thisNode"`
+	Services map[string]int `json:"services"`
+}
+
+// QueryAddress returns the address of the query service of a node running
+// n1ql, this node is preferred when it runs the service itself.
+func (node *CouchbaseNode) QueryAddress(ctx context.Context) (string, error) {
+	services := struct {
+		NodesExt []nodeServices `json:"nodesExt"`
+	}{}
+
+	err := node.client().Get(ctx, "/pools/default/nodeServices", &services)
+	if err != nil {
+		return "", fmt.Errorf("error fetching node services : %s", err)
+	}
+
+	address := ""
+	for _, member := range services.NodesExt {
+		port, ok := member.Services["n1ql"]
+		if !ok {
+			continue
+		}
+
+		// The node answering the request leaves out its own hostname.
+		host := strings.Trim(member.Hostname, "[]")
+		if host == "" || member.ThisNode {
+			host = node.Address
+		}
+
+		if member.ThisNode {
+			return net.JoinHostPort(host, strconv.Itoa(port)), nil
+		}
+		if address == "" {
+			address = net.JoinHostPort(host, strconv.Itoa(port))
+		}
+	}
+
+	if address == "" {
+		return "", ErrNoQueryService
+	}
+	return address, nil
+}
+
+// ErrNoQueryService is returned by QueryAddress when no node of the cluster
+// runs n1ql.
+var ErrNoQueryService = errors.New("no node of the cluster runs the query service")
+
+// Query runs a N1QL statement against the query service of the cluster and
+// decodes the results into out.
+func (node *CouchbaseNode) Query(ctx context.Context, statement string, idempotent bool, out interface{}) error {
+	address, err := node.QueryAddress(ctx)
+	if err != nil {
+		return err
+	}
+
+	requestBody := url.Values{}
+	requestBody.Set("statement", statement)
+
+	client := node.client().ForAddress(address)
+	response := struct {
+		Results json.RawMessage `json:"results"`
+	}{}
+
+	err = client.Do(ctx, Request{Method: "POST", Path: "/query/service", Form: requestBody, Idempotent: idempotent}, &response)
+	if err != nil {
+		return err
+	}
+
+	if out == nil || len(response.Results) == 0 {
+		return nil
+	}
+	return json.Unmarshal(response.Results, out)
+}
+
+// Indexes lists the GSI indexes of the cluster.
+func (node *CouchbaseNode) Indexes(ctx context.Context) ([]IndexInfo, error) {
+	indexes := make([]IndexInfo, 0)
+	statement := "SELECT name, keyspace_id, state, index_key, `condition`, IFMISSING(is_primary, false) AS is_primary " +
+		"FROM system:indexes WHERE `using` = 'gsi'"
+
+	err := node.Query(ctx, statement, true, &indexes)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching indexes : %s", err)
+	}
+	return indexes, nil
+}
+
+func (node *CouchbaseNode) CreateIndex(ctx context.Context, index IndexConfig) error {
+	statement := fmt.Sprintf("CREATE INDEX %s ON %s(%s)", identifier(index.Name), identifier(index.Bucket), strings.Join(index.Fields, ", "))
+	if index.Where != "" {
+		statement += " WHERE " + index.Where
+	}
+
+	with := make([]string, 0)
+	if index.Replicas > 0 {
+		with = append(with, fmt.Sprintf(`"num_replica": %d`, index.Replicas))
+	}
+	if index.Deferred {
+		with = append(with, `"defer_build": true`)
+	}
+	if len(with) > 0 {
+		statement += " WITH {" + strings.Join(with, ", ") + "}"
+	}
+
+	err := node.Query(ctx, statement, false, nil)
+	if err != nil {
+		return fmt.Errorf("error creating index %s on %s : %s", index.Name, index.Bucket, err)
+	}
+	return nil
+}
+
+// BuildIndexes builds deferred indexes of a bucket in a single pass.
+func (node *CouchbaseNode) BuildIndexes(ctx context.Context, bucket string, names []string) error {
+	quoted := make([]string, 0, len(names))
+	for _, name := range names {
+		quoted = append(quoted, identifier(name))
+	}
+
+	statement := fmt.Sprintf("BUILD INDEX ON %s(%s)", identifier(bucket), strings.Join(quoted, ", "))
+	err := node.Query(ctx, statement, true, nil)
+	if err != nil {
+		return fmt.Errorf("error building indexes %v on %s : %s", names, bucket, err)
+	}
+	return nil
+}
+
+// Differences lists how the definition of an existing index differs from
+// the declared one. Expressions are compared after removing the quoting and
+// spacing the query service adds when it reports them.
+func (index IndexInfo) Differences(declared IndexConfig) []string {
+	differences := make([]string, 0)
+
+	fields := make([]string, 0, len(index.Fields))
+	for _, field := range index.Fields {
+		fields = append(fields, normalizeExpression(field))
+	}
+	want := make([]string, 0, len(declared.Fields))
+	for _, field := range declared.Fields {
+		want = append(want, normalizeExpression(field))
+	}
+	if strings.Join(fields, ",") != strings.Join(want, ",") {
+		differences = append(differences, fmt.Sprintf("fields are %v, declared %v", index.Fields, declared.Fields))
+	}
+
+	if normalizeExpression(index.Condition) != normalizeExpression(declared.Where) {
+		differences = append(differences, fmt.Sprintf("condition is %q, declared %q", index.Condition, declared.Where))
+	}
+	return differences
+}
+
+var expressionQuoting = strings.NewReplacer("`", "", " ", "", "\t", "", "\n", "", "'", "\"")
+
+func normalizeExpression(expression string) string {
+	normalized := strings.ToLower(expressionQuoting.Replace(expression))
+	for strings.HasPrefix(normalized, "(") && strings.HasSuffix(normalized, ")") && closing(normalized, 0) == len(normalized)-1 {
+		normalized = normalized[1 : len(normalized)-1]
+	}
+
+	// Drop doubled parentheses such as lower((name)).
+	dropped := make(map[int]bool)
+	for i := 0; i+1 < len(normalized); i++ {
+		if normalized[i] != '(' || normalized[i+1] != '(' {
+			continue
+		}
+		outer, inner := closing(normalized, i), closing(normalized, i+1)
+		if outer > 0 && inner == outer-1 {
+			dropped[i+1] = true
+			dropped[inner] = true
+		}
+	}
+
+	var builder strings.Builder
+	for i := 0; i < len(normalized); i++ {
+		if !dropped[i] {
+			builder.WriteByte(normalized[i])
+		}
+	}
+	return builder.String()
+}
+
+// closing returns the position of the parenthesis closing the one opened at
+// open, -1 when it is never closed.
+func closing(expression string, open int) int {
+	depth := 0
+	for i := open; i < len(expression); i++ {
+		switch expression[i] {
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+func identifier(name string) string {
+	return "`" + strings.Replace(name, "`", "``", -1) + "`"
+}
@@ -0,0 +1,91 @@
+package couchbase
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+func TestQueryAddress(t *testing.T) {
+	tests := []struct {
+		name     string
+		services string
+		want     string
+		fails    bool
+	}{
+		{
+			name:     "this node runs n1ql",
+			services: `{"nodesExt":[{"hostname":"10.0.0.2","services":{"n1ql":8093}},{"thisNode":true,"services":{"kv":11210,"n1ql":18093}}]}`,
+			want:     "127.0.0.1:18093",
+		},
+		{
+			name:     "another node runs n1ql",
+			services: `{"nodesExt":[{"thisNode":true,"services":{"kv":11210}},{"hostname":"10.0.0.2","services":{"n1ql":9093}},{"hostname":"10.0.0.3","services":{"n1ql":8093}}]}`,
+			want:     "10.0.0.2:9093",
+		},
+		{
+			name:     "ipv6 hostname",
+			services: `{"nodesExt":[{"hostname":"[fd00::2]","services":{"n1ql":8093}}]}`,
+			want:     "[fd00::2]:8093",
+		},
+		{
+			name:     "no node runs n1ql",
+			services: `{"nodesExt":[{"thisNode":true,"services":{"kv":11210}}]}`,
+			fails:    true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			node, stop := testNode(t, func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path != "/pools/default/nodeServices" {
+					http.NotFound(w, r)
+					return
+				}
+				fmt.Fprint(w, test.services)
+			})
+			defer stop()
+
+			address, err := node.QueryAddress(context.Background())
+			if test.fails {
+				if err == nil {
+					t.Fatalf("expected an error, got %s", address)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if address != test.want {
+				t.Fatalf("expected %s, got %s", test.want, address)
+			}
+		})
+	}
+}
+
+func TestIndexDifferences(t *testing.T) {
+	declared := IndexConfig{Name: "by_type", Bucket: "app", Fields: []string{"type", "LOWER(name)"}, Where: "type = 'user'"}
+
+	tests := []struct {
+		name        string
+		info        IndexInfo
+		differences int
+	}{
+		{"as reported by the query service", IndexInfo{Fields: []string{"`type`", "lower((`name`))"}, Condition: "(`type` = \"user\")"}, 0},
+		{"different fields", IndexInfo{Fields: []string{"`type`"}, Condition: "(`type` = \"user\")"}, 1},
+		{"fields in another order", IndexInfo{Fields: []string{"lower((`name`))", "`type`"}, Condition: "(`type` = \"user\")"}, 1},
+		{"different condition", IndexInfo{Fields: []string{"`type`", "lower((`name`))"}, Condition: "(`type` = \"admin\")"}, 1},
+		{"missing condition", IndexInfo{Fields: []string{"`type`", "lower((`name`))"}}, 1},
+		{"both differ", IndexInfo{Fields: []string{"`kind`"}}, 2},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			differences := test.info.Differences(declared)
+			if len(differences) != test.differences {
+				t.Fatalf("expected %d differences, got %v", test.differences, differences)
+			}
+		})
+	}
+}
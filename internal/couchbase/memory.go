@@ -0,0 +1,192 @@
+package couchbase
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+)
+
+const defaultReservedMemory = 0.2
+
+// cgroupLimitFiles hold the memory limit of the container under cgroup v2
+// and v1.
+var cgroupLimitFiles = []string{
+	"/sys/fs/cgroup/memory.max",
+	"/sys/fs/cgroup/memory/memory.limit_in_bytes",
+}
+
+// serviceMemory lists the services that take a memory quota with their
+// default share and the minimum couchbase accepts.
+var serviceMemory = map[string]struct {
+	weight  int
+	minimum int
+}{
+	"kv":       {60, 256},
+	"index":    {20, 256},
+	"fts":      {10, 256},
+	"eventing": {5, 256},
+	"cbas":     {20, 1024},
+}
+
+// MemoryPolicy sizes the service memory quotas from the memory of the
+// smallest node when enabled. Quotas set explicitly in the cluster section
+// are kept.
+type MemoryPolicy struct {
+	Enabled bool `yaml:"enabled"`
+	// Fraction of the memory left to the OS and other processes.
+	Reserved float64 `yaml:"reserved"`
+	// Relative share of the memory given to each service.
+	Weights map[string]int `yaml:"weights"`
+}
+
+// HostMemoryMB returns the memory available to this host, the lower of the
+// physical memory and the cgroup limit.
+func HostMemoryMB() (int, error) {
+	return hostMemoryMB("/proc/meminfo", cgroupLimitFiles)
+}
+
+func hostMemoryMB(meminfo string, limitFiles []string) (int, error) {
+	total, err := memTotal(meminfo)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, path := range limitFiles {
+		content, err := ioutil.ReadFile(path)
+		if err != nil {
+			continue
+		}
+
+		limit, err := strconv.ParseInt(strings.TrimSpace(string(content)), 10, 64)
+		if err != nil {
+			// cgroup v2 reports "max" when there is no limit.
+			continue
+		}
+
+		if limit/1024/1024 < total {
+			total = limit / 1024 / 1024
+		}
+		break
+	}
+
+	return int(total), nil
+}
+
+// Quotas splits the memory of a node running services according to the
+// policy, it returns the quota in MB per service. Services whose share is
+// below the minimum couchbase accepts get the minimum and the rest of the
+// memory is split between the others. It fails when the memory cannot hold
+// the minimums.
+func (policy MemoryPolicy) Quotas(totalMB int, services []string) (map[string]int, error) {
+	reserved := policy.Reserved
+	if reserved <= 0 || reserved >= 1 {
+		reserved = defaultReservedMemory
+	}
+	available := int(float64(totalMB) * (1 - reserved))
+
+	weights := make(map[string]int)
+	minimums := 0
+	for _, service := range services {
+		memory, ok := serviceMemory[service]
+		if !ok {
+			continue
+		}
+
+		weight := memory.weight
+		if configured, ok := policy.Weights[service]; ok {
+			weight = configured
+		}
+		weights[service] = weight
+		minimums += memory.minimum
+	}
+
+	quotas := make(map[string]int)
+	if len(weights) == 0 {
+		return quotas, nil
+	}
+	if minimums > available {
+		return nil, fmt.Errorf("%d MB of memory cannot hold the minimum quotas of %v, %d MB", available, services, minimums)
+	}
+
+	// Every service raised to its minimum takes that memory away from the
+	// others, which can push more of them below their minimum.
+	atMinimum := make(map[string]bool)
+	for {
+		remaining := available
+		sum := 0
+		for service, weight := range weights {
+			if atMinimum[service] {
+				remaining -= serviceMemory[service].minimum
+			} else {
+				sum += weight
+			}
+		}
+
+		raised := false
+		for service, weight := range weights {
+			if atMinimum[service] {
+				quotas[service] = serviceMemory[service].minimum
+				continue
+			}
+
+			quota := 0
+			if sum > 0 {
+				quota = remaining * weight / sum
+			}
+			if quota < serviceMemory[service].minimum {
+				atMinimum[service] = true
+				raised = true
+			}
+			quotas[service] = quota
+		}
+
+		if !raised {
+			return quotas, nil
+		}
+	}
+}
+
+// WithQuotas returns the config with the quotas that are not set explicitly
+// taken from quotas.
+func (cluster ClusterConfig) WithQuotas(quotas map[string]int) ClusterConfig {
+	fill := func(current *int, service string) {
+		if *current == 0 {
+			*current = quotas[service]
+		}
+	}
+
+	fill(&cluster.MemoryQuotaMB, "kv")
+	fill(&cluster.IndexMemoryQuotaMB, "index")
+	fill(&cluster.FTSMemoryQuotaMB, "fts")
+	fill(&cluster.EventingMemoryQuotaMB, "eventing")
+	fill(&cluster.AnalyticsMemoryQuotaMB, "cbas")
+	return cluster
+}
+
+func memTotal(meminfo string) (int64, error) {
+	file, err := os.Open(meminfo)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) >= 2 && fields[0] == "MemTotal:" {
+			kilobytes, err := strconv.ParseInt(fields[1], 10, 64)
+			if err != nil {
+				return 0, err
+			}
+			return kilobytes / 1024, nil
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return 0, err
+	}
+	return 0, fmt.Errorf("MemTotal missing from %s", meminfo)
+}
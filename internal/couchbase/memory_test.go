@@ -0,0 +1,141 @@
+package couchbase
+
+import (
+	"context"
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+func TestMemoryPolicyQuotas(t *testing.T) {
+	tests := []struct {
+		name     string
+		policy   MemoryPolicy
+		totalMB  int
+		services []string
+		want     map[string]int
+		fails    bool
+	}{
+		{
+			name:     "single service",
+			totalMB:  10000,
+			services: []string{"kv", "n1ql"},
+			want:     map[string]int{"kv": 8000},
+		},
+		{
+			name:     "split by weight",
+			totalMB:  10000,
+			services: []string{"kv", "index", "fts"},
+			want:     map[string]int{"kv": 5333, "index": 1777, "fts": 888},
+		},
+		{
+			name:     "configured weights and reserve",
+			policy:   MemoryPolicy{Reserved: 0.5, Weights: map[string]int{"kv": 1, "index": 1}},
+			totalMB:  4000,
+			services: []string{"kv", "index"},
+			want:     map[string]int{"kv": 1000, "index": 1000},
+		},
+		{
+			name:     "minimums taken from the other services",
+			totalMB:  2000,
+			services: []string{"kv", "index", "fts", "eventing"},
+			want:     map[string]int{"kv": 816, "index": 272, "fts": 256, "eventing": 256},
+		},
+		{
+			name:     "raising one minimum pushes another below its own",
+			totalMB:  2500,
+			services: []string{"kv", "index", "cbas"},
+			want:     map[string]int{"kv": 720, "index": 256, "cbas": 1024},
+		},
+		{
+			name:     "services without a quota",
+			totalMB:  1000,
+			services: []string{"n1ql"},
+			want:     map[string]int{},
+		},
+		{
+			name:     "too little memory for the minimums",
+			totalMB:  600,
+			services: []string{"kv", "index"},
+			fails:    true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			quotas, err := test.policy.Quotas(test.totalMB, test.services)
+			if test.fails {
+				if err == nil {
+					t.Fatalf("expected an error, got %v", quotas)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(quotas, test.want) {
+				t.Fatalf("expected %v, got %v", test.want, quotas)
+			}
+
+			reserved := test.policy.Reserved
+			if reserved == 0 {
+				reserved = defaultReservedMemory
+			}
+			total := 0
+			for _, quota := range quotas {
+				total += quota
+			}
+			if available := int(float64(test.totalMB) * (1 - reserved)); total > available {
+				t.Fatalf("quotas take %d MB of the %d MB available", total, available)
+			}
+		})
+	}
+}
+
+func TestHostMemoryMB(t *testing.T) {
+	tests := []struct {
+		name   string
+		limits []string
+		want   int
+	}{
+		{"no cgroup", []string{"testdata/cgroup/missing"}, 7976},
+		{"cgroup v2 without limit", []string{"testdata/cgroup/v2-unlimited.max", "testdata/cgroup/missing"}, 7976},
+		{"cgroup v2 limit", []string{"testdata/cgroup/v2-limited.max", "testdata/cgroup/v1-limited.limit_in_bytes"}, 2048},
+		{"cgroup v1 without limit", []string{"testdata/cgroup/missing", "testdata/cgroup/v1-unlimited.limit_in_bytes"}, 7976},
+		{"cgroup v1 limit", []string{"testdata/cgroup/missing", "testdata/cgroup/v1-limited.limit_in_bytes"}, 1024},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			memory, err := hostMemoryMB("testdata/meminfo", test.limits)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if memory != test.want {
+				t.Fatalf("expected %d MB, got %d", test.want, memory)
+			}
+		})
+	}
+
+	if _, err := hostMemoryMB("testdata/cgroup/v2-limited.max", nil); err == nil {
+		t.Fatalf("expected an error for a file without MemTotal")
+	}
+}
+
+func TestAddNodeServices(t *testing.T) {
+	var services string
+	node, stop := testNode(t, func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		services = r.PostForm.Get("services")
+	})
+	defer stop()
+	node.Services = "kv, index ,n1ql"
+
+	err := node.AddNode(context.Background(), node.RESTAddress())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if services != "kv,index,n1ql" {
+		t.Fatalf("expected the configured services, got %q", services)
+	}
+}
@@ -1,11 +1,20 @@
 package couchbase
 
 import (
+	"context"
 	"fmt"
 	"log"
-	"strconv"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/devgenie/scout/internal/backup"
+	"github.com/devgenie/scout/internal/monitor"
+	"github.com/devgenie/scout/internal/notify"
 )
 
+// Config is the content of config.yml. Ports left out default to
+// DefaultPort for couchbase and to the Default*Port constants for scout.
 type Config struct {
 	Username       string
 	Password       string
@@ -15,7 +24,34 @@ type Config struct {
 	RaftMemberPort int
 	RaftVoterPort  int
 	Services       string
-	Discovery      []Discovery `yaml:"discovery"`
+	// Bearer token accepted by the admin API besides the couchbase
+	// credentials.
+	APIToken  string      `yaml:"apitoken"`
+	Discovery []Discovery `yaml:"discovery"`
+	// Availability zone of this node, nodes sharing a zone are placed in
+	// the same couchbase server group.
+	Zone string `yaml:"zone"`
+	// How long the leader waits for membership changes to settle before
+	// it rebalances them in a single batch.
+	RebalanceWindow time.Duration `yaml:"rebalancewindow"`
+	// How long failed over nodes are kept for delta recovery before the
+	// leader ejects them.
+	FailoverGracePeriod time.Duration `yaml:"failovergraceperiod"`
+	// How often the leader compares the cluster with the declared buckets.
+	ReconcileInterval time.Duration  `yaml:"reconcileinterval"`
+	Buckets           []BucketConfig `yaml:"buckets"`
+	// Delete empty buckets once they are removed from Buckets, without it
+	// they are only reported and have to be deleted through the API.
+	PruneBuckets bool          `yaml:"prunebuckets"`
+	Users        []UserConfig  `yaml:"users"`
+	Indexes      []IndexConfig `yaml:"indexes"`
+	// XDCR targets and the buckets replicated to them.
+	RemoteClusters []RemoteClusterConfig `yaml:"remoteclusters"`
+	Replications   []ReplicationConfig   `yaml:"replications"`
+	Cluster        ClusterConfig         `yaml:"cluster"`
+	Backup         backup.Config         `yaml:"backup"`
+	Monitor        monitor.Config        `yaml:"monitor"`
+	Notify         notify.Config         `yaml:"notify"`
 }
 
 type Discovery struct {
@@ -28,143 +64,126 @@ type CouchbaseNode struct {
 	Auth     Auth
 	Address  string
 	Hostname string
+	Services string
 	port     int
 }
 
-type BucketConfig struct {
-	flushEnabled   int
-	threadsNumber  int
-	replicaIndex   int
-	replicaNumber  int
-	evictionPolicy string
-	ramQuotaMB     int
-	bucketType     string
-	name           string
+// NewCouchbaseNode describes the couchbase node listening on address and port,
+// it is named after the hostname of this machine.
+func NewCouchbaseNode(address string, port int) *CouchbaseNode {
+	return &CouchbaseNode{
+		Address:  address,
+		Hostname: HostName(),
+		port:     port,
+	}
 }
 
-func (node *CouchbaseNode) BoootStrap(username string, password string, port int, services string) error {
+func (node *CouchbaseNode) BoootStrap(ctx context.Context, username string, password string, port int, services string, cluster ClusterConfig) error {
 	node.Auth = Auth{
 		Username: username,
 		Password: password,
 	}
 	node.port = port
+	node.Services = services
+	client := node.client()
 	log.Println("Initializing local node")
 
 	log.Println("Setting up services")
-	requestBody := make(map[string]string)
-	requestBody["services"] = services
-	remoteEndpoint := fmt.Sprintf("http://%s:%d/node/controller/setupServices", node.Address, node.port)
+	requestBody := url.Values{}
+	requestBody.Set("services", services)
 
-	respcode, body, err := SendRequest("POST", remoteEndpoint, requestBody, node.Auth)
-
-	requestBody = make(map[string]string)
-	requestBody["password"] = node.Auth.Password
-	requestBody["username"] = node.Auth.Username
-	requestBody["port"] = "SAME"
-	remoteEndpoint = fmt.Sprintf("http://%s:%d/settings/web", node.Address, node.port)
+	// Services can only be set up once, a restarted node gets an error here.
+	err := client.Post(ctx, "/node/controller/setupServices", requestBody, nil)
+	if err != nil {
+		log.Println(err)
+	}
 
-	respcode, body, err = SendRequest("POST", remoteEndpoint, requestBody, node.Auth)
+	requestBody = url.Values{}
+	requestBody.Set("password", node.Auth.Password)
+	requestBody.Set("username", node.Auth.Username)
+	requestBody.Set("port", "SAME")
 
-	if err != nil || respcode != 200 {
-		errMsg := fmt.Sprintf("error initializing node : %s", body)
-		return fmt.Errorf(errMsg)
+	err = client.Do(ctx, Request{Method: "POST", Path: "/settings/web", Form: requestBody, Idempotent: true}, nil)
+	if err != nil {
+		return fmt.Errorf("error initializing node : %s", err)
 	}
 
 	fmt.Println("1: initializing local node")
-	requestBody = make(map[string]string)
-	requestBody["data_path"] = "/opt/couchbase/var/lib/couchbase/data"
-	requestBody["index_path"] = "/opt/couchbase/var/lib/couchbase/data"
-	remoteEndpoint = fmt.Sprintf("http://%s:%d/nodes/self/controller/settings", node.Address, node.port)
+	requestBody = url.Values{}
+	requestBody.Set("data_path", "/opt/couchbase/var/lib/couchbase/data")
+	requestBody.Set("index_path", "/opt/couchbase/var/lib/couchbase/data")
 
-	respcode, body, err = SendRequest("POST", remoteEndpoint, requestBody, node.Auth)
-
-	if err != nil || respcode != 200 {
-		errMsg := fmt.Sprintf("error initializing node : %s", body)
-		return fmt.Errorf(errMsg)
+	err = client.Do(ctx, Request{Method: "POST", Path: "/nodes/self/controller/settings", Form: requestBody, Idempotent: true}, nil)
+	if err != nil {
+		return fmt.Errorf("error initializing node : %s", err)
 	}
 
 	fmt.Println("2: renaming node")
-	requestBody = make(map[string]string)
-	requestBody["hostname"] = node.Hostname
-	remoteEndpoint = fmt.Sprintf("http://%s:%d/node/controller/rename", node.Address, node.port)
-
-	respcode, body, err = SendRequest("POST", remoteEndpoint, requestBody, node.Auth)
+	requestBody = url.Values{}
+	requestBody.Set("hostname", node.Hostname)
 
-	if err != nil || respcode != 200 {
-		errMsg := fmt.Sprintf("error renaming node : %s", body)
-		return fmt.Errorf(errMsg)
+	err = client.Do(ctx, Request{Method: "POST", Path: "/node/controller/rename", Form: requestBody, Idempotent: true}, nil)
+	if err != nil {
+		return fmt.Errorf("error renaming node : %s", err)
 	}
 
-	log.Println("4: enabling autofail over")
-	requestBody = make(map[string]string)
-	requestBody["enabled"] = "true"
-	requestBody["timeout"] = "3600"
-	remoteEndpoint = fmt.Sprintf("http://%s:%d/settings/autoFailover", node.Address, node.port)
-
-	respcode, body, err = SendRequest("POST", remoteEndpoint, requestBody, node.Auth)
-
-	if err != nil || respcode != 200 {
-		errMsg := fmt.Sprintf("error initializing node node : %s", body)
-		return fmt.Errorf(errMsg)
+	log.Println("4: applying cluster settings")
+	err = node.ApplyClusterSettings(ctx, cluster, nil)
+	if err != nil {
+		return fmt.Errorf("error initializing node node : %s", err)
 	}
 
 	return nil
 }
 
-func (node *CouchbaseNode) AddNode(remoteAddress string) error {
-	requestBody := make(map[string]string)
-	requestBody["hostname"] = node.Hostname
-	requestBody["user"] = node.Auth.Username
-	requestBody["password"] = node.Auth.Password
-	requestBody["services"] = "kv,n1ql,index,fts"
-	remoteEndpoint := fmt.Sprintf("http://%s/controller/addNode", remoteAddress)
+func (node *CouchbaseNode) AddNode(ctx context.Context, remoteAddress string) error {
+	requestBody := url.Values{}
+	requestBody.Set("hostname", node.Hostname)
+	requestBody.Set("user", node.Auth.Username)
+	requestBody.Set("password", node.Auth.Password)
+	requestBody.Set("services", serviceList(node.Services))
 
-	respcode, body, err := SendRequest("POST", remoteEndpoint, requestBody, node.Auth)
-
-	if err != nil || respcode != 200 {
-		errMsg := fmt.Sprintf("error adding node : %s", body)
-		return fmt.Errorf(errMsg)
+	err := node.client().ForAddress(remoteAddress).Post(ctx, "/controller/addNode", requestBody, nil)
+	if err != nil {
+		return fmt.Errorf("error adding node : %s", err)
 	}
 
 	return nil
 }
 
-func (node *CouchbaseNode) AddBucket(bucket BucketConfig) error {
-	requestBody := make(map[string]string)
-	requestBody["flushEnabled"] = strconv.Itoa(bucket.flushEnabled)
-	requestBody["threadsNumber"] = strconv.Itoa(bucket.threadsNumber)
-	requestBody["replicaIndex"] = strconv.Itoa(bucket.replicaIndex)
-	requestBody["replicaNumber"] = strconv.Itoa(bucket.replicaNumber)
-	requestBody["evictionPolicy"] = bucket.evictionPolicy
-	requestBody["ramQuotaMB"] = strconv.Itoa(bucket.ramQuotaMB)
-	requestBody["bucketType"] = bucket.bucketType
-	requestBody["name"] = bucket.name
-
-	remoteEndpoint := fmt.Sprintf("http://%s:8091/pools/default/buckets", node.Address)
-
-	respcode, body, err := SendRequest("POST", remoteEndpoint, requestBody, node.Auth)
-	if err != nil || respcode != 202 {
-		errMsg := fmt.Sprintf("error initializing node node : %s", body)
-		return fmt.Errorf(errMsg)
+// serviceList normalizes a comma separated list of services for the REST
+// API, which rejects spaces.
+func serviceList(services string) string {
+	list := make([]string, 0)
+	for _, service := range strings.Split(services, ",") {
+		if service = strings.TrimSpace(service); service != "" {
+			list = append(list, service)
+		}
 	}
-	return nil
+	return strings.Join(list, ",")
 }
 
-func (node *CouchbaseNode) Rebalance() error {
-	// remoteEndpoint := fmt.Sprintf("http://%s:8091/controller/rebalance", node.Address)
-
-	// respcode, body, err := SendRequest("POST", remoteEndpoint, requestBody, node.Auth)
-	// if err != nil || respcode != 202 {
-	// 	errMsg := fmt.Sprintf("error initializing node : %s", body)
-	// 	return fmt.Errorf(errMsg)
-	// }
-
+// Ping checks that the REST interface of the local node answers.
+func (node *CouchbaseNode) Ping(ctx context.Context) error {
+	err := node.client().Get(ctx, "/pools", nil)
+	if err != nil {
+		return fmt.Errorf("error reaching couchbase : %s", err)
+	}
 	return nil
 }
 
-func (node *CouchbaseNode) RebalanceStatus() int {
+// RESTAddress is the host:port of the REST interface of the local node.
+func (node *CouchbaseNode) RESTAddress() string {
+	return node.client().Address()
+}
 
-	return -1
+// client returns a REST client for the local couchbase node.
+func (node *CouchbaseNode) client() *Client {
+	port := node.port
+	if port == 0 {
+		port = DefaultPort
+	}
+	return NewClient(fmt.Sprintf("%s:%d", node.Address, port), node.Auth)
 }
 
 func (dicoveryMode Discovery) Type() Discovery {
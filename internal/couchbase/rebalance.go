@@ -0,0 +1,279 @@
+package couchbase
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	RebalanceNone    = "none"
+	RebalanceRunning = "running"
+)
+
+// rebalanceStartPolls is how many times a rebalance that was never seen
+// running is polled before it is taken as finished.
+const rebalanceStartPolls = 3
+
+const (
+	RebalanceCompleted = "completed"
+	RebalanceFailed    = "failed"
+	RebalanceStalled   = "stalled"
+)
+
+type ClusterNode struct {
+	OTPNode           string   `json:"otpNode"`
+	Hostname          string   `json:"hostname"`
+	ClusterMembership string   `json:"clusterMembership"`
+	Status            string   `json:"status"`
+	Services          []string `json:"services"`
+	RecoveryType      string   `json:"recoveryType"`
+}
+
+// RebalanceProgress is the state reported by /pools/default/rebalanceProgress,
+// Progress is the average completion of all nodes in percent.
+type RebalanceProgress struct {
+	Status   string
+	Progress float64
+	Nodes    map[string]float64
+}
+
+// RebalanceResult describes how a rebalance started by scout ended.
+type RebalanceResult struct {
+	Status   string
+	Progress float64
+	Duration time.Duration
+	Message  string
+}
+
+type task struct {
+	Type         string `json:"type"`
+	Status       string `json:"status"`
+	ErrorMessage string `json:"errorMessage"`
+}
+
+// Nodes lists the members of the cluster this node belongs to.
+func (node *CouchbaseNode) Nodes(ctx context.Context) ([]ClusterNode, error) {
+	pool := struct {
+		Nodes []ClusterNode `json:"nodes"`
+	}{}
+
+	err := node.client().Get(ctx, "/pools/default", &pool)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching cluster nodes : %s", err)
+	}
+
+	return pool.Nodes, nil
+}
+
+// Rebalance starts a rebalance of every known node, ejecting the nodes listed
+// in ejectedNodes. Nodes can be given by hostname or by otp name.
+func (node *CouchbaseNode) Rebalance(ctx context.Context, ejectedNodes []string) error {
+	members, err := node.Nodes(ctx)
+	if err != nil {
+		return err
+	}
+
+	knownNodes := make([]string, 0, len(members))
+	ejected := make([]string, 0, len(ejectedNodes))
+
+	for _, member := range members {
+		knownNodes = append(knownNodes, member.OTPNode)
+
+		for _, name := range ejectedNodes {
+			if member.Matches(name) {
+				ejected = append(ejected, member.OTPNode)
+				break
+			}
+		}
+	}
+
+	if len(ejected) != len(ejectedNodes) {
+		return fmt.Errorf("error starting rebalance : some of %v are not cluster members", ejectedNodes)
+	}
+
+	requestBody := url.Values{}
+	requestBody.Set("knownNodes", strings.Join(knownNodes, ","))
+	requestBody.Set("ejectedNodes", strings.Join(ejected, ","))
+
+	err = node.client().Post(ctx, "/controller/rebalance", requestBody, nil)
+	if err != nil {
+		return fmt.Errorf("error starting rebalance : %s", err)
+	}
+
+	return nil
+}
+
+func (node *CouchbaseNode) StopRebalance(ctx context.Context) error {
+	err := node.client().Do(ctx, Request{Method: "POST", Path: "/controller/stopRebalance", Idempotent: true}, nil)
+	if err != nil {
+		return fmt.Errorf("error stopping rebalance : %s", err)
+	}
+
+	return nil
+}
+
+func (node *CouchbaseNode) RebalanceStatus(ctx context.Context) (RebalanceProgress, error) {
+	progress := RebalanceProgress{
+		Nodes: make(map[string]float64),
+	}
+
+	// Besides "status" the response holds one object per otp node.
+	fields := make(map[string]json.RawMessage)
+	err := node.client().Get(ctx, "/pools/default/rebalanceProgress", &fields)
+	if err != nil {
+		return progress, fmt.Errorf("error fetching rebalance progress : %s", err)
+	}
+
+	err = json.Unmarshal(fields["status"], &progress.Status)
+	if err != nil {
+		return progress, fmt.Errorf("error decoding rebalance status : %s", err)
+	}
+
+	total := 0.0
+	for name, field := range fields {
+		nodeProgress := struct {
+			Progress float64 `json:"progress"`
+		}{}
+
+		if name == "status" || json.Unmarshal(field, &nodeProgress) != nil {
+			continue
+		}
+		progress.Nodes[name] = nodeProgress.Progress * 100
+		total += nodeProgress.Progress * 100
+	}
+
+	if len(progress.Nodes) > 0 {
+		progress.Progress = total / float64(len(progress.Nodes))
+	}
+
+	return progress, nil
+}
+
+// WaitForRebalance polls the rebalance progress until it finishes. A rebalance
+// whose progress does not move for stallTimeout is reported as stalled and
+// left running for the caller to decide what to do with it, as is one whose
+// context is done.
+//
+// Couchbase reports no rebalance both before one starts and after a short one
+// ended, so until the rebalance was seen running it only counts as finished
+// once the last rebalance task holds an error or rebalanceStartPolls polls
+// passed.
+func (node *CouchbaseNode) WaitForRebalance(ctx context.Context, pollInterval time.Duration, stallTimeout time.Duration) RebalanceResult {
+	started := time.Now()
+	lastChange := started
+	result := RebalanceResult{}
+	seenRunning := false
+	idlePolls := 0
+
+	for {
+		finished := false
+		progress, err := node.RebalanceStatus(ctx)
+		switch {
+		case err != nil:
+			log.Println(err)
+		case progress.Status == RebalanceRunning:
+			seenRunning = true
+			if progress.Progress != result.Progress {
+				result.Progress = progress.Progress
+				lastChange = time.Now()
+			}
+		case seenRunning:
+			finished = true
+		default:
+			idlePolls++
+			message, err := node.rebalanceError(ctx)
+			if err != nil {
+				log.Println(err)
+			}
+			finished = message != "" || idlePolls >= rebalanceStartPolls
+		}
+		if finished {
+			break
+		}
+
+		if time.Since(lastChange) > stallTimeout {
+			result.Status = RebalanceStalled
+			result.Duration = time.Since(started)
+			result.Message = fmt.Sprintf("no progress for %s", stallTimeout)
+			return result
+		}
+
+		select {
+		case <-ctx.Done():
+			result.Status = RebalanceStalled
+			result.Duration = time.Since(started)
+			result.Message = ctx.Err().Error()
+			return result
+		case <-time.After(pollInterval):
+		}
+	}
+
+	result.Duration = time.Since(started)
+	message, err := node.rebalanceError(ctx)
+	if err != nil {
+		result.Status = RebalanceFailed
+		result.Message = err.Error()
+		return result
+	}
+
+	if message != "" {
+		result.Status = RebalanceFailed
+		result.Message = message
+		return result
+	}
+
+	result.Status = RebalanceCompleted
+	result.Progress = 100
+	return result
+}
+
+// rebalanceError returns the error couchbase recorded for the last rebalance
+// task, an empty string means the rebalance succeeded.
+func (node *CouchbaseNode) rebalanceError(ctx context.Context) (string, error) {
+	tasks := make([]task, 0)
+	err := node.client().Get(ctx, "/pools/default/tasks", &tasks)
+	if err != nil {
+		return "", fmt.Errorf("error fetching cluster tasks : %s", err)
+	}
+
+	for _, clusterTask := range tasks {
+		if clusterTask.Type == "rebalance" {
+			return clusterTask.ErrorMessage, nil
+		}
+	}
+
+	return "", nil
+}
+
+// Matches reports whether name is the otp name, hostname or host of member.
+func (member ClusterNode) Matches(name string) bool {
+	if member.OTPNode == name || member.Hostname == name {
+		return true
+	}
+
+	host := member.Hostname
+	if index := strings.LastIndex(host, ":"); index > 0 {
+		host = host[:index]
+	}
+	return host == name
+}
+
+// Self returns this node as seen by the cluster it belongs to.
+func (node *CouchbaseNode) Self(ctx context.Context) (ClusterNode, error) {
+	members, err := node.Nodes(ctx)
+	if err != nil {
+		return ClusterNode{}, err
+	}
+
+	for _, member := range members {
+		if member.Matches(node.Hostname) {
+			return member, nil
+		}
+	}
+	return ClusterNode{}, fmt.Errorf("%s is not a member of the cluster", node.Hostname)
+}
@@ -0,0 +1,118 @@
+package couchbase
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRebalanceStatus(t *testing.T) {
+	node, stop := testNode(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"status":"running","ns_1@a":{"progress":0.5},"ns_1@b":{"progress":0.25}}`))
+	})
+	defer stop()
+
+	progress, err := node.RebalanceStatus(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := RebalanceProgress{
+		Status:   RebalanceRunning,
+		Progress: 37.5,
+		Nodes:    map[string]float64{"ns_1@a": 50, "ns_1@b": 25},
+	}
+	if !reflect.DeepEqual(progress, want) {
+		t.Fatalf("expected %+v, got %+v", want, progress)
+	}
+}
+
+func TestWaitForRebalance(t *testing.T) {
+	tests := []struct {
+		name     string
+		progress []string
+		error    string
+		status   string
+		polls    int
+	}{
+		{
+			name:     "completes after running",
+			progress: []string{`{"status":"running","ns_1@a":{"progress":0.5}}`, `{"status":"none"}`},
+			status:   RebalanceCompleted,
+			polls:    2,
+		},
+		{
+			name:     "fails after running",
+			progress: []string{`{"status":"running","ns_1@a":{"progress":0.5}}`, `{"status":"none"}`},
+			error:    "Rebalance exited with reason buckets_shutdown_wait_failed",
+			status:   RebalanceFailed,
+			polls:    2,
+		},
+		{
+			name:     "waits for the rebalance to show up",
+			progress: []string{`{"status":"none"}`, `{"status":"running","ns_1@a":{"progress":0.5}}`, `{"status":"none"}`},
+			status:   RebalanceCompleted,
+			polls:    3,
+		},
+		{
+			name:     "fails without ever running",
+			progress: []string{`{"status":"none"}`},
+			error:    "Rebalance exited with reason not_all_nodes_are_ready",
+			status:   RebalanceFailed,
+			polls:    1,
+		},
+		{
+			name:     "too short to be seen running",
+			progress: []string{`{"status":"none"}`},
+			status:   RebalanceCompleted,
+			polls:    rebalanceStartPolls,
+		},
+		{
+			name:     "stalls without progress",
+			progress: []string{`{"status":"running","ns_1@a":{"progress":0.5}}`},
+			status:   RebalanceStalled,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var mutex sync.Mutex
+			polls := 0
+			node, stop := testNode(t, func(w http.ResponseWriter, r *http.Request) {
+				mutex.Lock()
+				defer mutex.Unlock()
+
+				switch r.URL.Path {
+				case "/pools/default/rebalanceProgress":
+					index := polls
+					if index >= len(test.progress) {
+						index = len(test.progress) - 1
+					}
+					polls++
+					w.Write([]byte(test.progress[index]))
+				case "/pools/default/tasks":
+					fmt.Fprintf(w, `[{"type":"rebalance","status":"notRunning","errorMessage":%q}]`, test.error)
+				}
+			})
+			defer stop()
+
+			result := node.WaitForRebalance(context.Background(), time.Millisecond, 50*time.Millisecond)
+			if result.Status != test.status {
+				t.Fatalf("expected %s, got %+v", test.status, result)
+			}
+			if test.error != "" && result.Message != test.error {
+				t.Fatalf("expected message %q, got %q", test.error, result.Message)
+			}
+
+			mutex.Lock()
+			defer mutex.Unlock()
+			if test.polls > 0 && polls != test.polls {
+				t.Fatalf("expected %d polls, got %d", test.polls, polls)
+			}
+		})
+	}
+}
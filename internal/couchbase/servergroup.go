@@ -0,0 +1,139 @@
+package couchbase
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+type ServerGroup struct {
+	Name  string        `json:"name"`
+	URI   string        `json:"uri"`
+	Nodes []ClusterNode `json:"nodes"`
+}
+
+type serverGroups struct {
+	Groups []ServerGroup `json:"groups"`
+	URI    string        `json:"uri"`
+}
+
+type groupAssignment struct {
+	URI   string      `json:"uri"`
+	Nodes []otpMember `json:"nodes"`
+}
+
+type otpMember struct {
+	OTPNode string `json:"otpNode"`
+}
+
+func (node *CouchbaseNode) ServerGroups(ctx context.Context) ([]ServerGroup, error) {
+	groups, err := node.serverGroups(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return groups.Groups, nil
+}
+
+func (node *CouchbaseNode) CreateServerGroup(ctx context.Context, name string) error {
+	requestBody := url.Values{}
+	requestBody.Set("name", name)
+
+	err := node.client().Post(ctx, "/pools/default/serverGroups", requestBody, nil)
+	if err != nil {
+		return fmt.Errorf("error creating server group %s : %s", name, err)
+	}
+	return nil
+}
+
+// AssignServerGroups moves nodes into server groups, creating the groups that
+// do not exist yet. Assignments map a node name, as accepted by
+// ClusterNode.Matches, to a group name. It returns whether any node moved.
+func (node *CouchbaseNode) AssignServerGroups(ctx context.Context, assignments map[string]string) (bool, error) {
+	groups, err := node.serverGroups(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	existing := make(map[string]bool)
+	for _, group := range groups.Groups {
+		existing[group.Name] = true
+	}
+
+	created := false
+	for _, name := range assignments {
+		if existing[name] {
+			continue
+		}
+
+		err = node.CreateServerGroup(ctx, name)
+		if err != nil {
+			return false, err
+		}
+		existing[name] = true
+		created = true
+	}
+
+	if created {
+		groups, err = node.serverGroups(ctx)
+		if err != nil {
+			return false, err
+		}
+	}
+
+	members := make(map[string][]otpMember)
+	moved := false
+	for _, group := range groups.Groups {
+		for _, member := range group.Nodes {
+			target := group.Name
+			for name, assigned := range assignments {
+				if member.Matches(name) {
+					target = assigned
+					break
+				}
+			}
+
+			if target != group.Name {
+				moved = true
+			}
+			members[target] = append(members[target], otpMember{OTPNode: member.OTPNode})
+		}
+	}
+
+	if !moved {
+		return false, nil
+	}
+
+	// Couchbase wants every group and node in the update, guarded by the
+	// revision we read.
+	update := struct {
+		Groups []groupAssignment `json:"groups"`
+	}{}
+	for _, group := range groups.Groups {
+		nodes := members[group.Name]
+		if nodes == nil {
+			nodes = make([]otpMember, 0)
+		}
+		update.Groups = append(update.Groups, groupAssignment{URI: group.URI, Nodes: nodes})
+	}
+
+	path := groups.URI
+	if !strings.HasPrefix(path, "/") {
+		path = "/pools/default/serverGroups"
+	}
+
+	err = node.client().Do(ctx, Request{Method: "PUT", Path: path, JSON: update}, nil)
+	if err != nil {
+		return false, fmt.Errorf("error assigning server groups : %s", err)
+	}
+	return true, nil
+}
+
+func (node *CouchbaseNode) serverGroups(ctx context.Context) (serverGroups, error) {
+	groups := serverGroups{}
+	err := node.client().Get(ctx, "/pools/default/serverGroups", &groups)
+	if err != nil {
+		return groups, fmt.Errorf("error fetching server groups : %s", err)
+	}
+	return groups, nil
+}
@@ -0,0 +1,150 @@
+package couchbase
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+// fakeServerGroups keeps the server groups of a cluster, guarded by a
+// revision like couchbase does.
+type fakeServerGroups struct {
+	mutex  sync.Mutex
+	rev    int
+	groups []ServerGroup
+	// conflict bumps the revision right before an update arrives.
+	conflict bool
+	updates  int
+}
+
+func (fake *fakeServerGroups) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+
+	switch r.Method {
+	case "GET":
+		json.NewEncoder(w).Encode(serverGroups{Groups: fake.groups, URI: fmt.Sprintf("/pools/default/serverGroups?rev=%d", fake.rev)})
+	case "POST":
+		r.ParseForm()
+		fake.groups = append(fake.groups, ServerGroup{Name: r.PostForm.Get("name"), URI: fmt.Sprintf("/pools/default/serverGroups/%d", len(fake.groups))})
+		fake.rev++
+	case "PUT":
+		fake.updates++
+		if fake.conflict {
+			fake.rev++
+		}
+		if r.URL.Query().Get("rev") != fmt.Sprint(fake.rev) {
+			w.WriteHeader(http.StatusConflict)
+			w.Write([]byte(`"revision mismatch"`))
+			return
+		}
+
+		update := struct {
+			Groups []groupAssignment `json:"groups"`
+		}{}
+		json.NewDecoder(r.Body).Decode(&update)
+		for _, assignment := range update.Groups {
+			for i := range fake.groups {
+				if fake.groups[i].URI != assignment.URI {
+					continue
+				}
+				fake.groups[i].Nodes = make([]ClusterNode, 0)
+				for _, member := range assignment.Nodes {
+					fake.groups[i].Nodes = append(fake.groups[i].Nodes, ClusterNode{OTPNode: member.OTPNode})
+				}
+			}
+		}
+		fake.rev++
+	}
+}
+
+// placement maps the group names to the otp names of their nodes.
+func (fake *fakeServerGroups) placement() map[string][]string {
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+
+	placement := make(map[string][]string)
+	for _, group := range fake.groups {
+		placement[group.Name] = make([]string, 0)
+		for _, member := range group.Nodes {
+			placement[group.Name] = append(placement[group.Name], member.OTPNode)
+		}
+	}
+	return placement
+}
+
+func TestAssignServerGroups(t *testing.T) {
+	members := []ClusterNode{
+		{OTPNode: "ns_1@a", Hostname: "a:8091"},
+		{OTPNode: "ns_1@b", Hostname: "b:8091"},
+		{OTPNode: "ns_1@c", Hostname: "c:8091"},
+	}
+
+	tests := []struct {
+		name        string
+		groups      []ServerGroup
+		assignments map[string]string
+		conflict    bool
+		moved       bool
+		fails       bool
+		want        map[string][]string
+	}{
+		{
+			name:        "nodes moved into their zones",
+			groups:      []ServerGroup{{Name: "Group 1", URI: "/pools/default/serverGroups/0", Nodes: members}},
+			assignments: map[string]string{"a": "zone-1", "ns_1@b": "zone-2"},
+			moved:       true,
+			want:        map[string][]string{"Group 1": {"ns_1@c"}, "zone-1": {"ns_1@a"}, "zone-2": {"ns_1@b"}},
+		},
+		{
+			name: "nodes already in their zones",
+			groups: []ServerGroup{
+				{Name: "zone-1", URI: "/pools/default/serverGroups/0", Nodes: members[:2]},
+				{Name: "zone-2", URI: "/pools/default/serverGroups/1", Nodes: members[2:]},
+			},
+			assignments: map[string]string{"a": "zone-1", "b:8091": "zone-1", "c": "zone-2"},
+			want:        map[string][]string{"zone-1": {"ns_1@a", "ns_1@b"}, "zone-2": {"ns_1@c"}},
+		},
+		{
+			name:        "groups changed since they were read",
+			groups:      []ServerGroup{{Name: "zone-1", URI: "/pools/default/serverGroups/0", Nodes: members}},
+			assignments: map[string]string{"a": "zone-2"},
+			conflict:    true,
+			fails:       true,
+			want:        map[string][]string{"zone-1": {"ns_1@a", "ns_1@b", "ns_1@c"}, "zone-2": {}},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			fake := &fakeServerGroups{groups: test.groups, conflict: test.conflict}
+			node, stop := testNode(t, fake.ServeHTTP)
+			defer stop()
+
+			moved, err := node.AssignServerGroups(context.Background(), test.assignments)
+			if test.fails {
+				if err == nil {
+					t.Fatalf("expected the conflicting update to fail")
+				}
+			} else if err != nil {
+				t.Fatal(err)
+			}
+			if moved != test.moved {
+				t.Fatalf("expected moved %t, got %t", test.moved, moved)
+			}
+			if placement := fake.placement(); !reflect.DeepEqual(placement, test.want) {
+				t.Fatalf("expected %v, got %v", test.want, placement)
+			}
+
+			fake.mutex.Lock()
+			defer fake.mutex.Unlock()
+			if !test.moved && !test.fails && fake.updates > 0 {
+				t.Fatalf("expected no update when every node is in place")
+			}
+		})
+	}
+}
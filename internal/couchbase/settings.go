@@ -0,0 +1,209 @@
+package couchbase
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	defaultAutoFailoverTimeout = 3600
+	defaultDiskIssuesPeriod    = 120
+)
+
+// Bounds couchbase accepts for the period of data disk issues, in seconds.
+const (
+	MinDiskIssuesPeriod = 5
+	MaxDiskIssuesPeriod = 3600
+)
+
+// ClusterConfig holds the cluster wide settings of the cluster: section of
+// config.yml. Zero values leave the couchbase default in place.
+type ClusterConfig struct {
+	Name                   string             `yaml:"name"`
+	MemoryQuotaMB          int                `yaml:"memoryquotamb"`
+	IndexMemoryQuotaMB     int                `yaml:"indexmemoryquotamb"`
+	FTSMemoryQuotaMB       int                `yaml:"ftsmemoryquotamb"`
+	EventingMemoryQuotaMB  int                `yaml:"eventingmemoryquotamb"`
+	AnalyticsMemoryQuotaMB int                `yaml:"analyticsmemoryquotamb"`
+	IndexStorageMode       string             `yaml:"indexstoragemode"`
+	AutoFailover           AutoFailoverConfig `yaml:"autofailover"`
+	MemoryPolicy           MemoryPolicy       `yaml:"memorypolicy"`
+}
+
+// AutoFailoverConfig is enabled with a timeout of an hour unless configured
+// otherwise. Failing over on data disk issues waits two minutes of errors
+// unless DiskIssuesPeriod is set.
+type AutoFailoverConfig struct {
+	Disabled         bool `yaml:"disabled"`
+	Timeout          int  `yaml:"timeout"`
+	MaxCount         int  `yaml:"maxcount"`
+	OnDiskIssues     bool `yaml:"ondiskissues"`
+	DiskIssuesPeriod int  `yaml:"diskissuesperiod"`
+}
+
+// settingsEndpoints maps the group of a setting key to the endpoint it is
+// read from and written to.
+var settingsEndpoints = map[string]string{
+	"pools":        "/pools/default",
+	"indexes":      "/settings/indexes",
+	"autoFailover": "/settings/autoFailover",
+}
+
+// bootstrapSettings can only be written while the cluster is set up,
+// couchbase refuses to change them once indexes exist.
+var bootstrapSettings = map[string]bool{
+	"indexes.storageMode": true,
+}
+
+// IsBootstrapSetting reports whether key is only applied when a node is
+// bootstrapped, drift of it is reported instead.
+func IsBootstrapSetting(key string) bool {
+	return bootstrapSettings[key]
+}
+
+// Values flattens the declared settings to "<group>.<parameter>" keys using
+// the couchbase parameter names.
+func (cluster ClusterConfig) Values() map[string]string {
+	values := make(map[string]string)
+
+	setInt := func(key string, value int) {
+		if value > 0 {
+			values[key] = strconv.Itoa(value)
+		}
+	}
+
+	if cluster.Name != "" {
+		values["pools.clusterName"] = cluster.Name
+	}
+	setInt("pools.memoryQuota", cluster.MemoryQuotaMB)
+	setInt("pools.indexMemoryQuota", cluster.IndexMemoryQuotaMB)
+	setInt("pools.ftsMemoryQuota", cluster.FTSMemoryQuotaMB)
+	setInt("pools.eventingMemoryQuota", cluster.EventingMemoryQuotaMB)
+	setInt("pools.cbasMemoryQuota", cluster.AnalyticsMemoryQuotaMB)
+
+	if cluster.IndexStorageMode != "" {
+		values["indexes.storageMode"] = cluster.IndexStorageMode
+	}
+
+	autoFailover := cluster.AutoFailover
+	values["autoFailover.enabled"] = strconv.FormatBool(!autoFailover.Disabled)
+	if !autoFailover.Disabled {
+		timeout := autoFailover.Timeout
+		if timeout == 0 {
+			timeout = defaultAutoFailoverTimeout
+		}
+		setInt("autoFailover.timeout", timeout)
+		setInt("autoFailover.maxCount", autoFailover.MaxCount)
+
+		values["autoFailover.failoverOnDataDiskIssues[enabled]"] = strconv.FormatBool(autoFailover.OnDiskIssues)
+		if autoFailover.OnDiskIssues {
+			period := autoFailover.DiskIssuesPeriod
+			if period == 0 {
+				period = defaultDiskIssuesPeriod
+			}
+			setInt("autoFailover.failoverOnDataDiskIssues[timePeriod]", period)
+		}
+	}
+
+	return values
+}
+
+// ClusterSettings reads the current settings with the keys used by
+// ClusterConfig.Values.
+func (node *CouchbaseNode) ClusterSettings(ctx context.Context) (map[string]string, error) {
+	client := node.client()
+	values := make(map[string]string)
+
+	for group, path := range settingsEndpoints {
+		settings := make(map[string]interface{})
+		err := client.Get(ctx, path, &settings)
+		if err != nil {
+			return nil, fmt.Errorf("error fetching %s settings : %s", group, err)
+		}
+
+		for name, value := range settings {
+			switch typed := value.(type) {
+			case map[string]interface{}:
+				for field, nested := range typed {
+					values[fmt.Sprintf("%s.%s[%s]", group, name, field)] = settingValue(nested)
+				}
+			case []interface{}:
+				continue
+			default:
+				values[group+"."+name] = settingValue(typed)
+			}
+		}
+	}
+
+	return values, nil
+}
+
+// DriftedSettings returns the declared keys whose current value differs.
+func DriftedSettings(current map[string]string, declared map[string]string) []string {
+	drifted := make([]string, 0)
+	for key, value := range declared {
+		if current[key] != value {
+			drifted = append(drifted, key)
+		}
+	}
+	sort.Strings(drifted)
+	return drifted
+}
+
+// ApplyClusterSettings writes the declared settings of every group that one
+// of keys belongs to, all groups when keys is nil. Bootstrap settings are
+// only written along with all groups.
+func (node *CouchbaseNode) ApplyClusterSettings(ctx context.Context, cluster ClusterConfig, keys []string) error {
+	values := cluster.Values()
+	groups := make(map[string]bool)
+
+	if keys == nil {
+		for key := range values {
+			groups[settingGroup(key)] = true
+		}
+	}
+	for _, key := range keys {
+		groups[settingGroup(key)] = true
+	}
+
+	client := node.client()
+	for group := range groups {
+		path, ok := settingsEndpoints[group]
+		if !ok {
+			return fmt.Errorf("unknown settings group %s", group)
+		}
+
+		requestBody := url.Values{}
+		for key, value := range values {
+			if settingGroup(key) != group || (keys != nil && IsBootstrapSetting(key)) {
+				continue
+			}
+			requestBody.Set(strings.TrimPrefix(key, group+"."), value)
+		}
+		if len(requestBody) == 0 {
+			continue
+		}
+
+		err := client.Do(ctx, Request{Method: "POST", Path: path, Form: requestBody, Idempotent: true}, nil)
+		if err != nil {
+			return fmt.Errorf("error applying %s settings : %s", group, err)
+		}
+	}
+
+	return nil
+}
+
+func settingGroup(key string) string {
+	return strings.SplitN(key, ".", 2)[0]
+}
+
+func settingValue(value interface{}) string {
+	if number, ok := value.(float64); ok {
+		return strconv.FormatFloat(number, 'f', -1, 64)
+	}
+	return fmt.Sprint(value)
+}
@@ -0,0 +1,116 @@
+package couchbase
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+func TestAutoFailoverValues(t *testing.T) {
+	tests := []struct {
+		name         string
+		autoFailover AutoFailoverConfig
+		want         map[string]string
+	}{
+		{
+			name: "defaults",
+			want: map[string]string{
+				"autoFailover.enabled":                           "true",
+				"autoFailover.timeout":                           "3600",
+				"autoFailover.failoverOnDataDiskIssues[enabled]": "false",
+			},
+		},
+		{
+			name:         "disabled",
+			autoFailover: AutoFailoverConfig{Disabled: true, Timeout: 30},
+			want:         map[string]string{"autoFailover.enabled": "false"},
+		},
+		{
+			name:         "disk issues without a period",
+			autoFailover: AutoFailoverConfig{Timeout: 30, OnDiskIssues: true},
+			want: map[string]string{
+				"autoFailover.enabled":                              "true",
+				"autoFailover.timeout":                              "30",
+				"autoFailover.failoverOnDataDiskIssues[enabled]":    "true",
+				"autoFailover.failoverOnDataDiskIssues[timePeriod]": "120",
+			},
+		},
+		{
+			name:         "disk issues with a period",
+			autoFailover: AutoFailoverConfig{Timeout: 30, MaxCount: 2, OnDiskIssues: true, DiskIssuesPeriod: 60},
+			want: map[string]string{
+				"autoFailover.enabled":                              "true",
+				"autoFailover.timeout":                              "30",
+				"autoFailover.maxCount":                             "2",
+				"autoFailover.failoverOnDataDiskIssues[enabled]":    "true",
+				"autoFailover.failoverOnDataDiskIssues[timePeriod]": "60",
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			values := ClusterConfig{AutoFailover: test.autoFailover}.Values()
+			if !reflect.DeepEqual(values, test.want) {
+				t.Fatalf("expected %v, got %v", test.want, values)
+			}
+		})
+	}
+}
+
+func TestApplyClusterSettings(t *testing.T) {
+	cluster := ClusterConfig{MemoryQuotaMB: 1024, IndexStorageMode: "plasma", AutoFailover: AutoFailoverConfig{Disabled: true}}
+
+	tests := []struct {
+		name string
+		keys []string
+		want map[string]url.Values
+	}{
+		{
+			name: "bootstrap",
+			want: map[string]url.Values{
+				"/pools/default":         {"memoryQuota": {"1024"}},
+				"/settings/indexes":      {"storageMode": {"plasma"}},
+				"/settings/autoFailover": {"enabled": {"false"}},
+			},
+		},
+		{
+			name: "drifted settings",
+			keys: []string{"pools.memoryQuota"},
+			want: map[string]url.Values{"/pools/default": {"memoryQuota": {"1024"}}},
+		},
+		{
+			name: "storage mode is only set at bootstrap",
+			keys: []string{"indexes.storageMode", "autoFailover.enabled"},
+			want: map[string]url.Values{"/settings/autoFailover": {"enabled": {"false"}}},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var mutex sync.Mutex
+			posted := make(map[string]url.Values)
+			node, stop := testNode(t, func(w http.ResponseWriter, r *http.Request) {
+				r.ParseForm()
+				mutex.Lock()
+				posted[r.URL.Path] = r.PostForm
+				mutex.Unlock()
+			})
+			defer stop()
+
+			err := node.ApplyClusterSettings(context.Background(), cluster, test.keys)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			mutex.Lock()
+			defer mutex.Unlock()
+			if !reflect.DeepEqual(posted, test.want) {
+				t.Fatalf("expected %v, got %v", test.want, posted)
+			}
+		})
+	}
+}
@@ -0,0 +1,129 @@
+package couchbase
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/devgenie/scout/internal/monitor"
+)
+
+// NodeStats are the system stats couchbase reports for a cluster node.
+type NodeStats struct {
+	Hostname       string
+	CPUUtilization float64
+	MemoryUsedMB   float64
+	OpsPerSec      float64
+}
+
+// BucketSample holds the latest sample of the stats of a bucket,
+// ResidentRatio and CacheMissRate are percentages. Stats couchbase did not
+// report are left at 0, Reported tells them apart from a real 0.
+type BucketSample struct {
+	Name          string
+	OpsPerSec     float64
+	ResidentRatio float64
+	DiskQueue     float64
+	MemoryUsedMB  float64
+	CacheMissRate float64
+	reported      map[string]bool
+}
+
+// Reported tells whether couchbase reported the stats behind a monitor metric.
+func (sample BucketSample) Reported(metric string) bool {
+	return sample.reported[metric]
+}
+
+// NodeStats lists the stats of every node in the cluster.
+func (node *CouchbaseNode) NodeStats(ctx context.Context) ([]NodeStats, error) {
+	pool := struct {
+		Nodes []struct {
+			Hostname    string `json:"hostname"`
+			SystemStats struct {
+				CPUUtilizationRate float64 `json:"cpu_utilization_rate"`
+				MemTotal           float64 `json:"mem_total"`
+				MemFree            float64 `json:"mem_free"`
+			} `json:"systemStats"`
+			InterestingStats struct {
+				Ops float64 `json:"ops"`
+			} `json:"interestingStats"`
+		} `json:"nodes"`
+	}{}
+
+	err := node.client().Get(ctx, "/pools/default", &pool)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching node stats : %s", err)
+	}
+
+	stats := make([]NodeStats, 0, len(pool.Nodes))
+	for _, member := range pool.Nodes {
+		stats = append(stats, NodeStats{
+			Hostname:       member.Hostname,
+			CPUUtilization: member.SystemStats.CPUUtilizationRate,
+			MemoryUsedMB:   (member.SystemStats.MemTotal - member.SystemStats.MemFree) / 1024 / 1024,
+			OpsPerSec:      member.InterestingStats.Ops,
+		})
+	}
+	return stats, nil
+}
+
+// BucketSample fetches the latest minute sample of the stats of a bucket.
+func (node *CouchbaseNode) BucketSample(ctx context.Context, name string) (BucketSample, error) {
+	response := struct {
+		Op struct {
+			Samples map[string][]float64 `json:"samples"`
+		} `json:"op"`
+	}{}
+
+	err := node.client().Get(ctx, bucketPath(name)+"/stats?zoom=minute", &response)
+	if err != nil {
+		return BucketSample{}, fmt.Errorf("error fetching stats of bucket %s : %s", name, err)
+	}
+
+	samples := response.Op.Samples
+	sample := BucketSample{Name: name, reported: make(map[string]bool)}
+
+	if ops, ok := latest(samples["ops"]); ok {
+		sample.OpsPerSec = ops
+		sample.reported[monitor.OpsPerSec] = true
+	}
+	if ratio, ok := latest(samples["vb_active_resident_items_ratio"]); ok {
+		sample.ResidentRatio = ratio
+		sample.reported[monitor.ResidentRatio] = true
+	}
+	queued, queuedOK := latest(samples["ep_queue_size"])
+	flushing, flushingOK := latest(samples["ep_flusher_todo"])
+	if queuedOK && flushingOK {
+		sample.DiskQueue = queued + flushing
+		sample.reported[monitor.DiskQueue] = true
+	}
+	if used, ok := latest(samples["mem_used"]); ok {
+		sample.MemoryUsedMB = used / 1024 / 1024
+		sample.reported[monitor.MemoryUsedMB] = true
+	}
+
+	// Older releases do not report the miss rate, it is derived from the
+	// background fetches and gets like the web console does.
+	if missRate, ok := latest(samples["ep_cache_miss_rate"]); ok {
+		sample.CacheMissRate = missRate
+		sample.reported[monitor.CacheMissRate] = true
+	} else {
+		gets, getsOK := latest(samples["cmd_get"])
+		fetched, fetchedOK := latest(samples["ep_bg_fetched"])
+		if getsOK && fetchedOK {
+			if gets > 0 {
+				sample.CacheMissRate = fetched / gets * 100
+			}
+			sample.reported[monitor.CacheMissRate] = true
+		}
+	}
+
+	return sample, nil
+}
+
+// latest returns the last value of samples, and false when there is none.
+func latest(samples []float64) (float64, bool) {
+	if len(samples) == 0 {
+		return 0, false
+	}
+	return samples[len(samples)-1], true
+}
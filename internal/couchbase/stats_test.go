@@ -0,0 +1,68 @@
+package couchbase
+
+import (
+	"context"
+	"net/http"
+	"reflect"
+	"testing"
+
+	"github.com/devgenie/scout/internal/monitor"
+)
+
+func TestBucketSample(t *testing.T) {
+	tests := []struct {
+		name    string
+		samples string
+		want    map[string]float64
+	}{
+		{
+			name:    "every stat reported",
+			samples: `{"ops":[1,20],"vb_active_resident_items_ratio":[100,95],"ep_queue_size":[3],"ep_flusher_todo":[4],"mem_used":[2097152],"ep_cache_miss_rate":[0]}`,
+			want: map[string]float64{
+				monitor.OpsPerSec: 20, monitor.ResidentRatio: 95, monitor.DiskQueue: 7,
+				monitor.MemoryUsedMB: 2, monitor.CacheMissRate: 0,
+			},
+		},
+		{
+			name:    "miss rate derived from gets",
+			samples: `{"ops":[],"ep_queue_size":[3],"cmd_get":[200],"ep_bg_fetched":[10]}`,
+			want:    map[string]float64{monitor.CacheMissRate: 5},
+		},
+		{
+			name:    "nothing reported",
+			samples: `{}`,
+			want:    map[string]float64{},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			node, stop := testNode(t, func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte(`{"op":{"samples":` + test.samples + `}}`))
+			})
+			defer stop()
+
+			sample, err := node.BucketSample(context.Background(), "default")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			values := map[string]float64{
+				monitor.OpsPerSec:     sample.OpsPerSec,
+				monitor.ResidentRatio: sample.ResidentRatio,
+				monitor.DiskQueue:     sample.DiskQueue,
+				monitor.MemoryUsedMB:  sample.MemoryUsedMB,
+				monitor.CacheMissRate: sample.CacheMissRate,
+			}
+			got := make(map[string]float64)
+			for metric, value := range values {
+				if sample.Reported(metric) {
+					got[metric] = value
+				}
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Fatalf("expected %v, got %v", test.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,107 @@
+package couchbase
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// UserConfig declares a local couchbase user. Roles use the couchbase
+// notation, for example "data_reader[travel]" or "query_select[*]".
+type UserConfig struct {
+	Name     string   `yaml:"name"`
+	FullName string   `yaml:"fullname"`
+	Password string   `yaml:"password"`
+	Roles    []string `yaml:"roles"`
+}
+
+type userInfo struct {
+	ID     string `json:"id"`
+	Domain string `json:"domain"`
+	Name   string `json:"name"`
+	Roles  []struct {
+		Role       string `json:"role"`
+		BucketName string `json:"bucket_name"`
+	} `json:"roles"`
+}
+
+// Users lists the local users defined in the cluster, passwords are never
+// returned by couchbase.
+func (node *CouchbaseNode) Users(ctx context.Context) ([]UserConfig, error) {
+	infos := make([]userInfo, 0)
+	err := node.client().Get(ctx, "/settings/rbac/users/local", &infos)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching users : %s", err)
+	}
+
+	users := make([]UserConfig, 0, len(infos))
+	for _, info := range infos {
+		user := UserConfig{
+			Name:     info.ID,
+			FullName: info.Name,
+			Roles:    make([]string, 0, len(info.Roles)),
+		}
+
+		for _, role := range info.Roles {
+			if role.BucketName != "" {
+				user.Roles = append(user.Roles, fmt.Sprintf("%s[%s]", role.Role, role.BucketName))
+			} else {
+				user.Roles = append(user.Roles, role.Role)
+			}
+		}
+		users = append(users, user)
+	}
+	return users, nil
+}
+
+// UpsertUser creates a local user or replaces its password and roles.
+func (node *CouchbaseNode) UpsertUser(ctx context.Context, user UserConfig) error {
+	requestBody := url.Values{}
+	requestBody.Set("password", user.Password)
+	requestBody.Set("roles", strings.Join(user.Roles, ","))
+	if user.FullName != "" {
+		requestBody.Set("name", user.FullName)
+	}
+
+	err := node.client().Put(ctx, userPath(user.Name), requestBody, nil)
+	if err != nil {
+		return fmt.Errorf("error saving user %s : %s", user.Name, err)
+	}
+	return nil
+}
+
+func (node *CouchbaseNode) DeleteUser(ctx context.Context, name string) error {
+	err := node.client().Delete(ctx, userPath(name))
+	if err != nil {
+		if IsNotFound(err) {
+			return err
+		}
+		return fmt.Errorf("error deleting user %s : %s", name, err)
+	}
+	return nil
+}
+
+// SameRoles reports whether both users hold the same roles in any order.
+func (user UserConfig) SameRoles(other UserConfig) bool {
+	if len(user.Roles) != len(other.Roles) {
+		return false
+	}
+
+	roles := append([]string(nil), user.Roles...)
+	otherRoles := append([]string(nil), other.Roles...)
+	sort.Strings(roles)
+	sort.Strings(otherRoles)
+
+	for i := range roles {
+		if roles[i] != otherRoles[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func userPath(name string) string {
+	return "/settings/rbac/users/local/" + url.PathEscape(name)
+}
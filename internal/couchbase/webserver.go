@@ -1,14 +1,93 @@
 package couchbase
 
 import (
+	"encoding/json"
 	"fmt"
+	"log"
 	"net/http"
+	"time"
 )
 
-func RunWebServer() {
-	http.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
-		fmt.Fprintf(w, "Welcome to my website!")
-	})
+// WebServerPort is the port of the scout web server on every node.
+const WebServerPort = 8600
 
-	http.ListenAndServe(":8600", nil)
+const (
+	HealthPass = "pass"
+	HealthWarn = "warn"
+	HealthFail = "fail"
+)
+
+type HealthCheck struct {
+	Name    string      `json:"name"`
+	Status  string      `json:"status"`
+	Message string      `json:"message,omitempty"`
+	Details interface{} `json:"details,omitempty"`
+}
+
+// HealthReport is the body of the health endpoints, Status is fail when any
+// check failed and warn when any check warned.
+type HealthReport struct {
+	Status string        `json:"status"`
+	Time   time.Time     `json:"time"`
+	Checks []HealthCheck `json:"checks"`
+}
+
+type HealthReporter interface {
+	Liveness() HealthReport
+	Readiness() HealthReport
+}
+
+// NewHealthReport builds a report out of checks and derives its status.
+func NewHealthReport(checks []HealthCheck) HealthReport {
+	report := HealthReport{
+		Status: HealthPass,
+		Time:   time.Now().UTC(),
+		Checks: checks,
+	}
+
+	for _, check := range checks {
+		if check.Status == HealthFail {
+			report.Status = HealthFail
+			break
+		}
+		if check.Status == HealthWarn {
+			report.Status = HealthWarn
+		}
+	}
+	return report
+}
+
+// RunWebServer serves the health endpoints and handlers on WebServerPort.
+// /health is the readiness check registered in consul.
+func RunWebServer(reporter HealthReporter, handlers map[string]http.Handler) {
+	err := http.ListenAndServe(fmt.Sprintf(":%d", WebServerPort), webMux(reporter, handlers))
+	if err != nil {
+		log.Println("error running web server", err)
+	}
+}
+
+func webMux(reporter HealthReporter, handlers map[string]http.Handler) *http.ServeMux {
+	mux := http.NewServeMux()
+	for pattern, handler := range handlers {
+		mux.Handle(pattern, handler)
+	}
+	mux.HandleFunc("/health", healthHandler(reporter.Readiness))
+	mux.HandleFunc("/health/ready", healthHandler(reporter.Readiness))
+	mux.HandleFunc("/health/live", healthHandler(reporter.Liveness))
+	return mux
+}
+
+func healthHandler(check func() HealthReport) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		report := check()
+
+		status := http.StatusOK
+		if report.Status == HealthFail {
+			status = http.StatusServiceUnavailable
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(report)
+	}
 }
@@ -0,0 +1,65 @@
+package couchbase
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+type fakeReporter struct {
+	live  []HealthCheck
+	ready []HealthCheck
+}
+
+func (reporter fakeReporter) Liveness() HealthReport {
+	return NewHealthReport(reporter.live)
+}
+
+func (reporter fakeReporter) Readiness() HealthReport {
+	return NewHealthReport(reporter.ready)
+}
+
+func TestHealthEndpoints(t *testing.T) {
+	pass := HealthCheck{Name: "raft", Status: HealthPass}
+	warn := HealthCheck{Name: "serf", Status: HealthWarn, Message: "1 members failed"}
+	fail := HealthCheck{Name: "couchbase", Status: HealthFail, Message: "node is inactiveAdded and healthy"}
+
+	tests := []struct {
+		name     string
+		path     string
+		reporter fakeReporter
+		code     int
+		status   string
+	}{
+		{"ready", "/health/ready", fakeReporter{ready: []HealthCheck{pass, pass}}, http.StatusOK, HealthPass},
+		{"ready with warnings", "/health/ready", fakeReporter{ready: []HealthCheck{pass, warn}}, http.StatusOK, HealthWarn},
+		{"not ready", "/health/ready", fakeReporter{ready: []HealthCheck{warn, fail, pass}}, http.StatusServiceUnavailable, HealthFail},
+		{"consul check follows readiness", "/health", fakeReporter{live: []HealthCheck{pass}, ready: []HealthCheck{fail}}, http.StatusServiceUnavailable, HealthFail},
+		{"live while not ready", "/health/live", fakeReporter{live: []HealthCheck{pass}, ready: []HealthCheck{fail}}, http.StatusOK, HealthPass},
+		{"not live", "/health/live", fakeReporter{live: []HealthCheck{fail}, ready: []HealthCheck{pass}}, http.StatusServiceUnavailable, HealthFail},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			recorder := httptest.NewRecorder()
+			webMux(test.reporter, nil).ServeHTTP(recorder, httptest.NewRequest("GET", test.path, nil))
+
+			if recorder.Code != test.code {
+				t.Fatalf("expected %d, got %d", test.code, recorder.Code)
+			}
+			if contentType := recorder.Header().Get("Content-Type"); contentType != "application/json" {
+				t.Fatalf("expected a json report, got %q", contentType)
+			}
+
+			report := HealthReport{}
+			err := json.NewDecoder(recorder.Body).Decode(&report)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if report.Status != test.status {
+				t.Fatalf("expected status %s, got %+v", test.status, report)
+			}
+		})
+	}
+}
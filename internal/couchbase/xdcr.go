@@ -0,0 +1,211 @@
+package couchbase
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// RemoteClusterConfig declares a cluster that buckets are replicated to.
+type RemoteClusterConfig struct {
+	Name     string `yaml:"name"`
+	Hostname string `yaml:"hostname"`
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
+}
+
+// ReplicationConfig declares an XDCR replication of a local bucket to a
+// bucket of a remote cluster.
+type ReplicationConfig struct {
+	Bucket        string `yaml:"bucket"`
+	RemoteCluster string `yaml:"remotecluster"`
+	RemoteBucket  string `yaml:"remotebucket"`
+	Filter        string `yaml:"filter"`
+	Priority      string `yaml:"priority"`
+}
+
+type RemoteClusterInfo struct {
+	Name     string `json:"name"`
+	UUID     string `json:"uuid"`
+	Hostname string `json:"hostname"`
+	Username string `json:"username"`
+	Deleted  bool   `json:"deleted"`
+}
+
+// ReplicationInfo is the state of a replication as reported by the xdcr
+// tasks of the cluster.
+type ReplicationInfo struct {
+	ID           string
+	Bucket       string
+	RemoteUUID   string
+	RemoteBucket string
+	Status       string
+	ChangesLeft  int64
+	Errors       []string
+}
+
+type xdcrTask struct {
+	Type        string `json:"type"`
+	ID          string `json:"id"`
+	Source      string `json:"source"`
+	Target      string `json:"target"`
+	Status      string `json:"status"`
+	ChangesLeft int64  `json:"changesLeft"`
+	Errors      []struct {
+		Time  string `json:"time"`
+		Error string `json:"errorMsg"`
+	} `json:"errors"`
+}
+
+func (node *CouchbaseNode) RemoteClusters(ctx context.Context) ([]RemoteClusterInfo, error) {
+	clusters := make([]RemoteClusterInfo, 0)
+	err := node.client().Get(ctx, "/pools/default/remoteClusters", &clusters)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching remote clusters : %s", err)
+	}
+
+	active := make([]RemoteClusterInfo, 0, len(clusters))
+	for _, cluster := range clusters {
+		if !cluster.Deleted {
+			active = append(active, cluster)
+		}
+	}
+	return active, nil
+}
+
+// SaveRemoteCluster creates a remote cluster reference, or updates it when
+// exists is set.
+func (node *CouchbaseNode) SaveRemoteCluster(ctx context.Context, cluster RemoteClusterConfig, exists bool) error {
+	requestBody := url.Values{}
+	requestBody.Set("name", cluster.Name)
+	requestBody.Set("hostname", cluster.Hostname)
+	requestBody.Set("username", cluster.Username)
+	requestBody.Set("password", cluster.Password)
+
+	path := "/pools/default/remoteClusters"
+	if exists {
+		path += "/" + url.PathEscape(cluster.Name)
+	}
+
+	err := node.client().Do(ctx, Request{Method: "POST", Path: path, Form: requestBody, Idempotent: exists}, nil)
+	if err != nil {
+		return fmt.Errorf("error saving remote cluster %s : %s", cluster.Name, err)
+	}
+	return nil
+}
+
+func (node *CouchbaseNode) DeleteRemoteCluster(ctx context.Context, name string) error {
+	err := node.client().Delete(ctx, "/pools/default/remoteClusters/"+url.PathEscape(name))
+	if err != nil {
+		return fmt.Errorf("error deleting remote cluster %s : %s", name, err)
+	}
+	return nil
+}
+
+// Replications lists the XDCR replications of the cluster.
+func (node *CouchbaseNode) Replications(ctx context.Context) ([]ReplicationInfo, error) {
+	tasks := make([]xdcrTask, 0)
+	err := node.client().Get(ctx, "/pools/default/tasks", &tasks)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching replications : %s", err)
+	}
+
+	replications := make([]ReplicationInfo, 0)
+	for _, task := range tasks {
+		if task.Type != "xdcr" {
+			continue
+		}
+
+		// Targets look like /remoteClusters/<uuid>/buckets/<bucket>.
+		target := strings.Split(strings.Trim(task.Target, "/"), "/")
+		replication := ReplicationInfo{
+			ID:          task.ID,
+			Bucket:      task.Source,
+			Status:      task.Status,
+			ChangesLeft: task.ChangesLeft,
+			Errors:      make([]string, 0, len(task.Errors)),
+		}
+		if len(target) == 4 {
+			replication.RemoteUUID = target[1]
+			replication.RemoteBucket = target[3]
+		}
+		for _, taskErr := range task.Errors {
+			replication.Errors = append(replication.Errors, taskErr.Error)
+		}
+		replications = append(replications, replication)
+	}
+	return replications, nil
+}
+
+func (node *CouchbaseNode) CreateReplication(ctx context.Context, replication ReplicationConfig) error {
+	requestBody := replication.settings()
+	requestBody.Set("fromBucket", replication.Bucket)
+	requestBody.Set("toCluster", replication.RemoteCluster)
+	requestBody.Set("toBucket", replication.RemoteBucket)
+	requestBody.Set("replicationType", "continuous")
+
+	err := node.client().Post(ctx, "/controller/createReplication", requestBody, nil)
+	if err != nil {
+		return fmt.Errorf("error replicating %s to %s/%s : %s", replication.Bucket, replication.RemoteCluster, replication.RemoteBucket, err)
+	}
+	return nil
+}
+
+// ReplicationSettings reads the filter and priority of a running
+// replication.
+func (node *CouchbaseNode) ReplicationSettings(ctx context.Context, id string) (ReplicationSettings, error) {
+	settings := ReplicationSettings{}
+	err := node.client().Get(ctx, replicationPath(id), &settings)
+	if err != nil {
+		return settings, fmt.Errorf("error fetching settings of replication %s : %s", id, err)
+	}
+	return settings, nil
+}
+
+// UpdateReplication changes the filter and priority of a running
+// replication.
+func (node *CouchbaseNode) UpdateReplication(ctx context.Context, id string, replication ReplicationConfig) error {
+	requestBody := replication.settings()
+	if replication.Filter == "" {
+		// An empty expression removes the filter.
+		requestBody.Set("filterExpression", "")
+	}
+
+	err := node.client().Do(ctx, Request{Method: "POST", Path: replicationPath(id), Form: requestBody, Idempotent: true}, nil)
+	if err != nil {
+		return fmt.Errorf("error updating replication %s : %s", id, err)
+	}
+	return nil
+}
+
+// ReplicationSettings are the settings of a replication that can be changed
+// while it runs.
+type ReplicationSettings struct {
+	Filter   string `json:"filterExpression"`
+	Priority string `json:"priority"`
+}
+
+// Drifted reports whether the settings differ from the declared ones. The
+// priority is only compared when it is declared.
+func (settings ReplicationSettings) Drifted(declared ReplicationConfig) bool {
+	if declared.Priority != "" && !strings.EqualFold(settings.Priority, declared.Priority) {
+		return true
+	}
+	return settings.Filter != declared.Filter
+}
+
+func (replication ReplicationConfig) settings() url.Values {
+	requestBody := url.Values{}
+	if replication.Filter != "" {
+		requestBody.Set("filterExpression", replication.Filter)
+	}
+	if replication.Priority != "" {
+		requestBody.Set("priority", replication.Priority)
+	}
+	return requestBody
+}
+
+func replicationPath(id string) string {
+	return "/settings/replications/" + url.PathEscape(id)
+}
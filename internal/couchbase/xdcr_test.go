@@ -0,0 +1,67 @@
+package couchbase
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"reflect"
+	"testing"
+)
+
+func TestReplicationSettingsDrifted(t *testing.T) {
+	tests := []struct {
+		name     string
+		settings ReplicationSettings
+		declared ReplicationConfig
+		drifted  bool
+	}{
+		{"same", ReplicationSettings{Filter: "^user", Priority: "High"}, ReplicationConfig{Filter: "^user", Priority: "High"}, false},
+		{"priority not declared", ReplicationSettings{Priority: "Low"}, ReplicationConfig{}, false},
+		{"priority case", ReplicationSettings{Priority: "High"}, ReplicationConfig{Priority: "high"}, false},
+		{"priority changed", ReplicationSettings{Priority: "High"}, ReplicationConfig{Priority: "Low"}, true},
+		{"filter changed", ReplicationSettings{Filter: "^user"}, ReplicationConfig{Filter: "^order"}, true},
+		{"filter removed", ReplicationSettings{Filter: "^user"}, ReplicationConfig{}, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if drifted := test.settings.Drifted(test.declared); drifted != test.drifted {
+				t.Fatalf("expected drifted %t, got %t", test.drifted, drifted)
+			}
+		})
+	}
+}
+
+func TestUpdateReplication(t *testing.T) {
+	tests := []struct {
+		name        string
+		replication ReplicationConfig
+		want        url.Values
+	}{
+		{"filter and priority", ReplicationConfig{Filter: "^user", Priority: "Low"}, url.Values{"filterExpression": {"^user"}, "priority": {"Low"}}},
+		{"filter removed", ReplicationConfig{}, url.Values{"filterExpression": {""}}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var path string
+			var form url.Values
+			node, stop := testNode(t, func(w http.ResponseWriter, r *http.Request) {
+				r.ParseForm()
+				path, form = r.URL.EscapedPath(), r.PostForm
+			})
+			defer stop()
+
+			err := node.UpdateReplication(context.Background(), "abc/src/dst", test.replication)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if path != "/settings/replications/abc%2Fsrc%2Fdst" {
+				t.Fatalf("unexpected path %s", path)
+			}
+			if !reflect.DeepEqual(form, test.want) {
+				t.Fatalf("expected form %v, got %v", test.want, form)
+			}
+		})
+	}
+}
@@ -0,0 +1,237 @@
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	CounterType = "counter"
+	GaugeType   = "gauge"
+	SummaryType = "summary"
+)
+
+// Labels are the label pairs of a single sample.
+type Labels map[string]string
+
+// Collector is called before every scrape to refresh gauges whose values are
+// read from elsewhere rather than recorded as they change.
+type Collector func(registry *Registry)
+
+// Registry holds metric families and renders them in the prometheus text
+// exposition format.
+type Registry struct {
+	mutex      sync.Mutex
+	families   map[string]*family
+	collectors []Collector
+}
+
+type family struct {
+	name    string
+	help    string
+	kind    string
+	samples map[string]*sample
+}
+
+type sample struct {
+	labels string
+	value  float64
+	sum    float64
+	count  uint64
+}
+
+// Default is the registry served on /metrics.
+var Default = NewRegistry()
+
+func NewRegistry() *Registry {
+	return &Registry{
+		families: make(map[string]*family),
+	}
+}
+
+func (registry *Registry) Counter(name string, help string) {
+	registry.describe(name, help, CounterType)
+}
+
+func (registry *Registry) Gauge(name string, help string) {
+	registry.describe(name, help, GaugeType)
+}
+
+// Summary describes a metric observed through Observe, only its sum and count
+// are exposed.
+func (registry *Registry) Summary(name string, help string) {
+	registry.describe(name, help, SummaryType)
+}
+
+// Collect adds a collector run before every scrape.
+func (registry *Registry) Collect(collector Collector) {
+	registry.mutex.Lock()
+	defer registry.mutex.Unlock()
+	registry.collectors = append(registry.collectors, collector)
+}
+
+// Add increments a counter.
+func (registry *Registry) Add(name string, labels Labels, value float64) {
+	registry.mutex.Lock()
+	defer registry.mutex.Unlock()
+	registry.sample(name, CounterType, labels).value += value
+}
+
+// Set sets the value of a gauge.
+func (registry *Registry) Set(name string, labels Labels, value float64) {
+	registry.mutex.Lock()
+	defer registry.mutex.Unlock()
+	registry.sample(name, GaugeType, labels).value = value
+}
+
+// Observe records a single observation of a summary.
+func (registry *Registry) Observe(name string, labels Labels, value float64) {
+	registry.mutex.Lock()
+	defer registry.mutex.Unlock()
+	observed := registry.sample(name, SummaryType, labels)
+	observed.sum += value
+	observed.count++
+}
+
+// Reset drops all samples of a metric, collectors use it so that gauges of
+// things which went away are not reported forever.
+func (registry *Registry) Reset(name string) {
+	registry.mutex.Lock()
+	defer registry.mutex.Unlock()
+	if metric, ok := registry.families[name]; ok {
+		metric.samples = make(map[string]*sample)
+	}
+}
+
+// Write runs the collectors and writes every metric in the text format.
+func (registry *Registry) Write(w io.Writer) error {
+	registry.mutex.Lock()
+	collectors := append([]Collector(nil), registry.collectors...)
+	registry.mutex.Unlock()
+
+	for _, collector := range collectors {
+		collector(registry)
+	}
+
+	registry.mutex.Lock()
+	defer registry.mutex.Unlock()
+
+	names := make([]string, 0, len(registry.families))
+	for name := range registry.families {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	buffered := bufio.NewWriter(w)
+	for _, name := range names {
+		registry.families[name].write(buffered)
+	}
+	return buffered.Flush()
+}
+
+func (registry *Registry) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	registry.Write(w)
+}
+
+func (registry *Registry) describe(name string, help string, kind string) {
+	registry.mutex.Lock()
+	defer registry.mutex.Unlock()
+
+	metric, ok := registry.families[name]
+	if !ok {
+		metric = &family{name: name, samples: make(map[string]*sample)}
+		registry.families[name] = metric
+	}
+	metric.help = help
+	metric.kind = kind
+}
+
+// sample returns the sample of name with labels, metrics used without being
+// described first get the kind of their first use.
+func (registry *Registry) sample(name string, kind string, labels Labels) *sample {
+	metric, ok := registry.families[name]
+	if !ok {
+		metric = &family{name: name, kind: kind, samples: make(map[string]*sample)}
+		registry.families[name] = metric
+	}
+
+	key := formatLabels(labels)
+	found, ok := metric.samples[key]
+	if !ok {
+		found = &sample{labels: key}
+		metric.samples[key] = found
+	}
+	return found
+}
+
+func (metric *family) write(w io.Writer) {
+	if metric.help != "" {
+		fmt.Fprintf(w, "# HELP %s %s\n", metric.name, escapeHelp(metric.help))
+	}
+	fmt.Fprintf(w, "# TYPE %s %s\n", metric.name, metric.kind)
+
+	keys := make([]string, 0, len(metric.samples))
+	for key := range metric.samples {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		written := metric.samples[key]
+		if metric.kind == SummaryType {
+			fmt.Fprintf(w, "%s_sum%s %s\n", metric.name, written.labels, formatValue(written.sum))
+			fmt.Fprintf(w, "%s_count%s %d\n", metric.name, written.labels, written.count)
+			continue
+		}
+		fmt.Fprintf(w, "%s%s %s\n", metric.name, written.labels, formatValue(written.value))
+	}
+}
+
+func formatLabels(labels Labels) string {
+	if len(labels) == 0 {
+		return ""
+	}
+
+	names := make([]string, 0, len(labels))
+	for name := range labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	pairs := make([]string, 0, len(names))
+	for _, name := range names {
+		pairs = append(pairs, fmt.Sprintf("%s=\"%s\"", name, escapeLabel(labels[name])))
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+func formatValue(value float64) string {
+	switch {
+	case math.IsInf(value, 1):
+		return "+Inf"
+	case math.IsInf(value, -1):
+		return "-Inf"
+	case math.IsNaN(value):
+		return "NaN"
+	}
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+var helpEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+
+func escapeLabel(value string) string {
+	return labelEscaper.Replace(value)
+}
+
+func escapeHelp(value string) string {
+	return helpEscaper.Replace(value)
+}
@@ -0,0 +1,101 @@
+package metrics
+
+import (
+	"bytes"
+	"math"
+	"testing"
+)
+
+func TestWrite(t *testing.T) {
+	tests := []struct {
+		name   string
+		record func(registry *Registry)
+		want   string
+	}{
+		{
+			name: "counter with labels",
+			record: func(registry *Registry) {
+				registry.Counter("requests_total", "Requests served.")
+				registry.Add("requests_total", Labels{"path": "/b", "code": "200"}, 1)
+				registry.Add("requests_total", Labels{"path": "/a", "code": "200"}, 2)
+				registry.Add("requests_total", Labels{"code": "200", "path": "/a"}, 1)
+			},
+			want: "# HELP requests_total Requests served.\n" +
+				"# TYPE requests_total counter\n" +
+				"requests_total{code=\"200\",path=\"/a\"} 3\n" +
+				"requests_total{code=\"200\",path=\"/b\"} 1\n",
+		},
+		{
+			name: "families sorted by name",
+			record: func(registry *Registry) {
+				registry.Gauge("b", "")
+				registry.Set("b", nil, 1.5)
+				registry.Gauge("a", "")
+				registry.Set("a", nil, 2)
+				registry.Set("a", nil, 3)
+			},
+			want: "# TYPE a gauge\na 3\n# TYPE b gauge\nb 1.5\n",
+		},
+		{
+			name: "summary exposes sum and count",
+			record: func(registry *Registry) {
+				registry.Summary("latency_seconds", "Latency.")
+				registry.Observe("latency_seconds", Labels{"op": "get"}, 0.25)
+				registry.Observe("latency_seconds", Labels{"op": "get"}, 0.5)
+			},
+			want: "# HELP latency_seconds Latency.\n" +
+				"# TYPE latency_seconds summary\n" +
+				"latency_seconds_sum{op=\"get\"} 0.75\n" +
+				"latency_seconds_count{op=\"get\"} 2\n",
+		},
+		{
+			name: "escaping",
+			record: func(registry *Registry) {
+				registry.Gauge("escaped", "a \\ and\na newline")
+				registry.Set("escaped", Labels{"value": "say \"hi\"\\\n"}, 1)
+			},
+			want: "# HELP escaped a \\\\ and\\na newline\n" +
+				"# TYPE escaped gauge\n" +
+				"escaped{value=\"say \\\"hi\\\"\\\\\\n\"} 1\n",
+		},
+		{
+			name: "special values",
+			record: func(registry *Registry) {
+				registry.Set("special", Labels{"v": "inf"}, math.Inf(1))
+				registry.Set("special", Labels{"v": "minf"}, math.Inf(-1))
+				registry.Set("special", Labels{"v": "nan"}, math.NaN())
+			},
+			want: "# TYPE special gauge\n" +
+				"special{v=\"inf\"} +Inf\n" +
+				"special{v=\"minf\"} -Inf\n" +
+				"special{v=\"nan\"} NaN\n",
+		},
+		{
+			name: "collectors run before writing and reset drops samples",
+			record: func(registry *Registry) {
+				registry.Gauge("members", "")
+				registry.Set("members", Labels{"name": "gone"}, 1)
+				registry.Collect(func(registry *Registry) {
+					registry.Reset("members")
+					registry.Set("members", Labels{"name": "a"}, 1)
+				})
+			},
+			want: "# TYPE members gauge\nmembers{name=\"a\"} 1\n",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			registry := NewRegistry()
+			test.record(registry)
+
+			var out bytes.Buffer
+			if err := registry.Write(&out); err != nil {
+				t.Fatal(err)
+			}
+			if out.String() != test.want {
+				t.Fatalf("expected\n%s\ngot\n%s", test.want, out.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,92 @@
+package monitor
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Evaluator turns samples into alert events. It remembers since when a rule
+// has been breached, the firing alerts themselves are passed in by the caller
+// from the replicated state.
+type Evaluator struct {
+	mutex    sync.Mutex
+	rules    []Rule
+	breached map[string]time.Time
+}
+
+func NewEvaluator(rules []Rule) *Evaluator {
+	return &Evaluator{
+		rules:    rules,
+		breached: make(map[string]time.Time),
+	}
+}
+
+// Evaluate compares samples with the rules and returns an event for every
+// alert that fires or resolves. Alerts in firing are not fired again, and
+// are only resolved once a sample of their subject no longer breaches the
+// rule, so subjects that stopped reporting stay firing.
+func (evaluator *Evaluator) Evaluate(samples []Sample, firing map[string]Alert, now time.Time) []Event {
+	evaluator.mutex.Lock()
+	defer evaluator.mutex.Unlock()
+
+	events := make([]Event, 0)
+	seen := make(map[string]bool)
+
+	for _, rule := range evaluator.rules {
+		for _, sample := range samples {
+			if !rule.Matches(sample) {
+				continue
+			}
+
+			id := alertID(rule, sample.Subject)
+			seen[id] = true
+			active, isFiring := firing[id]
+
+			if !rule.Breached(sample.Value) {
+				delete(evaluator.breached, id)
+				if isFiring {
+					active.Status = AlertResolved
+					active.Value = sample.Value
+					active.Resolved = now
+					active.Message = fmt.Sprintf("%s of %s %s is back at %g", rule.Metric, rule.Scope, sample.Subject, sample.Value)
+					events = append(events, Event{Type: AlertCleared, Alert: active, Time: now})
+				}
+				continue
+			}
+
+			since, ok := evaluator.breached[id]
+			if !ok {
+				since = now
+				evaluator.breached[id] = since
+			}
+
+			if isFiring || now.Sub(since) < rule.For {
+				continue
+			}
+
+			alert := Alert{
+				ID:        id,
+				Rule:      rule.Name,
+				Metric:    rule.Metric,
+				Scope:     rule.Scope,
+				Subject:   sample.Subject,
+				Severity:  rule.Severity,
+				Value:     sample.Value,
+				Threshold: rule.Threshold,
+				Status:    AlertFiring,
+				Message:   fmt.Sprintf("%s of %s %s is %g, %s %g", rule.Metric, rule.Scope, sample.Subject, sample.Value, rule.Operator, rule.Threshold),
+				Fired:     now,
+			}
+			events = append(events, Event{Type: AlertFired, Alert: alert, Time: now})
+		}
+	}
+
+	for id := range evaluator.breached {
+		if !seen[id] {
+			delete(evaluator.breached, id)
+		}
+	}
+
+	return events
+}
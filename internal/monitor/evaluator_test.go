@@ -0,0 +1,140 @@
+package monitor
+
+import (
+	"testing"
+	"time"
+)
+
+func TestEvaluate(t *testing.T) {
+	start := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+	rule := Rule{Name: "hot", Metric: OpsPerSec, Scope: BucketScope, Operator: ">", Threshold: 100, For: 2 * time.Minute, Severity: "warning"}
+	sample := func(subject string, value float64) Sample {
+		return Sample{Metric: OpsPerSec, Scope: BucketScope, Subject: subject, Value: value}
+	}
+
+	type step struct {
+		after   time.Duration
+		samples []Sample
+		events  []string
+	}
+
+	tests := []struct {
+		name  string
+		rules []Rule
+		steps []step
+	}{
+		{
+			name:  "fires after the rule held for its duration",
+			rules: []Rule{rule},
+			steps: []step{
+				{0, []Sample{sample("default", 150)}, nil},
+				{time.Minute, []Sample{sample("default", 150)}, nil},
+				{2 * time.Minute, []Sample{sample("default", 150)}, []string{AlertFired + " hot/default"}},
+				{3 * time.Minute, []Sample{sample("default", 150)}, nil},
+			},
+		},
+		{
+			name:  "a good sample restarts the duration",
+			rules: []Rule{rule},
+			steps: []step{
+				{0, []Sample{sample("default", 150)}, nil},
+				{time.Minute, []Sample{sample("default", 50)}, nil},
+				{2 * time.Minute, []Sample{sample("default", 150)}, nil},
+				{4 * time.Minute, []Sample{sample("default", 150)}, []string{AlertFired + " hot/default"}},
+			},
+		},
+		{
+			name:  "resolves once the subject recovers",
+			rules: []Rule{rule},
+			steps: []step{
+				{0, []Sample{sample("default", 150)}, nil},
+				{2 * time.Minute, []Sample{sample("default", 150)}, []string{AlertFired + " hot/default"}},
+				{3 * time.Minute, nil, nil},
+				{4 * time.Minute, []Sample{sample("default", 10)}, []string{AlertCleared + " hot/default"}},
+				{5 * time.Minute, []Sample{sample("default", 10)}, nil},
+			},
+		},
+		{
+			name:  "subjects are tracked separately",
+			rules: []Rule{{Name: "now", Metric: OpsPerSec, Scope: BucketScope, Operator: ">=", Threshold: 100}},
+			steps: []step{
+				{0, []Sample{sample("a", 100), sample("b", 99)}, []string{AlertFired + " now/a"}},
+				{time.Minute, []Sample{sample("a", 99), sample("b", 100)}, []string{AlertCleared + " now/a", AlertFired + " now/b"}},
+			},
+		},
+		{
+			name:  "rules limited to a subject ignore others",
+			rules: []Rule{{Name: "one", Metric: OpsPerSec, Scope: BucketScope, Subject: "a", Operator: ">", Threshold: 1}},
+			steps: []step{
+				{0, []Sample{sample("a", 5), sample("b", 5)}, []string{AlertFired + " one/a"}},
+			},
+		},
+		{
+			name:  "samples of another scope do not match",
+			rules: []Rule{{Name: "node", Metric: OpsPerSec, Scope: NodeScope, Operator: ">", Threshold: 1}},
+			steps: []step{
+				{0, []Sample{sample("a", 5)}, nil},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			evaluator := NewEvaluator(test.rules)
+			firing := make(map[string]Alert)
+
+			for i, step := range test.steps {
+				events := evaluator.Evaluate(step.samples, firing, start.Add(step.after))
+
+				got := make([]string, 0, len(events))
+				for _, event := range events {
+					got = append(got, event.Type+" "+event.Alert.ID)
+					if event.Type == AlertFired {
+						firing[event.Alert.ID] = event.Alert
+					} else {
+						delete(firing, event.Alert.ID)
+					}
+				}
+
+				if len(got) != len(step.events) {
+					t.Fatalf("step %d: expected %v, got %v", i, step.events, got)
+				}
+				for j := range got {
+					if got[j] != step.events[j] {
+						t.Fatalf("step %d: expected %v, got %v", i, step.events, got)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestProblems(t *testing.T) {
+	valid := Rule{Name: "a", Metric: OpsPerSec, Scope: NodeScope, Operator: ">"}
+	tests := []struct {
+		name  string
+		rules []Rule
+		paths []string
+	}{
+		{"valid", []Rule{valid}, nil},
+		{"bucket metric on nodes", []Rule{{Name: "a", Metric: ResidentRatio, Scope: NodeScope, Operator: "<"}}, []string{"monitor.rules[0].metric"}},
+		{"node metric on buckets", []Rule{{Name: "a", Metric: CPUUtilization, Scope: BucketScope, Operator: "<"}}, []string{"monitor.rules[0].metric"}},
+		{"everything missing", []Rule{{}}, []string{"monitor.rules[0].name", "monitor.rules[0].metric", "monitor.rules[0].scope", "monitor.rules[0].operator"}},
+		{"duplicate names", []Rule{valid, {Name: "b", Metric: OpsPerSec, Scope: NodeScope, Operator: ">"}, valid}, []string{"monitor.rules[2].name"}},
+		{"negative duration", []Rule{{Name: "a", Metric: OpsPerSec, Scope: NodeScope, Operator: ">", For: -time.Minute}}, []string{"monitor.rules[0].for"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			problems := Config{Rules: test.rules}.Problems("monitor")
+			if len(problems) != len(test.paths) {
+				t.Fatalf("expected problems at %v, got %v", test.paths, problems)
+			}
+			for i, problem := range problems {
+				if problem.Path != test.paths[i] {
+					t.Fatalf("expected problems at %v, got %v", test.paths, problems)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,183 @@
+package monitor
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/devgenie/scout/internal/common"
+)
+
+// Metrics that rules can watch. Node metrics are sampled per couchbase node,
+// bucket metrics per bucket.
+const (
+	OpsPerSec      = "ops_per_sec"
+	ResidentRatio  = "resident_ratio"
+	DiskQueue      = "disk_queue"
+	MemoryUsedMB   = "memory_used_mb"
+	CacheMissRate  = "cache_miss_rate"
+	CPUUtilization = "cpu_utilization"
+)
+
+const (
+	NodeScope   = "node"
+	BucketScope = "bucket"
+)
+
+const (
+	AlertFiring   = "firing"
+	AlertResolved = "resolved"
+)
+
+const (
+	AlertFired   = "alert.fired"
+	AlertCleared = "alert.resolved"
+)
+
+const defaultInterval = time.Minute
+
+// Config is the monitor: section of config.yml. Stats are sampled every
+// Interval by the leader and evaluated against Rules.
+type Config struct {
+	Interval time.Duration `yaml:"interval"`
+	Rules    []Rule        `yaml:"rules"`
+}
+
+// Rule fires when Metric compares to Threshold with Operator for at least
+// For. Scope selects node or bucket samples, Subject limits the rule to a
+// single node or bucket.
+type Rule struct {
+	Name      string        `yaml:"name"`
+	Metric    string        `yaml:"metric"`
+	Scope     string        `yaml:"scope"`
+	Subject   string        `yaml:"subject"`
+	Operator  string        `yaml:"operator"`
+	Threshold float64       `yaml:"threshold"`
+	For       time.Duration `yaml:"for"`
+	Severity  string        `yaml:"severity"`
+}
+
+// Sample is a single value of a metric of a node or bucket.
+type Sample struct {
+	Metric  string
+	Scope   string
+	Subject string
+	Value   float64
+}
+
+// Alert is a rule firing for a subject, the leader replicates firing alerts
+// so a new leader neither fires them again nor forgets to resolve them.
+type Alert struct {
+	ID        string    `json:"id"`
+	Rule      string    `json:"rule"`
+	Metric    string    `json:"metric"`
+	Scope     string    `json:"scope"`
+	Subject   string    `json:"subject"`
+	Severity  string    `json:"severity"`
+	Value     float64   `json:"value"`
+	Threshold float64   `json:"threshold"`
+	Status    string    `json:"status"`
+	Message   string    `json:"message"`
+	Fired     time.Time `json:"fired"`
+	Resolved  time.Time `json:"resolved"`
+}
+
+type Event struct {
+	Type  string
+	Alert Alert
+	Time  time.Time
+}
+
+func (config Config) Enabled() bool {
+	return len(config.Rules) > 0
+}
+
+func (config Config) IntervalOrDefault() time.Duration {
+	if config.Interval > 0 {
+		return config.Interval
+	}
+	return defaultInterval
+}
+
+// Validate reports the first problem with the rules.
+func (config Config) Validate() error {
+	problems := config.Problems("monitor")
+	if len(problems) > 0 {
+		return fmt.Errorf("%s", problems[0])
+	}
+	return nil
+}
+
+// Problems lists every problem with the rules, path is the YAML path of the
+// monitor section.
+func (config Config) Problems(path string) []common.Problem {
+	problems := make([]common.Problem, 0)
+	names := make(map[string]int)
+	for i, rule := range config.Rules {
+		rulePath := fmt.Sprintf("%s.rules[%d]", path, i)
+		problem := func(field string, format string, args ...interface{}) {
+			problems = append(problems, common.Problem{Path: rulePath + "." + field, Message: fmt.Sprintf(format, args...)})
+		}
+
+		if rule.Name == "" {
+			problem("name", "rule has no name")
+		} else if first, ok := names[rule.Name]; ok {
+			problem("name", "rule %q is already declared at %s.rules[%d]", rule.Name, path, first)
+		} else {
+			names[rule.Name] = i
+		}
+
+		switch rule.Metric {
+		case OpsPerSec, MemoryUsedMB:
+		case ResidentRatio, DiskQueue, CacheMissRate:
+			if rule.Scope == NodeScope {
+				problem("metric", "%s is a bucket metric", rule.Metric)
+			}
+		case CPUUtilization:
+			if rule.Scope == BucketScope {
+				problem("metric", "%s is a node metric", rule.Metric)
+			}
+		default:
+			problem("metric", "unknown metric %q", rule.Metric)
+		}
+
+		if rule.Scope != NodeScope && rule.Scope != BucketScope {
+			problem("scope", "unknown scope %q, use %s or %s", rule.Scope, NodeScope, BucketScope)
+		}
+
+		switch rule.Operator {
+		case ">", ">=", "<", "<=":
+		default:
+			problem("operator", "unknown operator %q", rule.Operator)
+		}
+
+		if rule.For < 0 {
+			problem("for", "duration %s is negative", rule.For)
+		}
+	}
+	return problems
+}
+
+// Matches reports whether the rule applies to sample.
+func (rule Rule) Matches(sample Sample) bool {
+	return rule.Metric == sample.Metric && rule.Scope == sample.Scope &&
+		(rule.Subject == "" || rule.Subject == sample.Subject)
+}
+
+// Breached reports whether value crosses the threshold of the rule.
+func (rule Rule) Breached(value float64) bool {
+	switch rule.Operator {
+	case ">":
+		return value > rule.Threshold
+	case ">=":
+		return value >= rule.Threshold
+	case "<":
+		return value < rule.Threshold
+	case "<=":
+		return value <= rule.Threshold
+	}
+	return false
+}
+
+func alertID(rule Rule, subject string) string {
+	return rule.Name + "/" + subject
+}
@@ -0,0 +1,65 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"text/template"
+)
+
+const defaultChatTemplate = "[{{upper .Severity}}] {{.Type}} {{.Subject}}: {{.Message}}"
+
+// Chat posts events to incoming webhooks compatible with Slack, which
+// Mattermost accepts as well.
+type Chat struct {
+	config   ChatConfig
+	template *template.Template
+}
+
+type chatMessage struct {
+	Text     string `json:"text"`
+	Channel  string `json:"channel,omitempty"`
+	Username string `json:"username,omitempty"`
+}
+
+func NewChat(config ChatConfig) (*Chat, error) {
+	if config.URL == "" {
+		return nil, fmt.Errorf("chat %s has no url", config.Name)
+	}
+
+	text := config.Template
+	if text == "" {
+		text = defaultChatTemplate
+	}
+
+	parsed, err := parseTemplate(config.Name, text)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Chat{config: config, template: parsed}, nil
+}
+
+func (chat *Chat) Name() string {
+	return chat.config.Name
+}
+
+func (chat *Chat) Notify(ctx context.Context, event Event) error {
+	text, err := render(chat.template, event)
+	if err != nil {
+		return err
+	}
+
+	body, err := json.Marshal(chatMessage{
+		Text:     text,
+		Channel:  chat.config.Channel,
+		Username: chat.config.Username,
+	})
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeoutOrDefault(chat.config.Timeout))
+	defer cancel()
+	return post(ctx, "POST", chat.config.URL, nil, body)
+}
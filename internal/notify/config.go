@@ -0,0 +1,113 @@
+package notify
+
+import (
+	"path"
+	"time"
+)
+
+const (
+	defaultRetries    = 3
+	defaultRatePeriod = time.Minute
+	defaultTimeout    = 10 * time.Second
+)
+
+// Config is the notify: section of config.yml, every entry is a channel
+// events are delivered to.
+type Config struct {
+	Webhooks []WebhookConfig `yaml:"webhooks"`
+	Email    []EmailConfig   `yaml:"email"`
+	Chat     []ChatConfig    `yaml:"chat"`
+}
+
+// Delivery holds the settings shared by all channels. At most RateLimit
+// events are sent per RatePeriod, the others are dropped. A failed delivery
+// is retried Retries times.
+type Delivery struct {
+	Route      Route         `yaml:"route"`
+	RateLimit  int           `yaml:"ratelimit"`
+	RatePeriod time.Duration `yaml:"rateperiod"`
+	Retries    int           `yaml:"retries"`
+}
+
+// Route selects the events sent to a channel, empty lists match everything.
+type Route struct {
+	Events     []string `yaml:"events"`
+	Severities []string `yaml:"severities"`
+}
+
+// WebhookConfig posts events to URL, the body is rendered with Template and
+// must be JSON. Without a template the event itself is sent.
+type WebhookConfig struct {
+	Name     string            `yaml:"name"`
+	URL      string            `yaml:"url"`
+	Method   string            `yaml:"method"`
+	Headers  map[string]string `yaml:"headers"`
+	Template string            `yaml:"template"`
+	Timeout  time.Duration     `yaml:"timeout"`
+	Delivery `yaml:",inline"`
+}
+
+// EmailConfig sends events through the SMTP server at Host, Timeout bounds
+// the whole conversation with the server.
+type EmailConfig struct {
+	Name     string        `yaml:"name"`
+	Host     string        `yaml:"host"`
+	Port     int           `yaml:"port"`
+	Username string        `yaml:"username"`
+	Password string        `yaml:"password"`
+	From     string        `yaml:"from"`
+	To       []string      `yaml:"to"`
+	Subject  string        `yaml:"subject"`
+	Timeout  time.Duration `yaml:"timeout"`
+	Delivery `yaml:",inline"`
+}
+
+// ChatConfig posts events to a Slack or Mattermost incoming webhook.
+type ChatConfig struct {
+	Name     string        `yaml:"name"`
+	URL      string        `yaml:"url"`
+	Channel  string        `yaml:"channel"`
+	Username string        `yaml:"username"`
+	Template string        `yaml:"template"`
+	Timeout  time.Duration `yaml:"timeout"`
+	Delivery `yaml:",inline"`
+}
+
+// Matches reports whether event is routed to the channel.
+func (route Route) Matches(event Event) bool {
+	return matchAny(route.Events, event.Type) && matchAny(route.Severities, event.Severity)
+}
+
+func matchAny(patterns []string, value string) bool {
+	if len(patterns) == 0 {
+		return true
+	}
+
+	for _, pattern := range patterns {
+		if matched, err := path.Match(pattern, value); err == nil && matched {
+			return true
+		}
+	}
+	return false
+}
+
+func (delivery Delivery) retries() int {
+	if delivery.Retries > 0 {
+		return delivery.Retries
+	}
+	return defaultRetries
+}
+
+func (delivery Delivery) ratePeriod() time.Duration {
+	if delivery.RatePeriod > 0 {
+		return delivery.RatePeriod
+	}
+	return defaultRatePeriod
+}
+
+func timeoutOrDefault(timeout time.Duration) time.Duration {
+	if timeout > 0 {
+		return timeout
+	}
+	return defaultTimeout
+}
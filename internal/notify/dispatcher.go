@@ -0,0 +1,226 @@
+package notify
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/devgenie/scout/internal/metrics"
+)
+
+const (
+	queueSize      = 64
+	initialBackoff = time.Second
+	// keptEvents is the number of recent events kept for the admin API.
+	keptEvents = 100
+)
+
+func init() {
+	metrics.Default.Counter("scout_notifications_total", "Events handed to notification channels, by channel and result.")
+}
+
+// Dispatcher routes events to the configured channels. Every channel delivers
+// from its own queue so a slow or failing channel does not hold up others.
+type Dispatcher struct {
+	node        string
+	channels    []*channel
+	mutex       sync.Mutex
+	recent      []Event
+	subscribers map[chan Event]bool
+}
+
+type channel struct {
+	notifier Notifier
+	delivery Delivery
+	queue    chan Event
+	mutex    sync.Mutex
+	sent     []time.Time
+}
+
+// NewDispatcher builds the channels of config, node is the name reported as
+// the origin of events.
+func NewDispatcher(config Config, node string) (*Dispatcher, error) {
+	dispatcher := &Dispatcher{
+		node:        node,
+		subscribers: make(map[chan Event]bool),
+	}
+
+	for _, webhook := range config.Webhooks {
+		notifier, err := NewWebhook(webhook)
+		if err != nil {
+			return nil, err
+		}
+		dispatcher.Add(notifier, webhook.Delivery)
+	}
+
+	for _, email := range config.Email {
+		notifier, err := NewEmail(email)
+		if err != nil {
+			return nil, err
+		}
+		dispatcher.Add(notifier, email.Delivery)
+	}
+
+	for _, chat := range config.Chat {
+		notifier, err := NewChat(chat)
+		if err != nil {
+			return nil, err
+		}
+		dispatcher.Add(notifier, chat.Delivery)
+	}
+
+	return dispatcher, nil
+}
+
+// Add starts delivering routed events to notifier.
+func (dispatcher *Dispatcher) Add(notifier Notifier, delivery Delivery) {
+	added := &channel{
+		notifier: notifier,
+		delivery: delivery,
+		queue:    make(chan Event, queueSize),
+	}
+	dispatcher.channels = append(dispatcher.channels, added)
+	go added.run()
+}
+
+// Notify queues event on every channel it is routed to without waiting for
+// the delivery.
+func (dispatcher *Dispatcher) Notify(event Event) {
+	if event.Time.IsZero() {
+		event.Time = time.Now().UTC()
+	}
+	if event.Node == "" {
+		event.Node = dispatcher.node
+	}
+	if event.Severity == "" {
+		event.Severity = SeverityInfo
+	}
+
+	log.Printf("event %s [%s] %s: %s", event.Type, event.Severity, event.Subject, event.Message)
+	dispatcher.publish(event)
+
+	for _, routed := range dispatcher.channels {
+		if !routed.delivery.Route.Matches(event) {
+			continue
+		}
+
+		if !routed.allow(event.Time) {
+			routed.count("limited")
+			log.Printf("rate limit of %s reached, dropping %s", routed.notifier.Name(), event.Type)
+			continue
+		}
+
+		select {
+		case routed.queue <- event:
+		default:
+			routed.count("dropped")
+			log.Printf("queue of %s is full, dropping %s", routed.notifier.Name(), event.Type)
+		}
+	}
+}
+
+// Recent returns the last events from oldest to newest.
+func (dispatcher *Dispatcher) Recent() []Event {
+	dispatcher.mutex.Lock()
+	defer dispatcher.mutex.Unlock()
+	return append([]Event(nil), dispatcher.recent...)
+}
+
+// Subscribe returns a channel receiving every following event and a function
+// ending the subscription. Subscribers that do not keep up miss events.
+func (dispatcher *Dispatcher) Subscribe() (<-chan Event, func()) {
+	events := make(chan Event, queueSize)
+
+	dispatcher.mutex.Lock()
+	dispatcher.subscribers[events] = true
+	dispatcher.mutex.Unlock()
+
+	cancel := func() {
+		dispatcher.mutex.Lock()
+		defer dispatcher.mutex.Unlock()
+		if dispatcher.subscribers[events] {
+			delete(dispatcher.subscribers, events)
+			close(events)
+		}
+	}
+	return events, cancel
+}
+
+func (dispatcher *Dispatcher) publish(event Event) {
+	dispatcher.mutex.Lock()
+	defer dispatcher.mutex.Unlock()
+
+	dispatcher.recent = append(dispatcher.recent, event)
+	if len(dispatcher.recent) > keptEvents {
+		dispatcher.recent = dispatcher.recent[len(dispatcher.recent)-keptEvents:]
+	}
+
+	for subscriber := range dispatcher.subscribers {
+		select {
+		case subscriber <- event:
+		default:
+		}
+	}
+}
+
+func (routed *channel) run() {
+	for event := range routed.queue {
+		err := routed.deliver(event)
+		if err != nil {
+			routed.count("failed")
+			log.Printf("error notifying %s of %s: %s", routed.notifier.Name(), event.Type, err)
+			continue
+		}
+		routed.count("sent")
+	}
+}
+
+// deliver sends event, retrying failures with a doubling backoff.
+func (routed *channel) deliver(event Event) error {
+	backoff := initialBackoff
+	attempts := 1 + routed.delivery.retries()
+
+	var err error
+	for attempt := 1; attempt <= attempts; attempt++ {
+		err = routed.notifier.Notify(context.Background(), event)
+		if err == nil || attempt == attempts {
+			break
+		}
+
+		log.Printf("error notifying %s, retrying in %s: %s", routed.notifier.Name(), backoff, err)
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+	return err
+}
+
+// allow reports whether the rate limit of the channel lets another event
+// through at now and records it when it does.
+func (routed *channel) allow(now time.Time) bool {
+	if routed.delivery.RateLimit <= 0 {
+		return true
+	}
+
+	routed.mutex.Lock()
+	defer routed.mutex.Unlock()
+
+	window := now.Add(-routed.delivery.ratePeriod())
+	kept := routed.sent[:0]
+	for _, sent := range routed.sent {
+		if sent.After(window) {
+			kept = append(kept, sent)
+		}
+	}
+	routed.sent = kept
+
+	if len(routed.sent) >= routed.delivery.RateLimit {
+		return false
+	}
+	routed.sent = append(routed.sent, now)
+	return true
+}
+
+func (routed *channel) count(result string) {
+	metrics.Default.Add("scout_notifications_total", metrics.Labels{"channel": routed.notifier.Name(), "result": result}, 1)
+}
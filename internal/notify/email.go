@@ -0,0 +1,166 @@
+package notify
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+)
+
+const (
+	defaultSMTPPort     = 25
+	defaultEmailSubject = "[scout] {{.Type}} {{.Subject}}"
+	emailBodyTemplate   = "{{.Message}}\r\n\r\nType: {{.Type}}\r\nSeverity: {{.Severity}}\r\nSubject: {{.Subject}}\r\nNode: {{.Node}}\r\nTime: {{.Time}}\r\n"
+)
+
+// Email sends events over SMTP, authenticating when a username is set.
+type Email struct {
+	config  EmailConfig
+	subject *template.Template
+	body    *template.Template
+}
+
+func NewEmail(config EmailConfig) (*Email, error) {
+	if config.Host == "" || config.From == "" || len(config.To) == 0 {
+		return nil, fmt.Errorf("email %s needs a host, a sender and recipients", config.Name)
+	}
+
+	if config.Port == 0 {
+		config.Port = defaultSMTPPort
+	}
+
+	text := config.Subject
+	if text == "" {
+		text = defaultEmailSubject
+	}
+
+	subject, err := parseTemplate(config.Name, text)
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := parseTemplate(config.Name, emailBodyTemplate)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Email{config: config, subject: subject, body: body}, nil
+}
+
+func (email *Email) Name() string {
+	return email.config.Name
+}
+
+// Notify sends the event as a plain text mail. The connection is closed
+// when ctx is done or the timeout passed, so a stuck server never blocks the
+// channel.
+func (email *Email) Notify(ctx context.Context, event Event) error {
+	subject, err := render(email.subject, event)
+	if err != nil {
+		return err
+	}
+
+	body, err := render(email.body, event)
+	if err != nil {
+		return err
+	}
+
+	headers := []string{
+		"From: " + headerValue(email.config.From),
+		"To: " + headerValue(strings.Join(email.config.To, ", ")),
+		"Subject: " + headerValue(subject),
+		"Date: " + event.Time.Format(time.RFC1123Z),
+		"MIME-Version: 1.0",
+		"Content-Type: text/plain; charset=utf-8",
+	}
+	message := strings.Join(headers, "\r\n") + "\r\n\r\n" + body
+
+	ctx, cancel := context.WithTimeout(ctx, timeoutOrDefault(email.config.Timeout))
+	defer cancel()
+
+	address := net.JoinHostPort(email.config.Host, strconv.Itoa(email.config.Port))
+	err = email.send(ctx, address, []byte(message))
+	if err != nil {
+		return fmt.Errorf("error sending mail through %s : %s", address, err)
+	}
+	return nil
+}
+
+// headerValue keeps a value on its header line, a line break in an event
+// would otherwise let it add headers of its own.
+func headerValue(value string) string {
+	return strings.NewReplacer("\r\n", " ", "\r", " ", "\n", " ").Replace(value)
+}
+
+// send talks SMTP like smtp.SendMail, over a connection bound to ctx.
+func (email *Email) send(ctx context.Context, address string, message []byte) error {
+	dialer := net.Dialer{}
+	conn, err := dialer.DialContext(ctx, "tcp", address)
+	if err != nil {
+		return err
+	}
+
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.Close()
+		case <-done:
+		}
+	}()
+
+	client, err := smtp.NewClient(conn, email.config.Host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer client.Close()
+
+	if ok, _ := client.Extension("STARTTLS"); ok {
+		err = client.StartTLS(&tls.Config{ServerName: email.config.Host})
+		if err != nil {
+			return err
+		}
+	}
+
+	if email.config.Username != "" {
+		err = client.Auth(smtp.PlainAuth("", email.config.Username, email.config.Password, email.config.Host))
+		if err != nil {
+			return err
+		}
+	}
+
+	err = client.Mail(email.config.From)
+	if err != nil {
+		return err
+	}
+	for _, recipient := range email.config.To {
+		err = client.Rcpt(recipient)
+		if err != nil {
+			return err
+		}
+	}
+
+	writer, err := client.Data()
+	if err != nil {
+		return err
+	}
+	_, err = writer.Write(message)
+	if err != nil {
+		return err
+	}
+	err = writer.Close()
+	if err != nil {
+		return err
+	}
+	return client.Quit()
+}
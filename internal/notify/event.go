@@ -0,0 +1,39 @@
+package notify
+
+import (
+	"time"
+)
+
+const (
+	SeverityInfo     = "info"
+	SeverityWarning  = "warning"
+	SeverityCritical = "critical"
+)
+
+// Event types sent to notifiers, routes match them with shell patterns such
+// as "alert.*".
+const (
+	MemberJoined       = "member.joined"
+	MemberLeft         = "member.left"
+	MemberFailed       = "member.failed"
+	FailoverCompleted  = "failover.completed"
+	FailoverFailed     = "failover.failed"
+	RebalanceCompleted = "rebalance.completed"
+	RebalanceFailed    = "rebalance.failed"
+	RebalanceStalled   = "rebalance.stalled"
+	BackupFailed       = "backup.failed"
+	RestoreFailed      = "restore.failed"
+	AlertFired         = "alert.fired"
+	AlertResolved      = "alert.resolved"
+)
+
+// Event is something that happened to the cluster. Subject is the node,
+// bucket or operation it concerns and Node the scout node reporting it.
+type Event struct {
+	Type     string    `json:"type"`
+	Severity string    `json:"severity"`
+	Subject  string    `json:"subject"`
+	Message  string    `json:"message"`
+	Node     string    `json:"node"`
+	Time     time.Time `json:"time"`
+}
@@ -0,0 +1,71 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"text/template"
+)
+
+// Notifier delivers a single event to a channel.
+type Notifier interface {
+	Name() string
+	Notify(ctx context.Context, event Event) error
+}
+
+var templateFuncs = template.FuncMap{
+	"json": func(value interface{}) (string, error) {
+		encoded, err := json.Marshal(value)
+		return string(encoded), err
+	},
+	"upper": strings.ToUpper,
+}
+
+func parseTemplate(name string, text string) (*template.Template, error) {
+	parsed, err := template.New(name).Funcs(templateFuncs).Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing template of %s : %s", name, err)
+	}
+	return parsed, nil
+}
+
+func render(parsed *template.Template, event Event) (string, error) {
+	var rendered bytes.Buffer
+	err := parsed.Execute(&rendered, event)
+	if err != nil {
+		return "", fmt.Errorf("error rendering template of %s : %s", parsed.Name(), err)
+	}
+	return rendered.String(), nil
+}
+
+var httpClient = &http.Client{}
+
+// post sends body to url and fails on non 2xx answers.
+func post(ctx context.Context, method string, url string, headers map[string]string, body []byte) error {
+	req, err := http.NewRequest(method, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+
+	req.Header.Set("Content-Type", "application/json")
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		message, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("%s %s returned %d: %s", method, url, resp.StatusCode, strings.TrimSpace(string(message)))
+	}
+	return nil
+}
@@ -0,0 +1,365 @@
+package notify
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+var testEvent = Event{
+	Type:     RebalanceFailed,
+	Severity: SeverityCritical,
+	Subject:  "rebalance-1",
+	Message:  "rebalance of [a] failed: timeout",
+	Node:     "scout-0",
+	Time:     time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC),
+}
+
+type received struct {
+	method  string
+	headers http.Header
+	body    string
+}
+
+// receiver starts a server answering status and recording the requests.
+func receiver(status int) (*httptest.Server, chan received) {
+	requests := make(chan received, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		requests <- received{method: r.Method, headers: r.Header, body: string(body)}
+		w.WriteHeader(status)
+	}))
+	return server, requests
+}
+
+func TestWebhook(t *testing.T) {
+	tests := []struct {
+		name   string
+		config WebhookConfig
+		status int
+		method string
+		body   string
+		fails  bool
+	}{
+		{
+			name:   "event as json",
+			config: WebhookConfig{Name: "hook"},
+			status: http.StatusOK,
+			method: "POST",
+			body:   `{"type":"rebalance.failed","severity":"critical","subject":"rebalance-1","message":"rebalance of [a] failed: timeout","node":"scout-0","time":"2026-10-18T12:00:00Z"}`,
+		},
+		{
+			name:   "template method and headers",
+			config: WebhookConfig{Name: "hook", Method: "PUT", Template: `{"summary":{{json .Message}}}`, Headers: map[string]string{"X-Token": "t"}},
+			status: http.StatusNoContent,
+			method: "PUT",
+			body:   `{"summary":"rebalance of [a] failed: timeout"}`,
+		},
+		{
+			name:   "error status",
+			config: WebhookConfig{Name: "hook"},
+			status: http.StatusInternalServerError,
+			method: "POST",
+			fails:  true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server, requests := receiver(test.status)
+			defer server.Close()
+
+			config := test.config
+			config.URL = server.URL
+			webhook, err := NewWebhook(config)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			err = webhook.Notify(context.Background(), testEvent)
+			if test.fails != (err != nil) {
+				t.Fatalf("expected failure %t, got %v", test.fails, err)
+			}
+
+			request := <-requests
+			if request.method != test.method {
+				t.Fatalf("expected %s, got %s", test.method, request.method)
+			}
+			if test.body != "" && request.body != test.body {
+				t.Fatalf("expected body\n%s\ngot\n%s", test.body, request.body)
+			}
+			for name, value := range test.config.Headers {
+				if request.headers.Get(name) != value {
+					t.Fatalf("header %s missing", name)
+				}
+			}
+		})
+	}
+}
+
+func TestWebhookRejectsInvalidJSON(t *testing.T) {
+	webhook, err := NewWebhook(WebhookConfig{Name: "hook", URL: "http://127.0.0.1:1", Template: `{"summary": {{.Message}}}`})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := webhook.Notify(context.Background(), testEvent); err == nil || !strings.Contains(err.Error(), "valid JSON") {
+		t.Fatalf("expected a JSON error, got %v", err)
+	}
+}
+
+func TestChat(t *testing.T) {
+	tests := []struct {
+		name   string
+		config ChatConfig
+		want   chatMessage
+	}{
+		{
+			name:   "default template",
+			config: ChatConfig{Name: "chat"},
+			want:   chatMessage{Text: "[CRITICAL] rebalance.failed rebalance-1: rebalance of [a] failed: timeout"},
+		},
+		{
+			name:   "channel, username and template",
+			config: ChatConfig{Name: "chat", Channel: "#ops", Username: "scout", Template: "{{.Node}}: {{.Message}}"},
+			want:   chatMessage{Text: "scout-0: rebalance of [a] failed: timeout", Channel: "#ops", Username: "scout"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server, requests := receiver(http.StatusOK)
+			defer server.Close()
+
+			config := test.config
+			config.URL = server.URL
+			chat, err := NewChat(config)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if err := chat.Notify(context.Background(), testEvent); err != nil {
+				t.Fatal(err)
+			}
+
+			request := <-requests
+			message := chatMessage{}
+			if err := json.Unmarshal([]byte(request.body), &message); err != nil {
+				t.Fatal(err)
+			}
+			if message != test.want {
+				t.Fatalf("expected %+v, got %+v", test.want, message)
+			}
+		})
+	}
+}
+
+// smtpServer accepts a single connection and plays a minimal SMTP server,
+// sending the received message on the returned channel. With silent it
+// accepts the connection and never answers.
+func smtpServer(t *testing.T, silent bool) (net.Listener, chan string) {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	messages := make(chan string, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		if silent {
+			ioutil.ReadAll(conn)
+			return
+		}
+
+		reader := bufio.NewReader(conn)
+		reply := func(line string) { conn.Write([]byte(line + "\r\n")) }
+		reply("220 localhost ready")
+
+		envelope := make([]string, 0)
+		for {
+			line, err := reader.ReadString('\n')
+			if err != nil {
+				return
+			}
+			command := strings.ToUpper(strings.TrimSpace(line))
+
+			switch {
+			case strings.HasPrefix(command, "EHLO"), strings.HasPrefix(command, "HELO"):
+				reply("250 localhost")
+			case strings.HasPrefix(command, "MAIL"), strings.HasPrefix(command, "RCPT"):
+				envelope = append(envelope, strings.TrimSpace(line))
+				reply("250 OK")
+			case command == "DATA":
+				reply("354 go ahead")
+				var data strings.Builder
+				for {
+					line, err := reader.ReadString('\n')
+					if err != nil {
+						return
+					}
+					if line == ".\r\n" {
+						break
+					}
+					data.WriteString(line)
+				}
+				messages <- strings.Join(envelope, "\n") + "\n\n" + data.String()
+				reply("250 queued")
+			case command == "QUIT":
+				reply("221 bye")
+				return
+			default:
+				reply("502 unknown")
+			}
+		}
+	}()
+	return listener, messages
+}
+
+func emailConfig(t *testing.T, listener net.Listener) EmailConfig {
+	t.Helper()
+	host, port, err := net.SplitHostPort(listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	number, _ := strconv.Atoi(port)
+	return EmailConfig{Name: "mail", Host: host, Port: number, From: "scout@example.com", To: []string{"ops@example.com", "dba@example.com"}}
+}
+
+func TestEmail(t *testing.T) {
+	listener, messages := smtpServer(t, false)
+	defer listener.Close()
+
+	email, err := NewEmail(emailConfig(t, listener))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := email.Notify(context.Background(), testEvent); err != nil {
+		t.Fatal(err)
+	}
+
+	message := <-messages
+	for _, want := range []string{
+		"MAIL FROM:<scout@example.com>",
+		"RCPT TO:<ops@example.com>",
+		"RCPT TO:<dba@example.com>",
+		"Subject: [scout] rebalance.failed rebalance-1\r\n",
+		"To: ops@example.com, dba@example.com\r\n",
+		"rebalance of [a] failed: timeout\r\n",
+		"Severity: critical\r\n",
+	} {
+		if !strings.Contains(message, want) {
+			t.Fatalf("message lacks %q:\n%s", want, message)
+		}
+	}
+}
+
+func TestEmailHeaderInjection(t *testing.T) {
+	listener, messages := smtpServer(t, false)
+	defer listener.Close()
+
+	config := emailConfig(t, listener)
+	config.Subject = "[scout] {{.Subject}} {{.Message}}"
+	email, err := NewEmail(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	event := testEvent
+	event.Subject = "rebalance-1\rBcc: a@example.com"
+	event.Message = "failed\r\nBcc: b@example.com\nX-Injected: yes"
+	if err := email.Notify(context.Background(), event); err != nil {
+		t.Fatal(err)
+	}
+
+	message := <-messages
+	headers := strings.SplitN(strings.SplitN(message, "\n\n", 2)[1], "\r\n\r\n", 2)[0]
+	for _, line := range strings.Split(headers, "\r\n") {
+		if strings.ContainsAny(line, "\r\n") || strings.HasPrefix(line, "Bcc:") || strings.HasPrefix(line, "X-Injected:") {
+			t.Fatalf("event added a header:\n%s", headers)
+		}
+	}
+	if !strings.Contains(headers, "Subject: [scout] rebalance-1 Bcc: a@example.com failed Bcc: b@example.com X-Injected: yes\r\n") {
+		t.Fatalf("expected the subject on a single line:\n%s", headers)
+	}
+}
+
+func TestEmailTimesOut(t *testing.T) {
+	listener, _ := smtpServer(t, true)
+	defer listener.Close()
+
+	config := emailConfig(t, listener)
+	config.Timeout = 200 * time.Millisecond
+	email, err := NewEmail(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	started := time.Now()
+	err = email.Notify(context.Background(), testEvent)
+	if err == nil {
+		t.Fatal("expected an error from a silent server")
+	}
+	if elapsed := time.Since(started); elapsed > 5*time.Second {
+		t.Fatalf("notify took %s despite the timeout", elapsed)
+	}
+}
+
+func TestEmailStopsWithContext(t *testing.T) {
+	listener, _ := smtpServer(t, true)
+	defer listener.Close()
+
+	email, err := NewEmail(emailConfig(t, listener))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		cancel()
+	}()
+
+	started := time.Now()
+	if err := email.Notify(ctx, testEvent); err == nil {
+		t.Fatal("expected an error once the context was cancelled")
+	}
+	if elapsed := time.Since(started); elapsed > 5*time.Second {
+		t.Fatalf("notify took %s after the context was cancelled", elapsed)
+	}
+}
+
+func TestRouteMatches(t *testing.T) {
+	tests := []struct {
+		name    string
+		route   Route
+		matches bool
+	}{
+		{"empty route", Route{}, true},
+		{"pattern", Route{Events: []string{"rebalance.*"}}, true},
+		{"other events", Route{Events: []string{"alert.*", "backup.failed"}}, false},
+		{"severity", Route{Severities: []string{SeverityWarning, SeverityCritical}}, true},
+		{"other severity", Route{Events: []string{"*"}, Severities: []string{SeverityInfo}}, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if matches := test.route.Matches(testEvent); matches != test.matches {
+				t.Fatalf("expected %t, got %t", test.matches, matches)
+			}
+		})
+	}
+}
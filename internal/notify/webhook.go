@@ -0,0 +1,58 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"text/template"
+)
+
+const defaultWebhookTemplate = "{{json .}}"
+
+type Webhook struct {
+	config   WebhookConfig
+	template *template.Template
+}
+
+func NewWebhook(config WebhookConfig) (*Webhook, error) {
+	if config.URL == "" {
+		return nil, fmt.Errorf("webhook %s has no url", config.Name)
+	}
+
+	if config.Method == "" {
+		config.Method = "POST"
+	}
+
+	text := config.Template
+	if text == "" {
+		text = defaultWebhookTemplate
+	}
+
+	parsed, err := parseTemplate(config.Name, text)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Webhook{config: config, template: parsed}, nil
+}
+
+func (webhook *Webhook) Name() string {
+	return webhook.config.Name
+}
+
+func (webhook *Webhook) Notify(ctx context.Context, event Event) error {
+	body, err := render(webhook.template, event)
+	if err != nil {
+		return err
+	}
+
+	// A template producing broken JSON would fail on every event, it is
+	// caught here rather than by the receiving end.
+	if !json.Valid([]byte(body)) {
+		return fmt.Errorf("template of webhook %s did not render valid JSON", webhook.config.Name)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeoutOrDefault(webhook.config.Timeout))
+	defer cancel()
+	return post(ctx, webhook.config.Method, webhook.config.URL, webhook.config.Headers, []byte(body))
+}
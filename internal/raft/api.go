@@ -0,0 +1,720 @@
+package raft
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/devgenie/scout/internal/backup"
+	"github.com/devgenie/scout/internal/couchbase"
+	"github.com/devgenie/scout/internal/monitor"
+	"github.com/devgenie/scout/internal/notify"
+	"github.com/hashicorp/serf/serf"
+)
+
+const (
+	apiTimeout = 10 * time.Second
+	// forwardedHeader marks requests a follower forwarded to the leader, a
+	// node that is no longer the leader refuses them instead of forwarding
+	// them again.
+	forwardedHeader = "X-Scout-Forwarded"
+)
+
+var forwardClient = &http.Client{
+	Timeout: 30 * time.Second,
+}
+
+// streamClient forwards event streams, which last as long as their caller.
+var streamClient = &http.Client{}
+
+type apiError struct {
+	Error string `json:"error"`
+}
+
+type clusterView struct {
+	Leader        string                       `json:"leader"`
+	RaftState     string                       `json:"raftState"`
+	Nodes         map[string]int               `json:"nodes"`
+	Buckets       int                          `json:"buckets"`
+	Settings      map[string]string            `json:"settings"`
+	Rebalance     *couchbase.RebalanceProgress `json:"rebalance,omitempty"`
+	LastReconcile *ReconcileResult             `json:"lastReconcile,omitempty"`
+	Alerts        []monitor.Alert              `json:"alerts"`
+	Errors        []string                     `json:"errors,omitempty"`
+}
+
+type nodeView struct {
+	Name       string    `json:"name"`
+	Address    string    `json:"address"`
+	Services   []string  `json:"services"`
+	Zone       string    `json:"zone,omitempty"`
+	MemoryMB   int       `json:"memoryMB,omitempty"`
+	Status     string    `json:"status"`
+	Serf       string    `json:"serf,omitempty"`
+	OTPNode    string    `json:"otpNode,omitempty"`
+	Membership string    `json:"membership,omitempty"`
+	Health     string    `json:"health,omitempty"`
+	Updated    time.Time `json:"updated"`
+}
+
+type bucketView struct {
+	couchbase.BucketConfig
+	Declared bool                   `json:"declared"`
+	Stats    *couchbase.BucketStats `json:"stats,omitempty"`
+}
+
+type raftServer struct {
+	ID       string `json:"id"`
+	Address  string `json:"address"`
+	Suffrage string `json:"suffrage"`
+}
+
+type raftView struct {
+	State   string            `json:"state"`
+	Leader  string            `json:"leader"`
+	Stats   map[string]string `json:"stats"`
+	Servers []raftServer      `json:"servers"`
+}
+
+type backupRequest struct {
+	Kind string `json:"kind"`
+}
+
+// bucketUpdate holds the settings a PUT changes, settings left out keep
+// their current value.
+type bucketUpdate struct {
+	RAMQuotaMB      *int    `json:"ramQuotaMB"`
+	ReplicaNumber   *int    `json:"replicas"`
+	EvictionPolicy  *string `json:"evictionPolicy"`
+	FlushEnabled    *bool   `json:"flushEnabled"`
+	CompressionMode *string `json:"compressionMode"`
+}
+
+type operationRequest struct {
+	Type     string `json:"type"`
+	Node     string `json:"node"`
+	Graceful bool   `json:"graceful"`
+}
+
+// apiHandler serves the versioned admin API. Every request needs the
+// couchbase admin credentials or the API token. Reads are answered by any
+// node, mutations are forwarded to the leader with the API token, which the
+// leader checks again.
+func (node *RaftNode) apiHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1/cluster", node.handleCluster)
+	mux.HandleFunc("/v1/nodes", node.handleNodes)
+	mux.HandleFunc("/v1/buckets", node.handleBuckets)
+	mux.HandleFunc("/v1/buckets/", node.handleBucket)
+	mux.HandleFunc("/v1/raft", node.handleRaft)
+	mux.HandleFunc("/v1/operations", node.handleOperations)
+	mux.HandleFunc("/v1/operations/", node.handleOperation)
+	mux.HandleFunc("/v1/backups", node.handleBackups)
+	mux.HandleFunc("/v1/backups/", node.handleBackup)
+	mux.HandleFunc("/v1/events", node.handleEvents)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !node.authorized(r) {
+			w.Header().Set("WWW-Authenticate", `Basic realm="scout"`)
+			writeError(w, http.StatusUnauthorized, fmt.Errorf("valid credentials are required"))
+			return
+		}
+
+		if r.Method != "GET" && r.Method != "HEAD" && !node.IsLeader() {
+			node.forwardToLeader(w, r, forwardClient)
+			return
+		}
+		mux.ServeHTTP(w, r)
+	})
+}
+
+// authorized checks the basic auth credentials against the couchbase admin
+// of the config, or a bearer token against the API token when one is set.
+func (node *RaftNode) authorized(r *http.Request) bool {
+	if username, password, ok := r.BasicAuth(); ok {
+		return node.config.Username != "" &&
+			subtle.ConstantTimeCompare([]byte(username), []byte(node.config.Username)) == 1 &&
+			subtle.ConstantTimeCompare([]byte(password), []byte(node.config.Password)) == 1
+	}
+
+	header := r.Header.Get("Authorization")
+	if token := strings.TrimPrefix(header, "Bearer "); token != header && node.config.APIToken != "" {
+		return subtle.ConstantTimeCompare([]byte(token), []byte(node.config.APIToken)) == 1
+	}
+	return false
+}
+
+func (node *RaftNode) handleCluster(w http.ResponseWriter, r *http.Request) {
+	if !allowMethods(w, r, "GET") {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), apiTimeout)
+	defer cancel()
+
+	state := node.fsm.State()
+	view := clusterView{
+		Leader:        string(node.store.raft.Leader()),
+		RaftState:     node.store.raft.State().String(),
+		Nodes:         make(map[string]int),
+		Buckets:       len(state.Buckets),
+		Settings:      state.Settings,
+		LastReconcile: node.LastReconcile(),
+		Alerts:        make([]monitor.Alert, 0, len(state.Alerts)),
+	}
+
+	for _, member := range state.Nodes {
+		view.Nodes[member.Status]++
+	}
+
+	for _, alert := range state.Alerts {
+		view.Alerts = append(view.Alerts, alert)
+	}
+	sort.Slice(view.Alerts, func(i, j int) bool {
+		return view.Alerts[i].ID < view.Alerts[j].ID
+	})
+
+	progress, err := node.couchbaseNode.RebalanceStatus(ctx)
+	if err != nil {
+		view.Errors = append(view.Errors, err.Error())
+	} else {
+		view.Rebalance = &progress
+	}
+
+	writeJSON(w, http.StatusOK, view)
+}
+
+func (node *RaftNode) handleNodes(w http.ResponseWriter, r *http.Request) {
+	if !allowMethods(w, r, "GET") {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), apiTimeout)
+	defer cancel()
+
+	serfStatus := make(map[string]serf.MemberStatus)
+	for _, member := range node.serfScout.Members() {
+		serfStatus[member.Name] = member.Status
+	}
+
+	// Live membership is best effort, the replicated view is still useful
+	// while couchbase is unreachable.
+	members, _ := node.couchbaseNode.Nodes(ctx)
+
+	views := make([]nodeView, 0)
+	for _, state := range node.fsm.State().Nodes {
+		view := nodeView{
+			Name:     state.Name,
+			Address:  state.Address,
+			Services: state.Services,
+			Zone:     state.Zone,
+			MemoryMB: state.MemoryMB,
+			Status:   state.Status,
+			Updated:  state.Updated,
+		}
+
+		if status, ok := serfStatus[state.Name]; ok {
+			view.Serf = status.String()
+		}
+
+		for _, member := range members {
+			if member.Matches(state.Name) || member.Matches(state.Address) {
+				view.OTPNode = member.OTPNode
+				view.Membership = member.ClusterMembership
+				view.Health = member.Status
+				break
+			}
+		}
+		views = append(views, view)
+	}
+
+	sort.Slice(views, func(i, j int) bool {
+		return views[i].Name < views[j].Name
+	})
+	writeJSON(w, http.StatusOK, views)
+}
+
+func (node *RaftNode) handleBuckets(w http.ResponseWriter, r *http.Request) {
+	if !allowMethods(w, r, "GET", "POST") {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), apiTimeout)
+	defer cancel()
+
+	if r.Method == "POST" {
+		bucket := couchbase.BucketConfig{}
+		if !readJSON(w, r, &bucket) {
+			return
+		}
+
+		bucket.SetDefaults()
+		if problems := bucket.Problems("bucket"); len(problems) > 0 {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("%s", problems[0].Message))
+			return
+		}
+		if node.declaredBucket(bucket.Name) {
+			writeError(w, http.StatusConflict, fmt.Errorf("bucket %s is declared in the config, change it there", bucket.Name))
+			return
+		}
+
+		err := node.couchbaseNode.AddBucket(ctx, bucket)
+		if err != nil {
+			writeError(w, statusOf(err), err)
+			return
+		}
+		writeJSON(w, http.StatusCreated, bucket)
+		return
+	}
+
+	buckets, err := node.couchbaseNode.Buckets(ctx)
+	if err != nil {
+		writeError(w, http.StatusBadGateway, err)
+		return
+	}
+
+	stats := make(map[string]couchbase.BucketStats)
+	bucketStats, err := node.couchbaseNode.BucketStats(ctx)
+	if err == nil {
+		for _, bucket := range bucketStats {
+			stats[bucket.Name] = bucket
+		}
+	}
+
+	views := make([]bucketView, 0, len(buckets))
+	for _, bucket := range buckets {
+		view := bucketView{BucketConfig: bucket, Declared: node.declaredBucket(bucket.Name)}
+		if bucket, ok := stats[bucket.Name]; ok {
+			view.Stats = &bucket
+		}
+		views = append(views, view)
+	}
+
+	sort.Slice(views, func(i, j int) bool {
+		return views[i].Name < views[j].Name
+	})
+	writeJSON(w, http.StatusOK, views)
+}
+
+// handleBucket changes or deletes a bucket that is not declared in the
+// config, declared buckets are owned by the reconcile loop.
+func (node *RaftNode) handleBucket(w http.ResponseWriter, r *http.Request) {
+	if !allowMethods(w, r, "PUT", "DELETE") {
+		return
+	}
+
+	name := strings.TrimPrefix(r.URL.Path, "/v1/buckets/")
+	if name == "" || strings.Contains(name, "/") {
+		writeError(w, http.StatusNotFound, fmt.Errorf("unknown path %s", r.URL.Path))
+		return
+	}
+
+	if node.declaredBucket(name) {
+		writeError(w, http.StatusConflict, fmt.Errorf("bucket %s is declared in the config, change it there", name))
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), apiTimeout)
+	defer cancel()
+
+	if r.Method == "DELETE" {
+		force, _ := strconv.ParseBool(r.URL.Query().Get("force"))
+		err := node.couchbaseNode.DeleteBucket(ctx, name, force)
+		if err != nil {
+			writeError(w, statusOf(err), err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	update := bucketUpdate{}
+	if !readJSON(w, r, &update) {
+		return
+	}
+
+	bucket, err := node.couchbaseNode.Bucket(ctx, name)
+	if err != nil {
+		writeError(w, statusOf(err), err)
+		return
+	}
+
+	bucket = update.apply(bucket)
+	if problems := bucket.Problems("bucket"); len(problems) > 0 {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("%s", problems[0].Message))
+		return
+	}
+
+	err = node.couchbaseNode.UpdateBucket(ctx, bucket)
+	if err != nil {
+		writeError(w, statusOf(err), err)
+		return
+	}
+	writeJSON(w, http.StatusOK, bucket)
+}
+
+func (node *RaftNode) handleRaft(w http.ResponseWriter, r *http.Request) {
+	if !allowMethods(w, r, "GET") {
+		return
+	}
+
+	view := raftView{
+		State:   node.store.raft.State().String(),
+		Leader:  string(node.store.raft.Leader()),
+		Stats:   node.store.raft.Stats(),
+		Servers: make([]raftServer, 0),
+	}
+
+	future := node.store.raft.GetConfiguration()
+	if err := future.Error(); err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	for _, server := range future.Configuration().Servers {
+		view.Servers = append(view.Servers, raftServer{
+			ID:       string(server.ID),
+			Address:  string(server.Address),
+			Suffrage: server.Suffrage.String(),
+		})
+	}
+
+	writeJSON(w, http.StatusOK, view)
+}
+
+func (node *RaftNode) handleOperations(w http.ResponseWriter, r *http.Request) {
+	if !allowMethods(w, r, "GET", "POST") {
+		return
+	}
+
+	if r.Method == "POST" {
+		request := operationRequest{}
+		if !readJSON(w, r, &request) {
+			return
+		}
+
+		var err error
+		switch request.Type {
+		case "rebalance":
+			err = node.RebalanceNow()
+		case "failover":
+			if request.Node == "" {
+				err = fmt.Errorf("a failover needs a node")
+				break
+			}
+			err = node.FailoverNode(request.Node, request.Graceful)
+		default:
+			writeError(w, http.StatusBadRequest, fmt.Errorf("unknown operation %q", request.Type))
+			return
+		}
+
+		if err != nil {
+			writeError(w, http.StatusConflict, err)
+			return
+		}
+		writeJSON(w, http.StatusAccepted, request)
+		return
+	}
+
+	operations := make([]Operation, 0)
+	for _, operation := range node.fsm.State().Operations {
+		operations = append(operations, operation)
+	}
+
+	sort.Slice(operations, func(i, j int) bool {
+		return operations[i].Created.After(operations[j].Created)
+	})
+	writeJSON(w, http.StatusOK, operations)
+}
+
+func (node *RaftNode) handleOperation(w http.ResponseWriter, r *http.Request) {
+	if !allowMethods(w, r, "GET") {
+		return
+	}
+
+	id := strings.TrimPrefix(r.URL.Path, "/v1/operations/")
+	operation, ok := node.fsm.State().Operations[id]
+	if !ok {
+		writeError(w, http.StatusNotFound, fmt.Errorf("unknown operation %s", id))
+		return
+	}
+	writeJSON(w, http.StatusOK, operation)
+}
+
+func (node *RaftNode) handleBackups(w http.ResponseWriter, r *http.Request) {
+	if !allowMethods(w, r, "GET", "POST") {
+		return
+	}
+
+	if r.Method == "POST" {
+		request := backupRequest{Kind: backup.Full}
+		if !readJSON(w, r, &request) {
+			return
+		}
+
+		if !node.config.Backup.Enabled {
+			writeError(w, http.StatusConflict, fmt.Errorf("backups are not enabled in the config"))
+			return
+		}
+
+		err := node.BackupNow(request.Kind)
+		if err != nil {
+			writeError(w, http.StatusConflict, err)
+			return
+		}
+		writeJSON(w, http.StatusAccepted, request)
+		return
+	}
+
+	runs := node.backupRuns()
+	// Newest first, like the operations.
+	for i, j := 0, len(runs)-1; i < j; i, j = i+1, j-1 {
+		runs[i], runs[j] = runs[j], runs[i]
+	}
+	writeJSON(w, http.StatusOK, runs)
+}
+
+// handleBackup restores a backup on POST /v1/backups/{id}/restore.
+func (node *RaftNode) handleBackup(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/v1/backups/"), "/")
+	if len(parts) != 2 || parts[0] == "" || parts[1] != "restore" {
+		writeError(w, http.StatusNotFound, fmt.Errorf("unknown path %s", r.URL.Path))
+		return
+	}
+
+	if !allowMethods(w, r, "POST") {
+		return
+	}
+
+	if !node.config.Backup.Enabled {
+		writeError(w, http.StatusConflict, fmt.Errorf("backups are not enabled in the config"))
+		return
+	}
+
+	run, err := node.RestoreBackup(parts[0])
+	if err != nil {
+		status := http.StatusConflict
+		if _, ok := node.fsm.State().Backups[parts[0]]; !ok {
+			status = http.StatusNotFound
+		}
+		writeError(w, status, err)
+		return
+	}
+	writeJSON(w, http.StatusAccepted, run)
+}
+
+// handleEvents answers the recent events, with follow=true it keeps streaming
+// events as JSON lines. Events are raised by the leader, followers forward
+// the request to it.
+func (node *RaftNode) handleEvents(w http.ResponseWriter, r *http.Request) {
+	if !allowMethods(w, r, "GET") {
+		return
+	}
+
+	if !node.IsLeader() {
+		node.forwardToLeader(w, r, streamClient)
+		return
+	}
+
+	follow, _ := strconv.ParseBool(r.URL.Query().Get("follow"))
+	if !follow {
+		events := node.notifier.Recent()
+		if events == nil {
+			events = make([]notify.Event, 0)
+		}
+		writeJSON(w, http.StatusOK, events)
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, fmt.Errorf("streaming is not supported"))
+		return
+	}
+
+	events, cancel := node.notifier.Subscribe()
+	defer cancel()
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	encoder := json.NewEncoder(w)
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case event, ok := <-events:
+			if !ok {
+				return
+			}
+			if encoder.Encode(event) != nil {
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
+
+// forwardToLeader replays a request against the admin API of the leader and
+// copies its answer back as it arrives. The API is served over plain http, so
+// the credentials of the caller are replaced with the API token rather than
+// sent on to the leader, and nothing is forwarded without a token.
+func (node *RaftNode) forwardToLeader(w http.ResponseWriter, r *http.Request, client *http.Client) {
+	if r.Header.Get(forwardedHeader) != "" {
+		writeError(w, http.StatusServiceUnavailable, fmt.Errorf("%s is no longer the leader", node.hostname))
+		return
+	}
+
+	leader := string(node.store.raft.Leader())
+	host, _, err := net.SplitHostPort(leader)
+	if leader == "" || err != nil {
+		writeError(w, http.StatusServiceUnavailable, fmt.Errorf("no raft leader"))
+		return
+	}
+
+	if node.config.APIToken == "" {
+		writeError(w, http.StatusServiceUnavailable, fmt.Errorf("%s is not the leader and forwarding needs an API token, send the request to the leader %s", node.hostname, host))
+		return
+	}
+
+	req, err := node.leaderRequest(r, host)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		writeError(w, http.StatusBadGateway, fmt.Errorf("error forwarding to leader %s : %s", host, err))
+		return
+	}
+	defer resp.Body.Close()
+
+	for name, values := range resp.Header {
+		for _, value := range values {
+			w.Header().Add(name, value)
+		}
+	}
+	w.WriteHeader(resp.StatusCode)
+
+	flusher, _ := w.(http.Flusher)
+	buffer := make([]byte, 4096)
+	for {
+		read, err := resp.Body.Read(buffer)
+		if read > 0 {
+			if _, writeErr := w.Write(buffer[:read]); writeErr != nil {
+				return
+			}
+			if flusher != nil {
+				flusher.Flush()
+			}
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// leaderRequest copies r for the admin API of the leader on host, with the
+// API token in place of the credentials of the caller.
+func (node *RaftNode) leaderRequest(r *http.Request, host string) (*http.Request, error) {
+	target := fmt.Sprintf("http://%s%s", net.JoinHostPort(host, strconv.Itoa(couchbase.WebServerPort)), r.URL.RequestURI())
+	req, err := http.NewRequest(r.Method, target, r.Body)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(r.Context())
+	for name, values := range r.Header {
+		for _, value := range values {
+			req.Header.Add(name, value)
+		}
+	}
+	req.Header.Set("Authorization", "Bearer "+node.config.APIToken)
+	req.Header.Set(forwardedHeader, node.hostname)
+	return req, nil
+}
+
+func (update bucketUpdate) apply(bucket couchbase.BucketConfig) couchbase.BucketConfig {
+	if update.RAMQuotaMB != nil {
+		bucket.RAMQuotaMB = *update.RAMQuotaMB
+	}
+	if update.ReplicaNumber != nil {
+		bucket.ReplicaNumber = *update.ReplicaNumber
+	}
+	if update.EvictionPolicy != nil {
+		bucket.EvictionPolicy = *update.EvictionPolicy
+	}
+	if update.FlushEnabled != nil {
+		bucket.FlushEnabled = *update.FlushEnabled
+	}
+	if update.CompressionMode != nil {
+		bucket.CompressionMode = *update.CompressionMode
+	}
+	return bucket
+}
+
+// declaredBucket reports whether the bucket is managed through the config.
+func (node *RaftNode) declaredBucket(name string) bool {
+	for _, bucket := range node.config.Buckets {
+		if bucket.Name == name {
+			return true
+		}
+	}
+
+	_, ok := node.fsm.State().Buckets[name]
+	return ok
+}
+
+func allowMethods(w http.ResponseWriter, r *http.Request, methods ...string) bool {
+	for _, method := range methods {
+		if r.Method == method || (r.Method == "HEAD" && method == "GET") {
+			return true
+		}
+	}
+
+	w.Header().Set("Allow", strings.Join(methods, ", "))
+	writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("%s is not allowed on %s", r.Method, r.URL.Path))
+	return false
+}
+
+func readJSON(w http.ResponseWriter, r *http.Request, out interface{}) bool {
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+
+	err := decoder.Decode(out)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("error decoding request : %s", err))
+		return false
+	}
+	return true
+}
+
+func writeJSON(w http.ResponseWriter, status int, value interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(value)
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, apiError{Error: err.Error()})
+}
+
+// statusOf maps errors of couchbase calls to the status answered by the API.
+func statusOf(err error) int {
+	if _, ok := err.(*couchbase.BucketNotEmptyError); ok {
+		return http.StatusConflict
+	}
+
+	if requestErr, ok := err.(*couchbase.Error); ok && requestErr.StatusCode >= 400 && requestErr.StatusCode < 500 {
+		return requestErr.StatusCode
+	}
+	return http.StatusBadGateway
+}
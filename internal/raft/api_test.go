@@ -0,0 +1,131 @@
+package raft
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/devgenie/scout/internal/couchbase"
+)
+
+func TestAPIAuthorization(t *testing.T) {
+	node := &RaftNode{config: couchbase.Config{Username: "admin", Password: "secret", APIToken: "token"}}
+	handler := node.apiHandler()
+
+	tests := []struct {
+		name      string
+		authorize func(req *http.Request)
+		want      int
+	}{
+		{"no credentials", func(req *http.Request) {}, http.StatusUnauthorized},
+		{"wrong password", func(req *http.Request) { req.SetBasicAuth("admin", "wrong") }, http.StatusUnauthorized},
+		{"wrong user", func(req *http.Request) { req.SetBasicAuth("root", "secret") }, http.StatusUnauthorized},
+		{"wrong token", func(req *http.Request) { req.Header.Set("Authorization", "Bearer nope") }, http.StatusUnauthorized},
+		{"token without bearer", func(req *http.Request) { req.Header.Set("Authorization", "token") }, http.StatusUnauthorized},
+		{"admin credentials", func(req *http.Request) { req.SetBasicAuth("admin", "secret") }, http.StatusNotFound},
+		{"api token", func(req *http.Request) { req.Header.Set("Authorization", "Bearer token") }, http.StatusNotFound},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/v1/unknown", nil)
+			test.authorize(req)
+			recorder := httptest.NewRecorder()
+
+			handler.ServeHTTP(recorder, req)
+			if recorder.Code != test.want {
+				t.Fatalf("expected status %d, got %d", test.want, recorder.Code)
+			}
+			if test.want == http.StatusUnauthorized && recorder.Header().Get("WWW-Authenticate") == "" {
+				t.Fatalf("expected a WWW-Authenticate header")
+			}
+		})
+	}
+}
+
+func TestAPIAuthorizationWithoutToken(t *testing.T) {
+	node := &RaftNode{config: couchbase.Config{Username: "admin", Password: "secret"}}
+
+	req := httptest.NewRequest("GET", "/v1/cluster", nil)
+	req.Header.Set("Authorization", "Bearer ")
+	if node.authorized(req) {
+		t.Fatalf("expected an empty token to be refused when no API token is configured")
+	}
+}
+
+func TestLeaderRequest(t *testing.T) {
+	node := &RaftNode{hostname: "b", config: couchbase.Config{Username: "admin", Password: "secret", APIToken: "token"}}
+
+	r := httptest.NewRequest("POST", "/v1/buckets?dry=true", strings.NewReader(`{"name":"a"}`))
+	r.SetBasicAuth("admin", "secret")
+	r.Header.Set("Content-Type", "application/json")
+
+	req, err := node.leaderRequest(r, "10.0.0.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if req.URL.String() != "http://10.0.0.1:8600/v1/buckets?dry=true" {
+		t.Fatalf("unexpected target %s", req.URL)
+	}
+	if _, _, ok := req.BasicAuth(); ok {
+		t.Fatalf("expected the credentials of the caller to stay on the follower")
+	}
+	if got := req.Header["Authorization"]; !reflect.DeepEqual(got, []string{"Bearer token"}) {
+		t.Fatalf("expected the API token, got %v", got)
+	}
+	if req.Header.Get(forwardedHeader) != "b" || req.Header.Get("Content-Type") != "application/json" {
+		t.Fatalf("unexpected headers %v", req.Header)
+	}
+}
+
+func TestBucketUpdateApply(t *testing.T) {
+	quota := 512
+	replicas := 2
+	eviction := "fullEviction"
+	flush := true
+
+	current := couchbase.BucketConfig{
+		Name:            "orders",
+		BucketType:      "couchbase",
+		RAMQuotaMB:      256,
+		ReplicaNumber:   1,
+		EvictionPolicy:  "valueOnly",
+		CompressionMode: "passive",
+	}
+
+	tests := []struct {
+		name   string
+		update bucketUpdate
+		want   couchbase.BucketConfig
+	}{
+		{
+			name:   "empty update keeps every setting",
+			update: bucketUpdate{},
+			want:   current,
+		},
+		{
+			name:   "quota only",
+			update: bucketUpdate{RAMQuotaMB: &quota},
+			want: couchbase.BucketConfig{Name: "orders", BucketType: "couchbase", RAMQuotaMB: 512, ReplicaNumber: 1,
+				EvictionPolicy: "valueOnly", CompressionMode: "passive"},
+		},
+		{
+			name:   "several settings",
+			update: bucketUpdate{ReplicaNumber: &replicas, EvictionPolicy: &eviction, FlushEnabled: &flush},
+			want: couchbase.BucketConfig{Name: "orders", BucketType: "couchbase", RAMQuotaMB: 256, ReplicaNumber: 2,
+				EvictionPolicy: "fullEviction", FlushEnabled: true, CompressionMode: "passive"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			updated := test.update.apply(current)
+			if !reflect.DeepEqual(updated, test.want) {
+				t.Fatalf("expected %+v, got %+v", test.want, updated)
+			}
+		})
+	}
+}
@@ -0,0 +1,249 @@
+package raft
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"sync/atomic"
+	"time"
+
+	"github.com/devgenie/scout/internal/backup"
+	"github.com/devgenie/scout/internal/notify"
+)
+
+// keptBackupRuns is the number of backup runs kept in the replicated state.
+const keptBackupRuns = 100
+
+// checkBackup starts the scheduled backup when one is due. Only the leader
+// calls it and the schedule is derived from the replicated runs.
+func (node *RaftNode) checkBackup() {
+	config := node.config.Backup
+	if !config.Enabled || atomic.LoadInt32(&node.backingUp) == 1 {
+		return
+	}
+
+	now := time.Now().UTC()
+	runs := node.backupRuns()
+
+	for _, run := range runs {
+		if config.Stale(run, now) {
+			run.Status = backup.RunFailed
+			run.Message = "abandoned, its leader stopped before it finished"
+			run.Finished = now
+			node.recordBackup(run)
+		}
+	}
+
+	kind, due := config.Next(runs, now)
+	if !due {
+		return
+	}
+
+	err := node.BackupNow(kind)
+	if err != nil {
+		log.Println(err)
+	}
+}
+
+// BackupNow starts a backup of the given kind in the background, it must be
+// called on the leader.
+func (node *RaftNode) BackupNow(kind string) error {
+	if kind != backup.Full && kind != backup.Incremental {
+		return fmt.Errorf("unknown backup kind %s", kind)
+	}
+
+	if !atomic.CompareAndSwapInt32(&node.backingUp, 0, 1) {
+		return fmt.Errorf("a backup is already running")
+	}
+
+	now := time.Now().UTC()
+	run := backup.Run{
+		ID:      fmt.Sprintf("backup-%d", now.UnixNano()),
+		Kind:    kind,
+		Status:  backup.RunRunning,
+		Node:    node.hostname,
+		Started: now,
+	}
+
+	// The run is recorded before it starts so a new leader does not start
+	// the same backup again.
+	err := node.store.Apply(RecordBackupCommand, run)
+	if err != nil {
+		atomic.StoreInt32(&node.backingUp, 0)
+		return err
+	}
+
+	go func() {
+		defer atomic.StoreInt32(&node.backingUp, 0)
+		node.runBackup(run)
+	}()
+	return nil
+}
+
+func (node *RaftNode) runBackup(run backup.Run) {
+	config := node.config.Backup
+	ctx, cancel := context.WithTimeout(context.Background(), config.TimeoutOrDefault())
+	defer cancel()
+
+	manager := node.backupManager()
+	log.Printf("starting %s backup %s", run.Kind, run.ID)
+
+	var removed []string
+	name, err := manager.Backup(ctx, run.Kind)
+	if err == nil {
+		removed, err = manager.ApplyRetention(ctx)
+	}
+
+	if err == nil && config.S3.Endpoint != "" {
+		uploader := backup.NewUploader(config.S3)
+		err = uploader.Upload(ctx, manager)
+		if err == nil {
+			run.Uploaded = true
+			err = uploader.Prune(ctx, manager, removed)
+		}
+	}
+
+	run.Backup = name
+	run.Finished = time.Now().UTC()
+	if err != nil {
+		run.Status = backup.RunFailed
+		run.Message = err.Error()
+		node.notify(notify.Event{
+			Type:     notify.BackupFailed,
+			Severity: notify.SeverityCritical,
+			Subject:  run.ID,
+			Message:  fmt.Sprintf("%s backup failed: %s", run.Kind, err),
+		})
+	} else {
+		run.Status = backup.RunCompleted
+	}
+
+	log.Printf("%s backup %s %s %s", run.Kind, run.ID, run.Status, run.Message)
+	node.recordBackup(run)
+	node.pruneBackupRuns()
+}
+
+// RestoreBackup restores the cluster to the state of a completed backup run
+// in the background, it must be called on the leader. The repository is
+// downloaded from the object store first when the backup is not in the
+// archive of this node.
+func (node *RaftNode) RestoreBackup(id string) (backup.Run, error) {
+	run, ok := node.fsm.State().Backups[id]
+	if !ok {
+		return run, fmt.Errorf("unknown backup %s", id)
+	}
+	if run.Status != backup.RunCompleted {
+		return run, fmt.Errorf("backup %s is %s, only completed backups can be restored", id, run.Status)
+	}
+
+	if !atomic.CompareAndSwapInt32(&node.backingUp, 0, 1) {
+		return run, fmt.Errorf("a backup or restore is already running")
+	}
+
+	now := time.Now().UTC()
+	operation := Operation{
+		ID:      fmt.Sprintf("restore-%d", now.UnixNano()),
+		Type:    "restore",
+		Status:  OperationRunning,
+		Nodes:   []string{node.hostname},
+		Message: fmt.Sprintf("restoring backup %s", id),
+		Created: now,
+		Updated: now,
+	}
+	node.recordOperation(operation)
+
+	go func() {
+		defer atomic.StoreInt32(&node.backingUp, 0)
+
+		err := node.runRestore(id)
+		operation.Status = OperationCompleted
+		operation.Progress = 100
+		if err != nil {
+			log.Printf("error restoring backup %s: %s", id, err)
+			operation.Status = OperationFailed
+			operation.Progress = 0
+			operation.Message = err.Error()
+			node.notify(notify.Event{
+				Type:     notify.RestoreFailed,
+				Severity: notify.SeverityCritical,
+				Subject:  id,
+				Message:  fmt.Sprintf("restore of backup %s failed: %s", id, err),
+			})
+		}
+		node.recordOperation(operation)
+	}()
+	return run, nil
+}
+
+func (node *RaftNode) runRestore(id string) error {
+	config := node.config.Backup
+	ctx, cancel := context.WithTimeout(context.Background(), config.TimeoutOrDefault())
+	defer cancel()
+
+	manager := node.backupManager()
+	local, err := manager.Backups()
+	if err != nil {
+		return err
+	}
+
+	runs := node.backupRuns()
+	_, _, err = backup.RestoreRange(runs, id, local)
+	if err != nil && config.S3.Endpoint != "" {
+		log.Printf("backup %s is not in the local archive, downloading the repository", id)
+		err = backup.NewUploader(config.S3).Download(ctx, manager)
+		if err != nil {
+			return err
+		}
+
+		local, err = manager.Backups()
+		if err != nil {
+			return err
+		}
+	}
+
+	start, end, err := backup.RestoreRange(runs, id, local)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("restoring backups %s to %s", start, end)
+	return manager.Restore(ctx, start, end)
+}
+
+func (node *RaftNode) backupManager() *backup.Manager {
+	cluster := fmt.Sprintf("http://%s", node.couchbaseNode.RESTAddress())
+	return backup.NewManager(node.config.Backup, cluster, node.couchbaseNode.Auth.Username, node.couchbaseNode.Auth.Password)
+}
+
+// backupRuns returns the replicated runs from oldest to newest.
+func (node *RaftNode) backupRuns() []backup.Run {
+	runs := make([]backup.Run, 0)
+	for _, run := range node.fsm.State().Backups {
+		runs = append(runs, run)
+	}
+
+	sort.Slice(runs, func(i, j int) bool {
+		return runs[i].Started.Before(runs[j].Started)
+	})
+	return runs
+}
+
+func (node *RaftNode) recordBackup(run backup.Run) {
+	err := node.store.Apply(RecordBackupCommand, run)
+	if err != nil {
+		log.Printf("error recording backup %s: %s", run.ID, err)
+	}
+}
+
+func (node *RaftNode) pruneBackupRuns() {
+	runs := node.backupRuns()
+	for len(runs) > keptBackupRuns {
+		err := node.store.Apply(RemoveBackupCommand, runs[0].ID)
+		if err != nil {
+			log.Printf("error pruning backup run %s: %s", runs[0].ID, err)
+			return
+		}
+		runs = runs[1:]
+	}
+}
@@ -0,0 +1,99 @@
+package raft
+
+import (
+	"fmt"
+
+	"github.com/devgenie/scout/internal/couchbase"
+)
+
+// CommandVersion is the version of the command encoding written by this
+// release. Entries carrying a newer version are refused by the FSM.
+const CommandVersion = 1
+
+type CommandType uint8
+
+// Command types are persisted in the raft log, new types must only ever be
+// appended to this list.
+const (
+	UpsertNodeCommand CommandType = iota + 1
+	RemoveNodeCommand
+	SetNodeServicesCommand
+	UpsertBucketCommand
+	RemoveBucketCommand
+	SetSettingCommand
+	DeleteSettingCommand
+	UpsertOperationCommand
+	RemoveOperationCommand
+	UpsertUserCommand
+	RemoveUserCommand
+	RecordBackupCommand
+	RemoveBackupCommand
+	UpsertAlertCommand
+	RemoveAlertCommand
+)
+
+type Command struct {
+	Version int
+	Type    CommandType
+	Payload []byte
+}
+
+type NodeServices struct {
+	Name     string
+	Services []string
+}
+
+type Setting struct {
+	Key   string
+	Value string
+}
+
+func NewCommand(cmdType CommandType, payload interface{}) (*Command, error) {
+	encoded, err := couchbase.Encode(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	command := &Command{
+		Version: CommandVersion,
+		Type:    cmdType,
+		Payload: encoded,
+	}
+	return command, nil
+}
+
+func (cmdType CommandType) String() string {
+	switch cmdType {
+	case UpsertNodeCommand:
+		return "upsert-node"
+	case RemoveNodeCommand:
+		return "remove-node"
+	case SetNodeServicesCommand:
+		return "set-node-services"
+	case UpsertBucketCommand:
+		return "upsert-bucket"
+	case RemoveBucketCommand:
+		return "remove-bucket"
+	case SetSettingCommand:
+		return "set-setting"
+	case DeleteSettingCommand:
+		return "delete-setting"
+	case UpsertOperationCommand:
+		return "upsert-operation"
+	case RemoveOperationCommand:
+		return "remove-operation"
+	case UpsertUserCommand:
+		return "upsert-user"
+	case RemoveUserCommand:
+		return "remove-user"
+	case RecordBackupCommand:
+		return "record-backup"
+	case RemoveBackupCommand:
+		return "remove-backup"
+	case UpsertAlertCommand:
+		return "upsert-alert"
+	case RemoveAlertCommand:
+		return "remove-alert"
+	}
+	return fmt.Sprintf("unknown(%d)", uint8(cmdType))
+}
@@ -0,0 +1,328 @@
+package raft
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync/atomic"
+	"time"
+
+	"github.com/devgenie/scout/internal/couchbase"
+	"github.com/devgenie/scout/internal/metrics"
+	"github.com/devgenie/scout/internal/notify"
+	"github.com/hashicorp/serf/serf"
+)
+
+const (
+	defaultFailoverGracePeriod = time.Hour
+	failoverCheckInterval      = time.Minute
+)
+
+// failoverDeparted fails over the departed members that couchbase still
+// considers active and returns the departed members that were never
+// rebalanced in, which can be ejected right away, and the members it failed
+// over. Members that left are failed over gracefully, failed members are
+// hard failed over. No failover is started when the buckets do not keep
+// enough replicas to cover every node that is out of the cluster.
+//
+// A rebalance ejects every failed over member without a recovery type, so
+// the caller must not rebalance after a failover. The member is kept until
+// recoverMember sets its recovery type or failovers reports its grace period
+// passed.
+func (node *RaftNode) failoverDeparted(ctx context.Context, departed map[string]serf.EventType) ([]string, []string, error) {
+	ejected := make([]string, 0)
+	failedOver := make([]string, 0)
+	if len(departed) == 0 {
+		return ejected, failedOver, nil
+	}
+
+	members, err := node.couchbaseNode.Nodes(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	alreadyFailed := 0
+	active := make([]couchbase.ClusterNode, 0)
+	for _, member := range members {
+		if member.ClusterMembership == "inactiveFailed" {
+			alreadyFailed++
+		}
+
+		for name := range departed {
+			if !member.Matches(name) {
+				continue
+			}
+
+			switch member.ClusterMembership {
+			case "active":
+				active = append(active, member)
+			case "inactiveAdded":
+				ejected = append(ejected, member.OTPNode)
+			}
+		}
+	}
+
+	if len(active) == 0 {
+		return ejected, failedOver, nil
+	}
+
+	minReplicas, err := node.couchbaseNode.MinReplicas(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if minReplicas >= 0 && alreadyFailed+len(active) > minReplicas {
+		return nil, nil, fmt.Errorf("failing over %d more nodes with %d already failed over would lose data, buckets keep %d replicas", len(active), alreadyFailed, minReplicas)
+	}
+
+	for _, member := range active {
+		name := member.Hostname
+		for departedName := range departed {
+			if member.Matches(departedName) {
+				name = departedName
+			}
+		}
+
+		err = node.failover(ctx, member, departed[name] == serf.EventMemberLeave)
+		if err != nil {
+			log.Printf("error failing over %s, it stays in the cluster: %s", name, err)
+			continue
+		}
+		failedOver = append(failedOver, name)
+	}
+
+	return ejected, failedOver, nil
+}
+
+// checkFailedOver starts a rebalance ejecting the failed over members whose
+// grace period passed, at most once every failoverCheckInterval. It waits
+// while other failed over members are still within their grace period, as
+// the rebalance would eject them too.
+func (node *RaftNode) checkFailedOver() {
+	if time.Since(node.lastFailoverCheck) < failoverCheckInterval || atomic.LoadInt32(&node.rebalancing) == 1 {
+		return
+	}
+	node.lastFailoverCheck = time.Now()
+
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+
+		expired, held, err := node.failovers(ctx)
+		if err != nil {
+			log.Printf("error checking failed over nodes: %s", err)
+			return
+		}
+		if len(expired) == 0 {
+			return
+		}
+		if len(held) > 0 {
+			log.Printf("failed over nodes %v are past the grace period, waiting for %v before ejecting them", expired, held)
+			return
+		}
+
+		log.Printf("failed over nodes %v are past the grace period, ejecting them", expired)
+		err = node.RebalanceNow()
+		if err != nil {
+			log.Printf("error ejecting failed over nodes: %s", err)
+		}
+	}()
+}
+
+// failovers returns the failed over members that did not come back within
+// the grace period, and the ones still within it that a rebalance would
+// eject.
+func (node *RaftNode) failovers(ctx context.Context) ([]string, []string, error) {
+	members, err := node.couchbaseNode.Nodes(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	expired, held := failovers(members, node.fsm.State().Nodes, node.failoverGracePeriod(), time.Now())
+	return expired, held, nil
+}
+
+// failovers splits the failed over members without a recovery type into the
+// expired ones, whose scout node is gone or has been away for longer than
+// grace, and the held ones. Members with a recovery type are added back by
+// the next rebalance and are in neither.
+func failovers(members []couchbase.ClusterNode, nodes map[string]NodeState, grace time.Duration, now time.Time) ([]string, []string) {
+	expired := make([]string, 0)
+	held := make([]string, 0)
+	for _, member := range members {
+		if member.ClusterMembership != "inactiveFailed" {
+			continue
+		}
+		if member.RecoveryType == couchbase.RecoveryDelta || member.RecoveryType == couchbase.RecoveryFull {
+			continue
+		}
+
+		var known *NodeState
+		for name, state := range nodes {
+			if member.Matches(name) {
+				state := state
+				known = &state
+				break
+			}
+		}
+
+		if known != nil && (known.Status == NodeActive || now.Sub(known.Updated) < grace) {
+			held = append(held, member.OTPNode)
+			continue
+		}
+		expired = append(expired, member.OTPNode)
+	}
+	return expired, held
+}
+
+func (node *RaftNode) failoverGracePeriod() time.Duration {
+	if node.config.FailoverGracePeriod > 0 {
+		return node.config.FailoverGracePeriod
+	}
+	return defaultFailoverGracePeriod
+}
+
+// FailoverNode fails over a cluster member on request of an operator, it
+// must be called on the leader. The member stays in the cluster until it is
+// recovered or its grace period passed.
+func (node *RaftNode) FailoverNode(name string, graceful bool) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	members, err := node.couchbaseNode.Nodes(ctx)
+	if err != nil {
+		return err
+	}
+
+	var target *couchbase.ClusterNode
+	alreadyFailed := 0
+	for i, member := range members {
+		if member.ClusterMembership == "inactiveFailed" {
+			alreadyFailed++
+		}
+		if member.Matches(name) {
+			target = &members[i]
+		}
+	}
+
+	if target == nil {
+		return fmt.Errorf("%s is not a member of the cluster", name)
+	}
+	if target.ClusterMembership != "active" {
+		return fmt.Errorf("%s is %s, only active members can be failed over", name, target.ClusterMembership)
+	}
+
+	minReplicas, err := node.couchbaseNode.MinReplicas(ctx)
+	if err != nil {
+		return err
+	}
+	if minReplicas >= 0 && alreadyFailed+1 > minReplicas {
+		return fmt.Errorf("failing over %s with %d already failed over would lose data, buckets keep %d replicas", name, alreadyFailed, minReplicas)
+	}
+
+	if !atomic.CompareAndSwapInt32(&node.rebalancing, 0, 1) {
+		return fmt.Errorf("a rebalance is running, try again once it finished")
+	}
+
+	now := time.Now().UTC()
+	operation := Operation{
+		ID:      fmt.Sprintf("failover-%d", now.UnixNano()),
+		Type:    "failover",
+		Status:  OperationRunning,
+		Nodes:   []string{name},
+		Created: now,
+		Updated: now,
+	}
+	node.recordOperation(operation)
+
+	member := *target
+	go func() {
+		defer atomic.StoreInt32(&node.rebalancing, 0)
+
+		err := node.failover(context.Background(), member, graceful)
+		operation.Status = OperationCompleted
+		operation.Progress = 100
+		if err != nil {
+			operation.Status = OperationFailed
+			operation.Progress = 0
+			operation.Message = err.Error()
+		}
+		node.recordOperation(operation)
+	}()
+	return nil
+}
+
+// failover removes a node from service, gracefully when it is still
+// reachable and falling back to a hard failover otherwise.
+func (node *RaftNode) failover(ctx context.Context, member couchbase.ClusterNode, graceful bool) error {
+	if graceful {
+		log.Printf("gracefully failing over %s", member.OTPNode)
+		err := node.couchbaseNode.GracefulFailover(ctx, member.OTPNode)
+		if err == nil {
+			result := node.couchbaseNode.WaitForRebalance(ctx, rebalancePollInterval, rebalanceStallTimeout)
+			if result.Status == couchbase.RebalanceCompleted {
+				node.reportFailover(member, "graceful", nil)
+				return nil
+			}
+			err = fmt.Errorf("graceful failover %s: %s", result.Status, result.Message)
+		}
+		node.reportFailover(member, "graceful", err)
+		log.Printf("%s, falling back to hard failover", err)
+	}
+
+	log.Printf("hard failing over %s", member.OTPNode)
+	err := node.couchbaseNode.HardFailover(ctx, member.OTPNode)
+	node.reportFailover(member, "hard", err)
+	return err
+}
+
+func (node *RaftNode) reportFailover(member couchbase.ClusterNode, kind string, err error) {
+	event := notify.Event{
+		Type:     notify.FailoverCompleted,
+		Severity: notify.SeverityWarning,
+		Subject:  member.Hostname,
+		Message:  fmt.Sprintf("%s failover of %s completed", kind, member.OTPNode),
+	}
+	result := "completed"
+
+	if err != nil {
+		event.Type = notify.FailoverFailed
+		event.Severity = notify.SeverityCritical
+		event.Message = fmt.Sprintf("%s failover of %s failed: %s", kind, member.OTPNode, err)
+		result = "failed"
+	}
+
+	metrics.Default.Add("scout_failovers_total", metrics.Labels{"kind": kind, "result": result}, 1)
+	node.notify(event)
+}
+
+// recoverMember sets a returning member that couchbase failed over to be
+// added back by the next rebalance, with delta recovery when its data can be
+// reused and full recovery otherwise.
+func (node *RaftNode) recoverMember(ctx context.Context, name string) {
+	members, err := node.couchbaseNode.Nodes(ctx)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+
+	for _, member := range members {
+		if !member.Matches(name) || member.ClusterMembership != "inactiveFailed" {
+			continue
+		}
+
+		err = node.couchbaseNode.SetRecoveryType(ctx, member.OTPNode, couchbase.RecoveryDelta)
+		if err == nil {
+			log.Printf("recovering %s with delta recovery", name)
+			return
+		}
+
+		log.Printf("%s, falling back to full recovery", err)
+		err = node.couchbaseNode.SetRecoveryType(ctx, member.OTPNode, couchbase.RecoveryFull)
+		if err != nil {
+			log.Println(err)
+			return
+		}
+		log.Printf("recovering %s with full recovery", name)
+		return
+	}
+}
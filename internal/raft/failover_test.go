@@ -0,0 +1,79 @@
+package raft
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/devgenie/scout/internal/couchbase"
+)
+
+func TestFailovers(t *testing.T) {
+	now := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+	grace := time.Hour
+	member := func(host string, membership string) couchbase.ClusterNode {
+		return couchbase.ClusterNode{OTPNode: "ns_1@" + host, Hostname: host + ":8091", ClusterMembership: membership, RecoveryType: "none"}
+	}
+	recovering := member("a", "inactiveFailed")
+	recovering.RecoveryType = couchbase.RecoveryDelta
+
+	tests := []struct {
+		name    string
+		members []couchbase.ClusterNode
+		nodes   map[string]NodeState
+		expired []string
+		held    []string
+	}{
+		{
+			name:    "active members are never ejected",
+			members: []couchbase.ClusterNode{member("a", "active")},
+			nodes:   map[string]NodeState{"a": {Status: NodeFailed, Updated: now.Add(-2 * time.Hour)}},
+			expired: []string{},
+			held:    []string{},
+		},
+		{
+			name:    "failed over within the grace period",
+			members: []couchbase.ClusterNode{member("a", "inactiveFailed")},
+			nodes:   map[string]NodeState{"a": {Status: NodeFailed, Updated: now.Add(-30 * time.Minute)}},
+			expired: []string{},
+			held:    []string{"ns_1@a"},
+		},
+		{
+			name:    "failed over past the grace period",
+			members: []couchbase.ClusterNode{member("a", "inactiveFailed")},
+			nodes:   map[string]NodeState{"a": {Status: NodeLeft, Updated: now.Add(-2 * time.Hour)}},
+			expired: []string{"ns_1@a"},
+			held:    []string{},
+		},
+		{
+			name:    "failed over and back without a recovery type",
+			members: []couchbase.ClusterNode{member("a", "inactiveFailed")},
+			nodes:   map[string]NodeState{"a": {Status: NodeActive, Updated: now.Add(-2 * time.Hour)}},
+			expired: []string{},
+			held:    []string{"ns_1@a"},
+		},
+		{
+			name:    "failed over with a recovery type",
+			members: []couchbase.ClusterNode{recovering},
+			nodes:   map[string]NodeState{"a": {Status: NodeFailed, Updated: now.Add(-30 * time.Minute)}},
+			expired: []string{},
+			held:    []string{},
+		},
+		{
+			name:    "failed over and forgotten by scout",
+			members: []couchbase.ClusterNode{member("a", "inactiveFailed"), member("b", "inactiveFailed")},
+			nodes:   map[string]NodeState{"b": {Status: NodeFailed, Updated: now}},
+			expired: []string{"ns_1@a"},
+			held:    []string{"ns_1@b"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			expired, held := failovers(test.members, test.nodes, grace, now)
+			if !reflect.DeepEqual(expired, test.expired) || !reflect.DeepEqual(held, test.held) {
+				t.Fatalf("expected %v expired and %v held, got %v and %v", test.expired, test.held, expired, held)
+			}
+		})
+	}
+}
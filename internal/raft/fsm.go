@@ -1,31 +1,262 @@
 package raft
 
 import (
+	"encoding/binary"
+	"encoding/gob"
+	"fmt"
 	"io"
+	"log"
+	"sync"
 
+	"github.com/devgenie/scout/internal/backup"
+	"github.com/devgenie/scout/internal/couchbase"
+	"github.com/devgenie/scout/internal/monitor"
 	"github.com/hashicorp/raft"
 )
 
 type FSM struct {
+	mutex sync.RWMutex
+	state *ClusterState
 }
 
+// SnapshotVersion is the format written by Persist. Restore keeps a decoder
+// for every version ever released.
+const SnapshotVersion = 1
+
+const snapshotMagic = "SCOUTFSM"
+
 type snapshot struct {
+	state ClusterState
+}
+
+func NewFSM() *FSM {
+	return &FSM{
+		state: newClusterState(),
+	}
+}
+
+// Apply decodes a committed log entry and applies it to the cluster state.
+// The returned value is an error when the command could not be applied.
+func (fsm *FSM) Apply(entry *raft.Log) interface{} {
+	if entry.Type != raft.LogCommand {
+		return nil
+	}
+
+	command := new(Command)
+	err := couchbase.Decode(command, entry.Data)
+	if err != nil {
+		return err
+	}
+
+	if command.Version > CommandVersion {
+		err = fmt.Errorf("command %s has version %d, newest supported is %d", command.Type, command.Version, CommandVersion)
+		log.Println(err)
+		return err
+	}
+
+	fsm.mutex.Lock()
+	defer fsm.mutex.Unlock()
+
+	err = fsm.applyCommand(command)
+	if err != nil {
+		log.Printf("error applying %s at index %d: %s", command.Type, entry.Index, err)
+		return err
+	}
+	return nil
 }
 
-func (fsm *FSM) Apply(*raft.Log) interface{} {
+func (fsm *FSM) applyCommand(command *Command) error {
+	state := fsm.state
+
+	switch command.Type {
+	case UpsertNodeCommand:
+		node := NodeState{}
+		if err := couchbase.Decode(&node, command.Payload); err != nil {
+			return err
+		}
+		state.Nodes[node.Name] = node
+	case RemoveNodeCommand:
+		var name string
+		if err := couchbase.Decode(&name, command.Payload); err != nil {
+			return err
+		}
+		delete(state.Nodes, name)
+	case SetNodeServicesCommand:
+		services := NodeServices{}
+		if err := couchbase.Decode(&services, command.Payload); err != nil {
+			return err
+		}
+		node, ok := state.Nodes[services.Name]
+		if !ok {
+			return fmt.Errorf("unknown node %s", services.Name)
+		}
+		node.Services = services.Services
+		state.Nodes[services.Name] = node
+	case UpsertBucketCommand:
+		bucket := BucketState{}
+		if err := couchbase.Decode(&bucket, command.Payload); err != nil {
+			return err
+		}
+		state.Buckets[bucket.Name] = bucket
+	case RemoveBucketCommand:
+		var name string
+		if err := couchbase.Decode(&name, command.Payload); err != nil {
+			return err
+		}
+		delete(state.Buckets, name)
+	case SetSettingCommand:
+		setting := Setting{}
+		if err := couchbase.Decode(&setting, command.Payload); err != nil {
+			return err
+		}
+		state.Settings[setting.Key] = setting.Value
+	case DeleteSettingCommand:
+		var key string
+		if err := couchbase.Decode(&key, command.Payload); err != nil {
+			return err
+		}
+		delete(state.Settings, key)
+	case UpsertOperationCommand:
+		operation := Operation{}
+		if err := couchbase.Decode(&operation, command.Payload); err != nil {
+			return err
+		}
+		state.Operations[operation.ID] = operation
+	case RemoveOperationCommand:
+		var id string
+		if err := couchbase.Decode(&id, command.Payload); err != nil {
+			return err
+		}
+		delete(state.Operations, id)
+	case UpsertUserCommand:
+		user := UserState{}
+		if err := couchbase.Decode(&user, command.Payload); err != nil {
+			return err
+		}
+		state.Users[user.Name] = user
+	case RemoveUserCommand:
+		var name string
+		if err := couchbase.Decode(&name, command.Payload); err != nil {
+			return err
+		}
+		delete(state.Users, name)
+	case RecordBackupCommand:
+		run := backup.Run{}
+		if err := couchbase.Decode(&run, command.Payload); err != nil {
+			return err
+		}
+		state.Backups[run.ID] = run
+	case RemoveBackupCommand:
+		var id string
+		if err := couchbase.Decode(&id, command.Payload); err != nil {
+			return err
+		}
+		delete(state.Backups, id)
+	case UpsertAlertCommand:
+		alert := monitor.Alert{}
+		if err := couchbase.Decode(&alert, command.Payload); err != nil {
+			return err
+		}
+		state.Alerts[alert.ID] = alert
+	case RemoveAlertCommand:
+		var id string
+		if err := couchbase.Decode(&id, command.Payload); err != nil {
+			return err
+		}
+		delete(state.Alerts, id)
+	default:
+		return fmt.Errorf("unknown command type %s", command.Type)
+	}
+
 	return nil
 }
 
+// State returns a copy of the replicated cluster state, it is safe to call on
+// followers.
+func (fsm *FSM) State() ClusterState {
+	fsm.mutex.RLock()
+	defer fsm.mutex.RUnlock()
+	return fsm.state.clone()
+}
+
+func (fsm *FSM) Node(name string) (NodeState, bool) {
+	fsm.mutex.RLock()
+	defer fsm.mutex.RUnlock()
+	node, ok := fsm.state.Nodes[name]
+	return node, ok
+}
+
+func (fsm *FSM) Setting(key string) (string, bool) {
+	fsm.mutex.RLock()
+	defer fsm.mutex.RUnlock()
+	value, ok := fsm.state.Settings[key]
+	return value, ok
+}
+
+func (fsm *FSM) reset() {
+	fsm.mutex.Lock()
+	defer fsm.mutex.Unlock()
+	fsm.state = newClusterState()
+}
+
+// Snapshot captures a copy of the state, Persist writes it out later without
+// holding the FSM lock.
 func (fsm *FSM) Snapshot() (raft.FSMSnapshot, error) {
-	return &snapshot{}, nil
+	fsm.mutex.RLock()
+	defer fsm.mutex.RUnlock()
+	return &snapshot{state: fsm.state.clone()}, nil
 }
 
-func (fsm *FSM) Restore(io.ReadCloser) error {
+// Restore replaces the state with the content of a snapshot written by
+// Persist, older snapshot versions are still understood.
+func (fsm *FSM) Restore(reader io.ReadCloser) error {
+	defer reader.Close()
+
+	header := make([]byte, len(snapshotMagic)+2)
+	if _, err := io.ReadFull(reader, header); err != nil {
+		return fmt.Errorf("error reading snapshot header: %s", err)
+	}
+
+	if string(header[:len(snapshotMagic)]) != snapshotMagic {
+		return fmt.Errorf("snapshot is not a scout snapshot")
+	}
+
+	version := binary.BigEndian.Uint16(header[len(snapshotMagic):])
+	state := newClusterState()
+
+	switch version {
+	case 1:
+		if err := gob.NewDecoder(reader).Decode(state); err != nil {
+			return fmt.Errorf("error decoding snapshot: %s", err)
+		}
+	default:
+		return fmt.Errorf("snapshot has version %d, newest supported is %d", version, SnapshotVersion)
+	}
+
+	state.normalize()
+
+	fsm.mutex.Lock()
+	defer fsm.mutex.Unlock()
+	fsm.state = state
 	return nil
 }
 
 func (s *snapshot) Persist(sink raft.SnapshotSink) error {
-	return nil
+	header := make([]byte, len(snapshotMagic)+2)
+	copy(header, snapshotMagic)
+	binary.BigEndian.PutUint16(header[len(snapshotMagic):], SnapshotVersion)
+
+	_, err := sink.Write(header)
+	if err == nil {
+		err = gob.NewEncoder(sink).Encode(s.state)
+	}
+
+	if err != nil {
+		sink.Cancel()
+		return err
+	}
+
+	return sink.Close()
 }
 
 func (s *snapshot) Release() {
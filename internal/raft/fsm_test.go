@@ -0,0 +1,157 @@
+package raft
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/devgenie/scout/internal/backup"
+	"github.com/devgenie/scout/internal/couchbase"
+	"github.com/devgenie/scout/internal/monitor"
+	"github.com/hashicorp/raft"
+)
+
+type memorySink struct {
+	bytes.Buffer
+	cancelled bool
+}
+
+func (sink *memorySink) ID() string    { return "memory" }
+func (sink *memorySink) Close() error  { return nil }
+func (sink *memorySink) Cancel() error { sink.cancelled = true; return nil }
+
+func applyCommand(t *testing.T, fsm *FSM, cmdType CommandType, payload interface{}) interface{} {
+	t.Helper()
+	command, err := NewCommand(cmdType, payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := couchbase.Encode(command)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return fsm.Apply(&raft.Log{Type: raft.LogCommand, Data: data})
+}
+
+func snapshotOf(t *testing.T, fsm *FSM) []byte {
+	t.Helper()
+	snap, err := fsm.Snapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sink := &memorySink{}
+	if err := snap.Persist(sink); err != nil {
+		t.Fatal(err)
+	}
+	return sink.Bytes()
+}
+
+func TestSnapshotRoundTrip(t *testing.T) {
+	now := time.Date(2026, 10, 18, 9, 0, 0, 0, time.UTC)
+	fsm := NewFSM()
+
+	commands := []struct {
+		cmdType CommandType
+		payload interface{}
+	}{
+		{UpsertNodeCommand, NodeState{Name: "a", Address: "10.0.0.1", Services: []string{"kv"}, Status: NodeActive, Updated: now}},
+		{UpsertBucketCommand, BucketState{Name: "default", BucketType: "couchbase", RAMQuotaMB: 256}},
+		{SetSettingCommand, Setting{Key: "pools.memoryQuota", Value: "512"}},
+		{UpsertOperationCommand, Operation{ID: "op", Type: "rebalance", Status: OperationRunning, Nodes: []string{"a"}, Created: now, Updated: now}},
+		{UpsertUserCommand, UserState{Name: "app", Roles: []string{"admin"}}},
+		{RecordBackupCommand, backup.Run{ID: "run", Kind: backup.Full, Status: backup.RunCompleted, Started: now}},
+		{UpsertAlertCommand, monitor.Alert{ID: "rule/a", Rule: "rule", Status: monitor.AlertFiring, Fired: now}},
+	}
+	for _, command := range commands {
+		if result := applyCommand(t, fsm, command.cmdType, command.payload); result != nil {
+			t.Fatalf("applying %s: %v", command.cmdType, result)
+		}
+	}
+
+	restored := NewFSM()
+	err := restored.Restore(ioutil.NopCloser(bytes.NewReader(snapshotOf(t, fsm))))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(fsm.State(), restored.State()) {
+		t.Fatalf("restored state differs\nwant %+v\ngot  %+v", fsm.State(), restored.State())
+	}
+}
+
+func TestSnapshotRoundTripEmptyState(t *testing.T) {
+	restored := NewFSM()
+	err := restored.Restore(ioutil.NopCloser(bytes.NewReader(snapshotOf(t, NewFSM()))))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Empty maps come back nil from gob and must be usable after restore.
+	state := restored.State()
+	if state.Nodes == nil || state.Buckets == nil || state.Alerts == nil || state.Backups == nil {
+		t.Fatalf("restored state has nil maps: %+v", state)
+	}
+}
+
+func TestRestoreRejectsBadSnapshots(t *testing.T) {
+	valid := snapshotOf(t, NewFSM())
+
+	newer := append([]byte(nil), valid...)
+	binary.BigEndian.PutUint16(newer[len(snapshotMagic):], SnapshotVersion+1)
+
+	foreign := append([]byte(nil), valid...)
+	copy(foreign, "NOTSCOUT")
+
+	tests := []struct {
+		name    string
+		data    []byte
+		message string
+	}{
+		{"newer version", newer, "newest supported"},
+		{"wrong magic", foreign, "not a scout snapshot"},
+		{"truncated header", valid[:4], "header"},
+		{"truncated body", valid[:len(snapshotMagic)+2], "decoding"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			fsm := NewFSM()
+			applyCommand(t, fsm, SetSettingCommand, Setting{Key: "kept", Value: "1"})
+
+			err := fsm.Restore(ioutil.NopCloser(bytes.NewReader(test.data)))
+			if err == nil || !strings.Contains(err.Error(), test.message) {
+				t.Fatalf("expected error containing %q, got %v", test.message, err)
+			}
+
+			// A failed restore leaves the state alone.
+			if value, ok := fsm.Setting("kept"); !ok || value != "1" {
+				t.Fatalf("state changed by a failed restore")
+			}
+		})
+	}
+}
+
+func TestApplyRejectsNewerCommands(t *testing.T) {
+	command, err := NewCommand(SetSettingCommand, Setting{Key: "a", Value: "b"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	command.Version = CommandVersion + 1
+
+	data, err := couchbase.Encode(command)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fsm := NewFSM()
+	if _, ok := fsm.Apply(&raft.Log{Type: raft.LogCommand, Data: data}).(error); !ok {
+		t.Fatal("expected an error for a newer command version")
+	}
+	if _, ok := fsm.Setting("a"); ok {
+		t.Fatal("newer command was applied")
+	}
+}
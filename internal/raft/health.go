@@ -0,0 +1,130 @@
+package raft
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/devgenie/scout/internal/couchbase"
+	"github.com/hashicorp/raft"
+	"github.com/hashicorp/serf/serf"
+)
+
+const healthTimeout = 3 * time.Second
+
+// Liveness reports whether the scout processes of this node are running.
+func (node *RaftNode) Liveness() couchbase.HealthReport {
+	return couchbase.NewHealthReport([]couchbase.HealthCheck{
+		node.raftCheck(false),
+		node.serfCheck(),
+	})
+}
+
+// Readiness reports whether this node serves a healthy couchbase node that
+// is part of a cluster with a raft leader.
+func (node *RaftNode) Readiness() couchbase.HealthReport {
+	ctx, cancel := context.WithTimeout(context.Background(), healthTimeout)
+	defer cancel()
+
+	return couchbase.NewHealthReport([]couchbase.HealthCheck{
+		node.couchbaseCheck(ctx),
+		node.raftCheck(true),
+		node.serfCheck(),
+		node.reconcileCheck(),
+	})
+}
+
+// couchbaseCheck checks that the REST interface answers and that the node is
+// an active, healthy member of the cluster.
+func (node *RaftNode) couchbaseCheck(ctx context.Context) couchbase.HealthCheck {
+	check := couchbase.HealthCheck{Name: "couchbase", Status: couchbase.HealthPass}
+
+	self, err := node.couchbaseNode.Self(ctx)
+	if err != nil {
+		check.Status = couchbase.HealthFail
+		check.Message = err.Error()
+		return check
+	}
+
+	check.Details = map[string]string{
+		"otpNode":    self.OTPNode,
+		"membership": self.ClusterMembership,
+		"status":     self.Status,
+	}
+
+	if self.ClusterMembership != "active" || self.Status != "healthy" {
+		check.Status = couchbase.HealthFail
+		check.Message = fmt.Sprintf("node is %s and %s", self.ClusterMembership, self.Status)
+	}
+	return check
+}
+
+// raftCheck reports the raft role of the node. With needLeader the check
+// fails while the cluster has no leader.
+func (node *RaftNode) raftCheck(needLeader bool) couchbase.HealthCheck {
+	check := couchbase.HealthCheck{Name: "raft", Status: couchbase.HealthPass}
+
+	if node.store.raft == nil {
+		check.Status = couchbase.HealthFail
+		check.Message = "raft is not running"
+		return check
+	}
+
+	state := node.store.raft.State()
+	leader := string(node.store.raft.Leader())
+	check.Details = map[string]string{
+		"state":       state.String(),
+		"leader":      leader,
+		"lastContact": node.store.raft.LastContact().UTC().Format(time.RFC3339),
+	}
+
+	if state == raft.Shutdown {
+		check.Status = couchbase.HealthFail
+		check.Message = "raft is shut down"
+	} else if needLeader && leader == "" {
+		check.Status = couchbase.HealthFail
+		check.Message = "no raft leader"
+	}
+	return check
+}
+
+func (node *RaftNode) serfCheck() couchbase.HealthCheck {
+	check := couchbase.HealthCheck{Name: "serf", Status: couchbase.HealthPass}
+
+	if node.serfScout == nil || node.serfScout.State() != serf.SerfAlive {
+		check.Status = couchbase.HealthFail
+		check.Message = "serf is not running"
+		return check
+	}
+
+	members := make(map[string]int)
+	for _, member := range node.serfScout.Members() {
+		members[member.Status.String()]++
+	}
+	check.Details = members
+
+	if members[serf.StatusFailed.String()] > 0 {
+		check.Status = couchbase.HealthWarn
+		check.Message = fmt.Sprintf("%d members failed", members[serf.StatusFailed.String()])
+	}
+	return check
+}
+
+// reconcileCheck reports the last reconcile pass, errors in it are warnings
+// as they concern the cluster rather than this node.
+func (node *RaftNode) reconcileCheck() couchbase.HealthCheck {
+	check := couchbase.HealthCheck{Name: "reconcile", Status: couchbase.HealthPass}
+
+	result := node.LastReconcile()
+	if result == nil {
+		check.Message = "no reconcile ran on this node"
+		return check
+	}
+
+	check.Details = result
+	if len(result.Errors) > 0 {
+		check.Status = couchbase.HealthWarn
+		check.Message = fmt.Sprintf("%d errors in the last reconcile", len(result.Errors))
+	}
+	return check
+}
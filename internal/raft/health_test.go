@@ -0,0 +1,62 @@
+package raft
+
+import (
+	"context"
+	"testing"
+
+	"github.com/devgenie/scout/internal/couchbase"
+)
+
+func TestCouchbaseCheck(t *testing.T) {
+	tests := []struct {
+		name       string
+		membership string
+		status     string
+		want       string
+	}{
+		{"active and healthy", "active", "healthy", couchbase.HealthPass},
+		{"not rebalanced in yet", "inactiveAdded", "healthy", couchbase.HealthFail},
+		{"unhealthy", "active", "unhealthy", couchbase.HealthFail},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			fake := &fakeCouchbase{members: []couchbase.ClusterNode{
+				{OTPNode: "ns_1@a", Hostname: "a:8091", ClusterMembership: test.membership, Status: test.status},
+			}}
+			node, stop := testLeader(t, fake)
+			defer stop()
+			node.couchbaseNode.Hostname = "a"
+
+			check := node.couchbaseCheck(context.Background())
+			if check.Status != test.want {
+				t.Fatalf("expected %s, got %+v", test.want, check)
+			}
+		})
+	}
+}
+
+func TestReadiness(t *testing.T) {
+	fake := &fakeCouchbase{members: []couchbase.ClusterNode{
+		{OTPNode: "ns_1@a", Hostname: "a:8091", ClusterMembership: "active", Status: "healthy"},
+	}}
+	node, stop := testLeader(t, fake)
+	defer stop()
+	node.couchbaseNode.Hostname = "a"
+
+	if check := node.raftCheck(true); check.Status != couchbase.HealthPass {
+		t.Fatalf("expected the leader to pass the raft check, got %+v", check)
+	}
+
+	// Without serf the node is neither live nor ready.
+	for name, report := range map[string]couchbase.HealthReport{"ready": node.Readiness(), "live": node.Liveness()} {
+		if report.Status != couchbase.HealthFail {
+			t.Fatalf("expected %s to fail without serf, got %+v", name, report)
+		}
+	}
+
+	node.store.raft.Shutdown().Error()
+	if check := node.raftCheck(false); check.Status != couchbase.HealthFail {
+		t.Fatalf("expected a shut down raft to fail, got %+v", check)
+	}
+}
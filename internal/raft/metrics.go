@@ -0,0 +1,117 @@
+package raft
+
+import (
+	"context"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/devgenie/scout/internal/metrics"
+	"github.com/hashicorp/raft"
+	"github.com/hashicorp/serf/serf"
+)
+
+const metricsTimeout = 3 * time.Second
+
+func init() {
+	metrics.Default.Gauge("scout_raft_state", "Raft state of this node, 1 for the current state.")
+	metrics.Default.Gauge("scout_raft_term", "Current raft term.")
+	metrics.Default.Gauge("scout_raft_commit_index", "Index of the last committed raft log entry.")
+	metrics.Default.Gauge("scout_raft_applied_index", "Index of the last raft log entry applied to the FSM.")
+	metrics.Default.Gauge("scout_raft_last_contact_seconds", "Seconds since this node last heard from the leader.")
+	metrics.Default.Gauge("scout_serf_members", "Serf members by status.")
+	metrics.Default.Counter("scout_rebalances_total", "Rebalances started by scout, by result.")
+	metrics.Default.Counter("scout_failovers_total", "Failovers started by scout, by kind and result.")
+	metrics.Default.Gauge("scout_bucket_quota_percent_used", "Percentage of the bucket quota in use.")
+	metrics.Default.Gauge("scout_bucket_ops_per_second", "Operations per second on the bucket.")
+	metrics.Default.Gauge("scout_bucket_disk_fetches", "Disk fetches per second of the bucket.")
+	metrics.Default.Gauge("scout_bucket_items", "Items stored in the bucket.")
+	metrics.Default.Gauge("scout_bucket_disk_used_bytes", "Disk space used by the bucket.")
+	metrics.Default.Gauge("scout_bucket_data_used_bytes", "Data size of the bucket.")
+	metrics.Default.Gauge("scout_bucket_memory_used_bytes", "Memory used by the bucket.")
+}
+
+// collectMetrics refreshes the gauges read from raft, serf and couchbase.
+func (node *RaftNode) collectMetrics(registry *metrics.Registry) {
+	if node.store.raft != nil {
+		current := node.store.raft.State()
+		registry.Reset("scout_raft_state")
+		for _, state := range []raft.RaftState{raft.Follower, raft.Candidate, raft.Leader, raft.Shutdown} {
+			value := 0.0
+			if state == current {
+				value = 1
+			}
+			registry.Set("scout_raft_state", metrics.Labels{"state": state.String()}, value)
+		}
+
+		stats := node.store.raft.Stats()
+		setStat(registry, "scout_raft_term", stats["term"])
+		setStat(registry, "scout_raft_commit_index", stats["commit_index"])
+		setStat(registry, "scout_raft_applied_index", stats["applied_index"])
+
+		// The leader has no leader to hear from.
+		lastContact := 0.0
+		if current != raft.Leader && !node.store.raft.LastContact().IsZero() {
+			lastContact = time.Since(node.store.raft.LastContact()).Seconds()
+		}
+		registry.Set("scout_raft_last_contact_seconds", nil, lastContact)
+	}
+
+	if node.serfScout != nil {
+		counts := make(map[string]float64)
+		for _, status := range []serf.MemberStatus{serf.StatusAlive, serf.StatusLeaving, serf.StatusLeft, serf.StatusFailed} {
+			counts[status.String()] = 0
+		}
+		for _, member := range node.serfScout.Members() {
+			counts[member.Status.String()]++
+		}
+		for status, count := range counts {
+			registry.Set("scout_serf_members", metrics.Labels{"status": status}, count)
+		}
+	}
+
+	node.collectBucketMetrics(registry)
+}
+
+func (node *RaftNode) collectBucketMetrics(registry *metrics.Registry) {
+	ctx, cancel := context.WithTimeout(context.Background(), metricsTimeout)
+	defer cancel()
+
+	buckets, err := node.couchbaseNode.BucketStats(ctx)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+
+	gauges := []string{
+		"scout_bucket_quota_percent_used",
+		"scout_bucket_ops_per_second",
+		"scout_bucket_disk_fetches",
+		"scout_bucket_items",
+		"scout_bucket_disk_used_bytes",
+		"scout_bucket_data_used_bytes",
+		"scout_bucket_memory_used_bytes",
+	}
+	for _, gauge := range gauges {
+		registry.Reset(gauge)
+	}
+
+	for _, bucket := range buckets {
+		labels := metrics.Labels{"bucket": bucket.Name}
+		registry.Set("scout_bucket_quota_percent_used", labels, bucket.QuotaPercentUsed)
+		registry.Set("scout_bucket_ops_per_second", labels, bucket.OpsPerSec)
+		registry.Set("scout_bucket_disk_fetches", labels, bucket.DiskFetches)
+		registry.Set("scout_bucket_items", labels, float64(bucket.ItemCount))
+		registry.Set("scout_bucket_disk_used_bytes", labels, float64(bucket.DiskUsed))
+		registry.Set("scout_bucket_data_used_bytes", labels, float64(bucket.DataUsed))
+		registry.Set("scout_bucket_memory_used_bytes", labels, float64(bucket.MemUsed))
+	}
+}
+
+func setStat(registry *metrics.Registry, name string, stat string) {
+	value, err := strconv.ParseFloat(stat, 64)
+	if err != nil {
+		return
+	}
+	registry.Set(name, nil, value)
+}
@@ -0,0 +1,154 @@
+package raft
+
+import (
+	"context"
+	"log"
+	"sync/atomic"
+	"time"
+
+	"github.com/devgenie/scout/internal/monitor"
+	"github.com/devgenie/scout/internal/notify"
+)
+
+const monitorTimeout = 30 * time.Second
+
+// checkMonitor samples the cluster stats once the monitor interval has passed.
+// Only the leader calls it, so every alert is fired by a single node.
+func (node *RaftNode) checkMonitor() {
+	config := node.config.Monitor
+	if !config.Enabled() || time.Since(node.lastMonitor) < config.IntervalOrDefault() {
+		return
+	}
+
+	if !atomic.CompareAndSwapInt32(&node.monitoring, 0, 1) {
+		return
+	}
+	node.lastMonitor = time.Now()
+
+	go func() {
+		defer atomic.StoreInt32(&node.monitoring, 0)
+		node.evaluateAlerts()
+	}()
+}
+
+func (node *RaftNode) evaluateAlerts() {
+	ctx, cancel := context.WithTimeout(context.Background(), monitorTimeout)
+	defer cancel()
+
+	samples := node.sampleStats(ctx)
+	firing := node.fsm.State().Alerts
+
+	for id, alert := range firing {
+		if !node.hasRule(alert.Rule) {
+			log.Printf("dropping alert %s, its rule is no longer configured", id)
+			node.applyAlert(RemoveAlertCommand, id)
+			delete(firing, id)
+		}
+	}
+
+	for _, event := range node.evaluator.Evaluate(samples, firing, time.Now().UTC()) {
+		var err error
+		if event.Type == monitor.AlertFired {
+			err = node.applyAlert(UpsertAlertCommand, event.Alert)
+		} else {
+			err = node.applyAlert(RemoveAlertCommand, event.Alert.ID)
+		}
+
+		// An alert that could not be replicated is evaluated again on the
+		// next pass rather than announced twice.
+		if err != nil {
+			continue
+		}
+		node.emitAlert(event)
+	}
+}
+
+// sampleStats collects the node and bucket samples the rules are evaluated
+// against, stats that cannot be fetched are left out.
+func (node *RaftNode) sampleStats(ctx context.Context) []monitor.Sample {
+	samples := make([]monitor.Sample, 0)
+
+	nodes, err := node.couchbaseNode.NodeStats(ctx)
+	if err != nil {
+		log.Println(err)
+	}
+	for _, stats := range nodes {
+		samples = append(samples,
+			monitor.Sample{Metric: monitor.OpsPerSec, Scope: monitor.NodeScope, Subject: stats.Hostname, Value: stats.OpsPerSec},
+			monitor.Sample{Metric: monitor.MemoryUsedMB, Scope: monitor.NodeScope, Subject: stats.Hostname, Value: stats.MemoryUsedMB},
+			monitor.Sample{Metric: monitor.CPUUtilization, Scope: monitor.NodeScope, Subject: stats.Hostname, Value: stats.CPUUtilization},
+		)
+	}
+
+	buckets, err := node.couchbaseNode.Buckets(ctx)
+	if err != nil {
+		log.Println(err)
+	}
+	for _, bucket := range buckets {
+		stats, err := node.couchbaseNode.BucketSample(ctx, bucket.Name)
+		if err != nil {
+			log.Println(err)
+			continue
+		}
+
+		values := []struct {
+			name  string
+			value float64
+		}{
+			{monitor.OpsPerSec, stats.OpsPerSec},
+			{monitor.MemoryUsedMB, stats.MemoryUsedMB},
+			{monitor.DiskQueue, stats.DiskQueue},
+			{monitor.CacheMissRate, stats.CacheMissRate},
+			{monitor.ResidentRatio, stats.ResidentRatio},
+		}
+		for _, metric := range values {
+			// Memcached buckets keep everything in memory and report no ratio.
+			if metric.name == monitor.ResidentRatio && bucket.BucketType == "memcached" {
+				continue
+			}
+			// A missing stat would read as 0 and fire or resolve rules on
+			// a value couchbase never reported.
+			if !stats.Reported(metric.name) {
+				continue
+			}
+			samples = append(samples, monitor.Sample{Metric: metric.name, Scope: monitor.BucketScope, Subject: stats.Name, Value: metric.value})
+		}
+	}
+
+	return samples
+}
+
+func (node *RaftNode) hasRule(name string) bool {
+	for _, rule := range node.config.Monitor.Rules {
+		if rule.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+func (node *RaftNode) applyAlert(cmdType CommandType, payload interface{}) error {
+	err := node.store.Apply(cmdType, payload)
+	if err != nil {
+		log.Printf("error recording alert: %s", err)
+	}
+	return err
+}
+
+func (node *RaftNode) emitAlert(event monitor.Event) {
+	notification := notify.Event{
+		Type:     notify.AlertFired,
+		Severity: event.Alert.Severity,
+		Subject:  event.Alert.ID,
+		Message:  event.Alert.Message,
+		Time:     event.Time,
+	}
+
+	if event.Type == monitor.AlertCleared {
+		notification.Type = notify.AlertResolved
+		notification.Severity = notify.SeverityInfo
+	} else if notification.Severity == "" {
+		notification.Severity = notify.SeverityWarning
+	}
+	node.notify(notification)
+}
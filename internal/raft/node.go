@@ -1,12 +1,17 @@
 package raft
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"net"
+	"net/http"
 	"os"
 	"github.com/devgenie/scout/internal/consul"
 	"github.com/devgenie/scout/internal/couchbase"
+	"github.com/devgenie/scout/internal/metrics"
+	"github.com/devgenie/scout/internal/monitor"
+	"github.com/devgenie/scout/internal/notify"
 	"strconv"
 	"strings"
 	"sync"
@@ -37,29 +42,61 @@ type RaftNode struct {
 	waiter        sync.WaitGroup
 	couchbaseNode *couchbase.CouchbaseNode
 	discovery     couchbase.Discovery
+	config        couchbase.Config
+	// Membership changes waiting for the settle window to pass before
+	// they are rebalanced, only used on the leader.
+	pendingChanges []membershipChange
+	settleDeadline time.Time
+	rebalancing    int32
+	// Last check for failed over nodes past the grace period.
+	lastFailoverCheck time.Time
+	// State of the reconcile loop run by the leader.
+	lastReconcile   time.Time
+	reconciling     int32
+	reconcileMutex  sync.Mutex
+	reconcileResult *ReconcileResult
+	backingUp       int32
+	// Alert evaluation run by the leader.
+	evaluator   *monitor.Evaluator
+	lastMonitor time.Time
+	monitoring  int32
+	notifier    *notify.Dispatcher
 }
 
-func NewNode(raftPort int, bindPort int, voterPort int, couchbaseNode *couchbase.CouchbaseNode, discoveryMode couchbase.Discovery) *RaftNode {
+func NewNode(config couchbase.Config, couchbaseNode *couchbase.CouchbaseNode, discoveryMode couchbase.Discovery) *RaftNode {
 	hostname := couchbase.HostName()
 	ipaddr := couchbase.IPAddr()
+	fsm := NewFSM()
 	node := &RaftNode{
 		hostname:      hostname,
 		ipaddress:     ipaddr,
-		store:         new(RaftStore),
-		fsm:           new(FSM),
-		raftPort:      raftPort,
-		voterPort:     voterPort,
-		bindPort:      bindPort,
+		store:         &RaftStore{fsm: fsm},
+		fsm:           fsm,
+		raftPort:      config.RaftPort,
+		voterPort:     config.RaftVoterPort,
+		bindPort:      config.RaftMemberPort,
 		broadcastPort: 1300,
 		//network:       datacenter,
 		serfEvents:    make(chan serf.Event, 16),
 		couchbaseNode: couchbaseNode,
 		discovery:     discoveryMode,
+		config:        config,
+		evaluator:     monitor.NewEvaluator(config.Monitor.Rules),
 	}
 	return node
 }
 
 func (node *RaftNode) Run() error {
+	err := node.config.Monitor.Validate()
+	if err != nil {
+		return err
+	}
+
+	node.notifier, err = notify.NewDispatcher(node.config.Notify, node.hostname)
+	if err != nil {
+		return err
+	}
+
 	memberlistConfig := memberlist.DefaultLANConfig()
 	memberlistConfig.BindAddr = node.ipaddress
 	memberlistConfig.BindPort = node.bindPort
@@ -70,6 +107,17 @@ func (node *RaftNode) Run() error {
 	serfConfig.EventCh = node.serfEvents
 	serfConfig.MemberlistConfig = memberlistConfig
 	serfConfig.LogOutput = os.Stdout
+	serfConfig.Tags = map[string]string{
+		"services": node.couchbaseNode.Services,
+		"zone":     node.config.Zone,
+	}
+
+	memory, err := couchbase.HostMemoryMB()
+	if err != nil {
+		log.Println("error reading host memory", err)
+	} else {
+		serfConfig.Tags["memory"] = strconv.Itoa(memory)
+	}
 
 	serfScout, err := serf.Create(serfConfig)
 	if err != nil {
@@ -97,12 +145,23 @@ func (node *RaftNode) Run() error {
 
 	node.waiter.Add(1)
 
-	if node.discovery.Mode == "consul" {
+	switch node.discovery.Mode {
+	case "consul":
 		node.findWithConsul()
+	case "join":
+		err = retryJoin(func() error { return node.joinCluster(node.discovery.Join) }, joinAttempts, joinRetryDelay)
+		if err != nil {
+			node.serfScout.Shutdown()
+			return err
+		}
 	}
 	// go node.listenUDP()
 	go node.ticker()
-	go couchbase.RunWebServer()
+	metrics.Default.Collect(node.collectMetrics)
+	go couchbase.RunWebServer(node, map[string]http.Handler{
+		"/metrics": metrics.Default,
+		"/v1/":     node.apiHandler(),
+	})
 	node.waiter.Wait()
 	return nil
 }
@@ -140,9 +199,35 @@ func (node *RaftNode) findWithConsul() error {
 	return nil
 }
 
+// joinAttempts bounds the attempts to join the cluster given in the config,
+// the wait between them doubles after every failure.
+const (
+	joinAttempts   = 5
+	joinRetryDelay = 5 * time.Second
+)
+
+// retryJoin calls join until it succeeds or the attempts run out.
+func retryJoin(join func() error, attempts int, delay time.Duration) error {
+	var err error
+	for attempt := 1; attempt <= attempts; attempt++ {
+		err = join()
+		if err == nil {
+			return nil
+		}
+
+		if attempt < attempts {
+			log.Printf("Error joining cluster: %s, retrying in %s", err, delay)
+			time.Sleep(delay)
+			delay *= 2
+		}
+	}
+	return fmt.Errorf("error joining cluster after %d attempts : %s", attempts, err)
+}
+
 func (node *RaftNode) joinCluster(remote string) error {
 	fmt.Println("Joining ", remote)
-	nodes := []string{remote}
+	member, couchbaseAddress := node.joinAddresses(remote)
+	nodes := []string{member}
 	_, err := node.serfScout.Join(nodes, false)
 
 	if err != nil {
@@ -150,8 +235,21 @@ func (node *RaftNode) joinCluster(remote string) error {
 		return err
 	}
 
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	// A node that was failed over is still known to the cluster, the leader
+	// recovers it with its data instead of adding it as a new node.
+	membership, err := node.couchbaseNode.MembershipIn(ctx, couchbaseAddress)
+	if err != nil {
+		log.Println(err)
+	} else if membership == "inactiveFailed" {
+		log.Println("Node was failed over, waiting for the leader to recover it")
+		return nil
+	}
+
 	fmt.Println("Adding node to ", remote)
-	err = node.couchbaseNode.AddNode(remote + ":8091")
+	err = node.couchbaseNode.AddNode(ctx, couchbaseAddress)
 
 	if err != nil {
 		log.Println("Error adding this node to cluster")
@@ -161,6 +259,22 @@ func (node *RaftNode) joinCluster(remote string) error {
 	log.Println("Node successfully added to cluster")
 	return nil
 }
+
+// joinAddresses splits the address to join into the serf address of the
+// remote scout and the REST address of its couchbase. A port in the address
+// is the serf port, couchbase listens on the configured port everywhere.
+func (node *RaftNode) joinAddresses(remote string) (string, string) {
+	host, port, err := net.SplitHostPort(remote)
+	if err != nil {
+		host, port = strings.Trim(remote, "[]"), strconv.Itoa(node.bindPort)
+	}
+
+	couchbasePort := node.config.CouchbasePort
+	if couchbasePort == 0 {
+		couchbasePort = couchbase.DefaultPort
+	}
+	return net.JoinHostPort(host, port), net.JoinHostPort(host, strconv.Itoa(couchbasePort))
+}
 func (node *RaftNode) broadcast() {
 
 	netIP := netaddr.MustNewIPNetwork(node.network)
@@ -278,6 +392,12 @@ func (node *RaftNode) ticker() {
 
 			if isleader {
 				log.Println("node is a leader")
+				node.syncMembers()
+				node.checkPendingRebalance()
+				node.checkFailedOver()
+				node.checkReconcile()
+				node.checkBackup()
+				node.checkMonitor()
 			} else {
 				log.Println("node is a follower")
 				leaderLastSeen := node.store.raft.LastContact()
@@ -308,6 +428,11 @@ func (node *RaftNode) ticker() {
 			isleader := node.IsLeader()
 
 			if memberEvent, ok := voterEvent.(serf.MemberEvent); ok {
+				if isleader {
+					node.queueMembershipChange(memberEvent)
+					node.notifyMembershipChange(memberEvent)
+				}
+
 				for _, member := range memberEvent.Members {
 					changedPeer := member.Addr.String() + ":" + strconv.Itoa(node.raftPort)
 
@@ -326,6 +451,12 @@ func (node *RaftNode) ticker() {
 							if err := future.Error(); err != nil {
 								log.Fatalf("error removing server %s", err)
 							}
+
+							if memberEvent.EventType() == serf.EventMemberReap {
+								if err := node.store.Apply(RemoveNodeCommand, member.Name); err != nil {
+									log.Printf("error forgetting member %s: %s", member.Name, err)
+								}
+							}
 						}
 					}
 				}
@@ -333,3 +464,49 @@ func (node *RaftNode) ticker() {
 		}
 	}
 }
+
+// State returns the replicated cluster state as known by this node.
+func (node *RaftNode) State() ClusterState {
+	return node.fsm.State()
+}
+
+// syncMembers records every serf member in the replicated state so followers
+// know which nodes make up the cluster and the services they run.
+func (node *RaftNode) syncMembers() {
+	for _, member := range node.serfScout.Members() {
+		status := NodeActive
+		switch member.Status {
+		case serf.StatusLeft:
+			status = NodeLeft
+		case serf.StatusFailed:
+			status = NodeFailed
+		}
+
+		services := make([]string, 0)
+		if tag := strings.TrimSpace(member.Tags["services"]); tag != "" {
+			services = strings.Split(tag, ",")
+		}
+
+		zone := member.Tags["zone"]
+		memory, _ := strconv.Atoi(member.Tags["memory"])
+		known, ok := node.fsm.Node(member.Name)
+		if ok && known.Status == status && known.Address == member.Addr.String() && known.Zone == zone && known.MemoryMB == memory && strings.Join(known.Services, ",") == strings.Join(services, ",") {
+			continue
+		}
+
+		nodeState := NodeState{
+			Name:     member.Name,
+			Address:  member.Addr.String(),
+			Services: services,
+			Zone:     zone,
+			MemoryMB: memory,
+			Status:   status,
+			Updated:  time.Now().UTC(),
+		}
+
+		err := node.store.Apply(UpsertNodeCommand, nodeState)
+		if err != nil {
+			log.Printf("error recording member %s: %s", member.Name, err)
+		}
+	}
+}
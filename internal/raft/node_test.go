@@ -0,0 +1,67 @@
+package raft
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/devgenie/scout/internal/couchbase"
+)
+
+func TestJoinAddresses(t *testing.T) {
+	tests := []struct {
+		name      string
+		remote    string
+		port      int
+		member    string
+		couchbase string
+	}{
+		{"host", "10.0.0.1", 0, "10.0.0.1:7946", "10.0.0.1:8091"},
+		{"host and serf port", "10.0.0.1:7000", 0, "10.0.0.1:7000", "10.0.0.1:8091"},
+		{"configured couchbase port", "scout-0.local", 18091, "scout-0.local:7946", "scout-0.local:18091"},
+		{"ipv6", "fd00::1", 0, "[fd00::1]:7946", "[fd00::1]:8091"},
+		{"ipv6 and serf port", "[fd00::1]:7000", 0, "[fd00::1]:7000", "[fd00::1]:8091"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			node := &RaftNode{bindPort: 7946, config: couchbase.Config{CouchbasePort: test.port}}
+			member, address := node.joinAddresses(test.remote)
+			if member != test.member || address != test.couchbase {
+				t.Fatalf("expected %s and %s, got %s and %s", test.member, test.couchbase, member, address)
+			}
+		})
+	}
+}
+
+func TestRetryJoin(t *testing.T) {
+	tests := []struct {
+		name      string
+		failures  int
+		wantCalls int
+		wantError bool
+	}{
+		{"joins at once", 0, 1, false},
+		{"joins after failures", 2, 3, false},
+		{"gives up", 10, 3, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			calls := 0
+			err := retryJoin(func() error {
+				calls++
+				if calls <= test.failures {
+					return fmt.Errorf("connection refused")
+				}
+				return nil
+			}, 3, 0)
+
+			if (err != nil) != test.wantError {
+				t.Fatalf("expected error %v, got %v", test.wantError, err)
+			}
+			if calls != test.wantCalls {
+				t.Fatalf("expected %d attempts, got %d", test.wantCalls, calls)
+			}
+		})
+	}
+}
@@ -0,0 +1,45 @@
+package raft
+
+import (
+	"fmt"
+
+	"github.com/devgenie/scout/internal/notify"
+	"github.com/hashicorp/serf/serf"
+)
+
+// notify hands event to the notification channels. Cluster events are only
+// raised by the leader so every channel hears about them once.
+func (node *RaftNode) notify(event notify.Event) {
+	if node.notifier == nil {
+		return
+	}
+	node.notifier.Notify(event)
+}
+
+func (node *RaftNode) notifyMembershipChange(event serf.MemberEvent) {
+	for _, member := range event.Members {
+		switch event.EventType() {
+		case serf.EventMemberJoin:
+			node.notify(notify.Event{
+				Type:     notify.MemberJoined,
+				Severity: notify.SeverityInfo,
+				Subject:  member.Name,
+				Message:  fmt.Sprintf("%s joined from %s", member.Name, member.Addr),
+			})
+		case serf.EventMemberLeave:
+			node.notify(notify.Event{
+				Type:     notify.MemberLeft,
+				Severity: notify.SeverityWarning,
+				Subject:  member.Name,
+				Message:  fmt.Sprintf("%s left the cluster", member.Name),
+			})
+		case serf.EventMemberFailed:
+			node.notify(notify.Event{
+				Type:     notify.MemberFailed,
+				Severity: notify.SeverityCritical,
+				Subject:  member.Name,
+				Message:  fmt.Sprintf("%s stopped responding", member.Name),
+			})
+		}
+	}
+}
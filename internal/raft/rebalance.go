@@ -0,0 +1,250 @@
+package raft
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync/atomic"
+	"time"
+
+	"github.com/devgenie/scout/internal/couchbase"
+	"github.com/devgenie/scout/internal/metrics"
+	"github.com/devgenie/scout/internal/notify"
+	"github.com/hashicorp/serf/serf"
+)
+
+const (
+	defaultRebalanceWindow = 30 * time.Second
+	rebalanceStallTimeout  = 10 * time.Minute
+)
+
+// rebalancePollInterval is how often a running rebalance is polled, tests
+// shorten it.
+var rebalancePollInterval = 5 * time.Second
+
+type membershipChange struct {
+	Name  string
+	Event serf.EventType
+}
+
+// queueMembershipChange adds the members of a serf event to the pending batch
+// and restarts the settle window.
+func (node *RaftNode) queueMembershipChange(event serf.MemberEvent) {
+	queued := false
+	for _, member := range event.Members {
+		if member.Name == node.hostname && event.EventType() == serf.EventMemberJoin {
+			continue
+		}
+
+		switch event.EventType() {
+		case serf.EventMemberJoin, serf.EventMemberLeave, serf.EventMemberFailed:
+			node.pendingChanges = append(node.pendingChanges, membershipChange{Name: member.Name, Event: event.EventType()})
+			queued = true
+		}
+	}
+
+	if queued {
+		node.settleDeadline = time.Now().Add(node.rebalanceWindow())
+	}
+}
+
+// checkPendingRebalance starts a rebalance for the pending batch once the
+// settle window has passed and no other rebalance is running.
+func (node *RaftNode) checkPendingRebalance() {
+	if len(node.pendingChanges) == 0 || time.Now().Before(node.settleDeadline) {
+		return
+	}
+
+	if !atomic.CompareAndSwapInt32(&node.rebalancing, 0, 1) {
+		log.Println("a rebalance is still running, holding back membership changes")
+		return
+	}
+
+	batch := node.pendingChanges
+	node.pendingChanges = nil
+
+	go func() {
+		defer atomic.StoreInt32(&node.rebalancing, 0)
+		node.rebalanceMembers(batch)
+	}()
+}
+
+// RebalanceNow starts a rebalance of the current members in the background,
+// it must be called on the leader. It is refused while failed over members
+// are within their grace period, the rebalance would eject them.
+func (node *RaftNode) RebalanceNow() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	_, held, err := node.failovers(ctx)
+	if err != nil {
+		return err
+	}
+	if len(held) > 0 {
+		return heldFailoversError(held)
+	}
+
+	if !atomic.CompareAndSwapInt32(&node.rebalancing, 0, 1) {
+		return fmt.Errorf("a rebalance is already running")
+	}
+
+	go func() {
+		defer atomic.StoreInt32(&node.rebalancing, 0)
+		node.rebalanceMembers(nil)
+	}()
+	return nil
+}
+
+func (node *RaftNode) rebalanceMembers(batch []membershipChange) {
+	names := make([]string, 0, len(batch))
+	lastEvent := make(map[string]serf.EventType)
+
+	for _, change := range batch {
+		if _, ok := lastEvent[change.Name]; !ok {
+			names = append(names, change.Name)
+		}
+		lastEvent[change.Name] = change.Event
+	}
+
+	now := time.Now().UTC()
+	operation := Operation{
+		ID:      fmt.Sprintf("rebalance-%d", now.UnixNano()),
+		Type:    "rebalance",
+		Status:  OperationRunning,
+		Nodes:   names,
+		Created: now,
+		Updated: now,
+	}
+	node.recordOperation(operation)
+
+	departed := make(map[string]serf.EventType)
+	for _, name := range names {
+		if lastEvent[name] != serf.EventMemberJoin {
+			departed[name] = lastEvent[name]
+		}
+	}
+
+	ctx := context.Background()
+	node.assignServerGroups(ctx)
+
+	for _, name := range names {
+		if lastEvent[name] == serf.EventMemberJoin {
+			node.recoverMember(ctx, name)
+		}
+	}
+
+	ejected, failedOver, err := node.failoverDeparted(ctx, departed)
+	if err == nil && len(failedOver) > 0 {
+		// Rebalancing now would eject the members just failed over, they
+		// are rebalanced once they come back or their grace period passed.
+		log.Printf("failed over %v, holding back the rebalance for %s or until they return", failedOver, node.failoverGracePeriod())
+		operation.Status = OperationCompleted
+		operation.Progress = 100
+		operation.Message = fmt.Sprintf("failed over %v, rebalance held back until they return or their grace period passed", failedOver)
+		node.recordOperation(operation)
+		return
+	}
+	if err == nil {
+		var expired, held []string
+		expired, held, err = node.failovers(ctx)
+		if err == nil && len(held) > 0 {
+			err = heldFailoversError(held)
+		}
+		ejected = append(ejected, expired...)
+	}
+	if err == nil {
+		log.Printf("rebalancing after membership changes of %v, ejecting %v", names, ejected)
+		err = node.couchbaseNode.Rebalance(ctx, ejected)
+	}
+
+	if err != nil {
+		operation.Status = OperationFailed
+		operation.Message = err.Error()
+		node.recordOperation(operation)
+		node.reportRebalance(operation)
+		return
+	}
+
+	result := node.couchbaseNode.WaitForRebalance(ctx, rebalancePollInterval, rebalanceStallTimeout)
+	log.Printf("rebalance %s finished: %s %s", operation.ID, result.Status, result.Message)
+
+	switch result.Status {
+	case couchbase.RebalanceCompleted:
+		operation.Status = OperationCompleted
+	case couchbase.RebalanceStalled:
+		operation.Status = OperationStalled
+	default:
+		operation.Status = OperationFailed
+	}
+	operation.Progress = result.Progress
+	operation.Message = result.Message
+	node.recordOperation(operation)
+	node.reportRebalance(operation)
+}
+
+func heldFailoversError(held []string) error {
+	return fmt.Errorf("failed over nodes %v are within their grace period, a rebalance would eject them", held)
+}
+
+func (node *RaftNode) reportRebalance(operation Operation) {
+	metrics.Default.Add("scout_rebalances_total", metrics.Labels{"result": operation.Status}, 1)
+
+	event := notify.Event{
+		Type:     notify.RebalanceCompleted,
+		Severity: notify.SeverityInfo,
+		Subject:  operation.ID,
+		Message:  fmt.Sprintf("rebalance of %v completed", operation.Nodes),
+	}
+
+	switch operation.Status {
+	case OperationStalled:
+		event.Type = notify.RebalanceStalled
+		event.Severity = notify.SeverityWarning
+		event.Message = fmt.Sprintf("rebalance of %v stalled at %.0f%%: %s", operation.Nodes, operation.Progress, operation.Message)
+	case OperationFailed:
+		event.Type = notify.RebalanceFailed
+		event.Severity = notify.SeverityCritical
+		event.Message = fmt.Sprintf("rebalance of %v failed: %s", operation.Nodes, operation.Message)
+	}
+	node.notify(event)
+}
+
+// assignServerGroups places every active node in the server group named after
+// its zone so couchbase keeps replicas out of the zone of their active copy.
+func (node *RaftNode) assignServerGroups(ctx context.Context) {
+	assignments := make(map[string]string)
+	for name, member := range node.fsm.State().Nodes {
+		if member.Zone != "" && member.Status == NodeActive {
+			assignments[name] = member.Zone
+		}
+	}
+
+	if len(assignments) == 0 {
+		return
+	}
+
+	moved, err := node.couchbaseNode.AssignServerGroups(ctx, assignments)
+	if err != nil {
+		log.Printf("error assigning server groups, rebalancing without them: %s", err)
+		return
+	}
+
+	if moved {
+		log.Printf("assigned nodes to server groups %v", assignments)
+	}
+}
+
+func (node *RaftNode) recordOperation(operation Operation) {
+	operation.Updated = time.Now().UTC()
+	err := node.store.Apply(UpsertOperationCommand, operation)
+	if err != nil {
+		log.Printf("error recording operation %s: %s", operation.ID, err)
+	}
+}
+
+func (node *RaftNode) rebalanceWindow() time.Duration {
+	if node.config.RebalanceWindow > 0 {
+		return node.config.RebalanceWindow
+	}
+	return defaultRebalanceWindow
+}
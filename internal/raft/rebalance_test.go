@@ -0,0 +1,282 @@
+package raft
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/devgenie/scout/internal/couchbase"
+	"github.com/hashicorp/raft"
+	"github.com/hashicorp/serf/serf"
+)
+
+func init() {
+	rebalancePollInterval = 10 * time.Millisecond
+}
+
+// fakeCouchbase serves the cluster endpoints used by rebalances and records
+// the controller requests it receives.
+type fakeCouchbase struct {
+	mutex    sync.Mutex
+	members  []couchbase.ClusterNode
+	replicas int
+	requests []string
+}
+
+func (fake *fakeCouchbase) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+
+	if r.Method == "POST" {
+		fake.requests = append(fake.requests, r.URL.Path)
+	}
+	r.ParseForm()
+
+	switch r.URL.Path {
+	case "/pools/default":
+		json.NewEncoder(w).Encode(map[string]interface{}{"nodes": fake.members})
+	case "/pools/default/buckets":
+		json.NewEncoder(w).Encode([]map[string]interface{}{{"name": "a", "bucketType": "membase", "replicaNumber": fake.replicas}})
+	case "/pools/default/rebalanceProgress":
+		w.Write([]byte(`{"status":"none"}`))
+	case "/pools/default/tasks":
+		w.Write([]byte(`[{"type":"rebalance","status":"notRunning"}]`))
+	case "/controller/failOver":
+		fake.setMember(r.PostForm.Get("otpNode"), func(member *couchbase.ClusterNode) {
+			member.ClusterMembership = "inactiveFailed"
+			member.RecoveryType = "none"
+		})
+	case "/controller/setRecoveryType":
+		fake.setMember(r.PostForm.Get("otpNode"), func(member *couchbase.ClusterNode) {
+			member.RecoveryType = r.PostForm.Get("recoveryType")
+		})
+	}
+}
+
+func (fake *fakeCouchbase) setMember(otpNode string, update func(member *couchbase.ClusterNode)) {
+	for i := range fake.members {
+		if fake.members[i].OTPNode == otpNode {
+			update(&fake.members[i])
+		}
+	}
+}
+
+func (fake *fakeCouchbase) requested(path string) int {
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+
+	count := 0
+	for _, request := range fake.requests {
+		if request == path {
+			count++
+		}
+	}
+	return count
+}
+
+// testLeader returns the leader of a single node raft cluster kept in memory,
+// talking to couchbase through handler, and a function stopping both.
+func testLeader(t *testing.T, handler http.Handler) (*RaftNode, func()) {
+	t.Helper()
+	server := httptest.NewServer(handler)
+	host, port, err := net.SplitHostPort(server.Listener.Addr().String())
+	if err != nil {
+		server.Close()
+		t.Fatal(err)
+	}
+	number, _ := strconv.Atoi(port)
+
+	fsm := NewFSM()
+	config := raft.DefaultConfig()
+	config.LocalID = "test"
+	config.HeartbeatTimeout = 50 * time.Millisecond
+	config.ElectionTimeout = 50 * time.Millisecond
+	config.LeaderLeaseTimeout = 50 * time.Millisecond
+	config.CommitTimeout = 5 * time.Millisecond
+	config.LogOutput = ioutil.Discard
+
+	store := raft.NewInmemStore()
+	address, transport := raft.NewInmemTransport("")
+	rafter, err := raft.NewRaft(config, fsm, store, store, raft.NewInmemSnapshotStore(), transport)
+	if err != nil {
+		server.Close()
+		t.Fatal(err)
+	}
+	rafter.BootstrapCluster(raft.Configuration{Servers: []raft.Server{{ID: config.LocalID, Address: address}}})
+
+	stop := func() {
+		rafter.Shutdown().Error()
+		server.Close()
+	}
+	for deadline := time.Now().Add(5 * time.Second); rafter.State() != raft.Leader; time.Sleep(10 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			stop()
+			t.Fatal("no leader elected")
+		}
+	}
+
+	node := &RaftNode{
+		hostname:      "a",
+		fsm:           fsm,
+		store:         &RaftStore{raft: rafter, fsm: fsm},
+		couchbaseNode: couchbase.NewCouchbaseNode(host, number),
+	}
+	return node, stop
+}
+
+func TestRebalanceMembersHoldsBackAfterFailover(t *testing.T) {
+	fake := &fakeCouchbase{
+		replicas: 1,
+		members: []couchbase.ClusterNode{
+			{OTPNode: "ns_1@a", Hostname: "a:8091", ClusterMembership: "active"},
+			{OTPNode: "ns_1@b", Hostname: "b:8091", ClusterMembership: "active"},
+		},
+	}
+	node, stop := testLeader(t, fake)
+	defer stop()
+	node.fsm.state.Nodes["b"] = NodeState{Name: "b", Status: NodeFailed, Updated: time.Now()}
+
+	node.rebalanceMembers([]membershipChange{{Name: "b", Event: serf.EventMemberFailed}})
+
+	if fake.requested("/controller/failOver") != 1 {
+		t.Fatalf("expected b to be failed over, got requests %v", fake.requests)
+	}
+	if fake.requested("/controller/rebalance") != 0 {
+		t.Fatalf("expected no rebalance right after the failover, got requests %v", fake.requests)
+	}
+
+	for _, operation := range node.fsm.State().Operations {
+		if operation.Status != OperationCompleted {
+			t.Fatalf("expected the operation to complete, got %+v", operation)
+		}
+	}
+}
+
+func TestRebalanceWithFailedOverMembers(t *testing.T) {
+	tests := []struct {
+		name      string
+		recovery  string
+		updated   time.Duration
+		rebalance bool
+	}{
+		{"within the grace period", "none", 0, false},
+		{"recovering", couchbase.RecoveryDelta, 0, true},
+		{"past the grace period", "none", -2 * time.Hour, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			fake := &fakeCouchbase{
+				replicas: 1,
+				members: []couchbase.ClusterNode{
+					{OTPNode: "ns_1@a", Hostname: "a:8091", ClusterMembership: "active"},
+					{OTPNode: "ns_1@b", Hostname: "b:8091", ClusterMembership: "inactiveFailed", RecoveryType: test.recovery},
+				},
+			}
+			node, stop := testLeader(t, fake)
+			defer stop()
+			node.fsm.state.Nodes["b"] = NodeState{Name: "b", Status: NodeFailed, Updated: time.Now().Add(test.updated)}
+
+			err := node.RebalanceNow()
+			if (err == nil) != test.rebalance {
+				t.Fatalf("expected rebalance %t, got %v", test.rebalance, err)
+			}
+
+			// The rebalance started by RebalanceNow runs in the background.
+			for deadline := time.Now().Add(2 * time.Second); atomic.LoadInt32(&node.rebalancing) == 1; time.Sleep(10 * time.Millisecond) {
+				if time.Now().After(deadline) {
+					t.Fatal("the rebalance did not finish")
+				}
+			}
+
+			node.rebalanceMembers([]membershipChange{{Name: "c", Event: serf.EventMemberJoin}})
+			want := 0
+			if test.rebalance {
+				want = 2
+			}
+			if got := fake.requested("/controller/rebalance"); got != want {
+				t.Fatalf("expected %d rebalances, got %d", want, got)
+			}
+		})
+	}
+}
+
+func TestMembershipChangesBatched(t *testing.T) {
+	fake := &fakeCouchbase{
+		replicas: 2,
+		members: []couchbase.ClusterNode{
+			{OTPNode: "ns_1@a", Hostname: "a:8091", ClusterMembership: "active"},
+			{OTPNode: "ns_1@b", Hostname: "b:8091", ClusterMembership: "active"},
+			{OTPNode: "ns_1@c", Hostname: "c:8091", ClusterMembership: "inactiveFailed", RecoveryType: "none"},
+		},
+	}
+	node, stop := testLeader(t, fake)
+	defer stop()
+	node.config.RebalanceWindow = 100 * time.Millisecond
+
+	event := func(eventType serf.EventType, names ...string) serf.MemberEvent {
+		members := make([]serf.Member, 0, len(names))
+		for _, name := range names {
+			members = append(members, serf.Member{Name: name})
+		}
+		return serf.MemberEvent{Type: eventType, Members: members}
+	}
+
+	// b comes and goes while c returns, only their last event counts.
+	node.queueMembershipChange(event(serf.EventMemberJoin, "a", "b"))
+	node.queueMembershipChange(event(serf.EventMemberFailed, "c"))
+	first := node.settleDeadline
+	time.Sleep(20 * time.Millisecond)
+	node.queueMembershipChange(event(serf.EventMemberJoin, "c"))
+	node.queueMembershipChange(event(serf.EventMemberFailed, "b"))
+
+	if !node.settleDeadline.After(first) {
+		t.Fatalf("expected the last change to restart the settle window")
+	}
+	if len(node.pendingChanges) != 4 {
+		t.Fatalf("expected 4 pending changes without the join of this node, got %v", node.pendingChanges)
+	}
+
+	node.checkPendingRebalance()
+	if atomic.LoadInt32(&node.rebalancing) != 0 || len(node.pendingChanges) == 0 {
+		t.Fatalf("expected the batch to wait for the settle window")
+	}
+
+	time.Sleep(time.Until(node.settleDeadline))
+	node.checkPendingRebalance()
+	if len(node.pendingChanges) != 0 {
+		t.Fatalf("expected the batch to be taken, got %v", node.pendingChanges)
+	}
+	for deadline := time.Now().Add(2 * time.Second); atomic.LoadInt32(&node.rebalancing) == 1; time.Sleep(10 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("the rebalance did not finish")
+		}
+	}
+
+	operations := node.fsm.State().Operations
+	if len(operations) != 1 {
+		t.Fatalf("expected a single operation for the batch, got %v", operations)
+	}
+	for _, operation := range operations {
+		if !reflect.DeepEqual(operation.Nodes, []string{"b", "c"}) {
+			t.Fatalf("expected the operation to cover b and c, got %v", operation.Nodes)
+		}
+	}
+
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+	if b := fake.members[1]; b.ClusterMembership != "inactiveFailed" {
+		t.Fatalf("expected b to be failed over, got %+v", b)
+	}
+	if c := fake.members[2]; c.RecoveryType != couchbase.RecoveryDelta {
+		t.Fatalf("expected c to be recovered, got %+v", c)
+	}
+}
@@ -0,0 +1,218 @@
+package raft
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync/atomic"
+	"time"
+
+	"github.com/devgenie/scout/internal/couchbase"
+)
+
+const (
+	defaultReconcileInterval = time.Minute
+	reconcileTimeout         = 5 * time.Minute
+)
+
+// ReconcileResult describes the last pass of the leader over the declared
+// configuration.
+type ReconcileResult struct {
+	Started  time.Time
+	Finished time.Time
+	Changes  []string
+	Warnings []string
+	Errors   []string
+}
+
+type reconcileStep struct {
+	name string
+	run  func(ctx context.Context, result *ReconcileResult) error
+}
+
+// checkReconcile starts a reconcile pass when the interval has passed since
+// the previous one and none is running.
+func (node *RaftNode) checkReconcile() {
+	if time.Since(node.lastReconcile) < node.reconcileInterval() {
+		return
+	}
+
+	if !atomic.CompareAndSwapInt32(&node.reconciling, 0, 1) {
+		return
+	}
+	node.lastReconcile = time.Now()
+
+	go func() {
+		defer atomic.StoreInt32(&node.reconciling, 0)
+		node.reconcile()
+	}()
+}
+
+func (node *RaftNode) reconcile() {
+	ctx, cancel := context.WithTimeout(context.Background(), reconcileTimeout)
+	defer cancel()
+
+	result := ReconcileResult{
+		Started:  time.Now().UTC(),
+		Changes:  make([]string, 0),
+		Warnings: make([]string, 0),
+		Errors:   make([]string, 0),
+	}
+
+	steps := []reconcileStep{
+		{"settings", node.reconcileSettings},
+		{"buckets", node.reconcileBuckets},
+		{"users", node.reconcileUsers},
+		{"indexes", node.reconcileIndexes},
+		{"xdcr", node.reconcileXDCR},
+	}
+
+	for _, step := range steps {
+		err := step.run(ctx, &result)
+		if err != nil {
+			log.Printf("error reconciling %s: %s", step.name, err)
+			result.Errors = append(result.Errors, fmt.Sprintf("%s: %s", step.name, err))
+		}
+	}
+
+	result.Finished = time.Now().UTC()
+	for _, change := range result.Changes {
+		log.Println("reconcile:", change)
+	}
+	for _, warning := range result.Warnings {
+		log.Println("reconcile warning:", warning)
+	}
+
+	node.reconcileMutex.Lock()
+	node.reconcileResult = &result
+	node.reconcileMutex.Unlock()
+}
+
+// LastReconcile returns the result of the last reconcile pass run by this
+// node, nil if it never ran one.
+func (node *RaftNode) LastReconcile() *ReconcileResult {
+	node.reconcileMutex.Lock()
+	defer node.reconcileMutex.Unlock()
+	return node.reconcileResult
+}
+
+// reconcileBuckets publishes the buckets declared in the config to the
+// replicated state, then creates the missing ones and updates drifted ones.
+// Buckets that are not declared are reported, they are only deleted when
+// they were removed from the config and prunebuckets is set.
+func (node *RaftNode) reconcileBuckets(ctx context.Context, result *ReconcileResult) error {
+	undeclared, err := node.publishBuckets()
+	if err != nil {
+		return err
+	}
+
+	existing, err := node.couchbaseNode.Buckets(ctx)
+	if err != nil {
+		return err
+	}
+
+	actual := make(map[string]couchbase.BucketConfig)
+	for _, bucket := range existing {
+		actual[bucket.Name] = bucket
+	}
+
+	dropped := make(map[string]bool)
+	for _, name := range undeclared {
+		dropped[name] = true
+	}
+
+	desired := node.fsm.State().Buckets
+	for name, state := range desired {
+		if dropped[name] {
+			continue
+		}
+
+		declared := couchbase.BucketConfig(state)
+		bucket, ok := actual[name]
+
+		if !ok {
+			err = node.couchbaseNode.AddBucket(ctx, declared)
+			if err != nil {
+				result.Errors = append(result.Errors, err.Error())
+				continue
+			}
+			result.Changes = append(result.Changes, fmt.Sprintf("created bucket %s", name))
+			continue
+		}
+
+		if bucket.Drifted(declared) {
+			err = node.couchbaseNode.UpdateBucket(ctx, declared)
+			if err != nil {
+				result.Errors = append(result.Errors, err.Error())
+				continue
+			}
+			result.Changes = append(result.Changes, fmt.Sprintf("updated bucket %s", name))
+		}
+	}
+
+	for _, name := range undeclared {
+		if _, ok := actual[name]; ok && node.config.PruneBuckets {
+			err = node.couchbaseNode.DeleteBucket(ctx, name, false)
+			if err != nil && !couchbase.IsNotFound(err) {
+				// A bucket that still holds documents is never dropped
+				// because it vanished from the config. It stays in the
+				// replicated state so the next pass tries again.
+				result.Errors = append(result.Errors, err.Error())
+				continue
+			}
+			result.Changes = append(result.Changes, fmt.Sprintf("deleted bucket %s", name))
+			delete(actual, name)
+		}
+
+		err = node.store.Apply(RemoveBucketCommand, name)
+		if err != nil {
+			return err
+		}
+	}
+
+	for name := range actual {
+		if _, ok := desired[name]; ok && !dropped[name] {
+			continue
+		}
+		result.Warnings = append(result.Warnings, fmt.Sprintf("bucket %s is not declared in the config, delete it with DELETE /v1/buckets/%s", name, name))
+	}
+
+	return nil
+}
+
+// publishBuckets makes the replicated bucket definitions match the config of
+// the leader. It returns the replicated buckets that are no longer declared.
+func (node *RaftNode) publishBuckets() ([]string, error) {
+	known := node.fsm.State().Buckets
+	declared := make(map[string]bool)
+
+	for _, bucket := range node.config.Buckets {
+		declared[bucket.Name] = true
+		desired := BucketState(bucket)
+
+		if current, ok := known[bucket.Name]; ok && current == desired {
+			continue
+		}
+
+		err := node.store.Apply(UpsertBucketCommand, desired)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	undeclared := make([]string, 0)
+	for name := range known {
+		if !declared[name] {
+			undeclared = append(undeclared, name)
+		}
+	}
+
+	return undeclared, nil
+}
+
+func (node *RaftNode) reconcileInterval() time.Duration {
+	if node.config.ReconcileInterval > 0 {
+		return node.config.ReconcileInterval
+	}
+	return defaultReconcileInterval
+}
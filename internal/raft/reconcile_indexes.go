@@ -0,0 +1,82 @@
+package raft
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/devgenie/scout/internal/couchbase"
+)
+
+// reconcileIndexes creates the declared indexes that are missing, builds the
+// declared ones that are still deferred and warns about undeclared ones and
+// about existing ones whose definition differs from the config. Those are
+// never dropped, rebuilding an index is left to the operator.
+func (node *RaftNode) reconcileIndexes(ctx context.Context, result *ReconcileResult) error {
+	if len(node.config.Indexes) == 0 {
+		// Without a query service there are no indexes to report either.
+		_, err := node.couchbaseNode.QueryAddress(ctx)
+		if err == couchbase.ErrNoQueryService {
+			return nil
+		}
+	}
+
+	existing, err := node.couchbaseNode.Indexes(ctx)
+	if err != nil {
+		return err
+	}
+
+	infos := make(map[string]couchbase.IndexInfo)
+	for _, index := range existing {
+		infos[index.Bucket+"/"+index.Name] = index
+	}
+
+	declared := make(map[string]bool)
+	deferred := make(map[string][]string)
+
+	for _, index := range node.config.Indexes {
+		key := index.Bucket + "/" + index.Name
+		declared[key] = true
+
+		info, ok := infos[key]
+		state := info.State
+		if ok {
+			for _, difference := range info.Differences(index) {
+				result.Warnings = append(result.Warnings, fmt.Sprintf("index %s differs from the config: %s", key, difference))
+			}
+		} else {
+			err = node.couchbaseNode.CreateIndex(ctx, index)
+			if err != nil {
+				result.Errors = append(result.Errors, err.Error())
+				continue
+			}
+			result.Changes = append(result.Changes, fmt.Sprintf("created index %s", key))
+
+			if !index.Deferred {
+				continue
+			}
+			state = "deferred"
+		}
+
+		if state == "deferred" || state == "created" {
+			deferred[index.Bucket] = append(deferred[index.Bucket], index.Name)
+		}
+	}
+
+	for bucket, names := range deferred {
+		err = node.couchbaseNode.BuildIndexes(ctx, bucket, names)
+		if err != nil {
+			result.Errors = append(result.Errors, err.Error())
+			continue
+		}
+		result.Changes = append(result.Changes, fmt.Sprintf("building indexes %v on %s", names, bucket))
+	}
+
+	for _, index := range existing {
+		key := index.Bucket + "/" + index.Name
+		if !declared[key] {
+			result.Warnings = append(result.Warnings, fmt.Sprintf("index %s is not declared in the config", key))
+		}
+	}
+
+	return nil
+}
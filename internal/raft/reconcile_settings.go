@@ -0,0 +1,119 @@
+package raft
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/devgenie/scout/internal/couchbase"
+)
+
+// clusterSettingGroups are the prefixes of replicated settings owned by the
+// cluster: section of the config.
+var clusterSettingGroups = []string{"pools.", "indexes.", "autoFailover."}
+
+// reconcileSettings publishes the declared cluster settings to the
+// replicated state and applies the ones that drifted. Settings couchbase only
+// accepts at bootstrap are reported instead.
+func (node *RaftNode) reconcileSettings(ctx context.Context, result *ReconcileResult) error {
+	cluster := node.clusterConfig()
+	declared := cluster.Values()
+
+	err := node.publishSettings(declared)
+	if err != nil {
+		return err
+	}
+
+	current, err := node.couchbaseNode.ClusterSettings(ctx)
+	if err != nil {
+		return err
+	}
+
+	drifted := make([]string, 0)
+	for _, key := range couchbase.DriftedSettings(current, declared) {
+		if couchbase.IsBootstrapSetting(key) {
+			result.Warnings = append(result.Warnings, fmt.Sprintf("cluster setting %s is %q instead of %q, it can only be set when the cluster is created", key, current[key], declared[key]))
+			continue
+		}
+		drifted = append(drifted, key)
+	}
+	if len(drifted) == 0 {
+		return nil
+	}
+
+	err = node.couchbaseNode.ApplyClusterSettings(ctx, cluster, drifted)
+	if err != nil {
+		return err
+	}
+
+	result.Changes = append(result.Changes, fmt.Sprintf("applied cluster settings %v", drifted))
+	return nil
+}
+
+// clusterConfig returns the cluster section of the config, with the memory
+// quotas it leaves unset sized for the smallest node running each service
+// when the memory policy is enabled.
+func (node *RaftNode) clusterConfig() couchbase.ClusterConfig {
+	cluster := node.config.Cluster
+	if !cluster.MemoryPolicy.Enabled {
+		return cluster
+	}
+
+	quotas := make(map[string]int)
+	for _, member := range node.fsm.State().Nodes {
+		if member.Status != NodeActive || member.MemoryMB == 0 {
+			continue
+		}
+
+		memberQuotas, err := cluster.MemoryPolicy.Quotas(member.MemoryMB, member.Services)
+		if err != nil {
+			log.Printf("error sizing memory quotas for %s: %s", member.Name, err)
+			continue
+		}
+		for service, quota := range memberQuotas {
+			if current, ok := quotas[service]; !ok || quota < current {
+				quotas[service] = quota
+			}
+		}
+	}
+
+	return cluster.WithQuotas(quotas)
+}
+
+func (node *RaftNode) publishSettings(declared map[string]string) error {
+	known := node.fsm.State().Settings
+
+	for key, value := range declared {
+		if current, ok := known[key]; ok && current == value {
+			continue
+		}
+
+		err := node.store.Apply(SetSettingCommand, Setting{Key: key, Value: value})
+		if err != nil {
+			return err
+		}
+	}
+
+	for key := range known {
+		if _, ok := declared[key]; ok || !isClusterSetting(key) {
+			continue
+		}
+
+		err := node.store.Apply(DeleteSettingCommand, key)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func isClusterSetting(key string) bool {
+	for _, group := range clusterSettingGroups {
+		if strings.HasPrefix(key, group) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,142 @@
+package raft
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/devgenie/scout/internal/couchbase"
+)
+
+func TestReconcilePrunedBuckets(t *testing.T) {
+	tests := []struct {
+		name   string
+		items  int
+		status int
+		kept   bool
+	}{
+		{"deleted", 0, http.StatusOK, false},
+		{"already gone", 0, http.StatusNotFound, false},
+		{"holds documents", 10, http.StatusOK, true},
+		{"refused by couchbase", 0, http.StatusBadRequest, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			node, stop := testLeader(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				switch {
+				case r.URL.Path == "/pools/default/buckets":
+					w.Write([]byte(`[{"name":"old","bucketType":"membase"}]`))
+				case r.URL.Path == "/pools/default/buckets/old" && r.Method == "GET":
+					fmt.Fprintf(w, `{"name":"old","basicStats":{"itemCount":%d}}`, test.items)
+				case r.URL.Path == "/pools/default/buckets/old" && r.Method == "DELETE":
+					w.WriteHeader(test.status)
+				}
+			}))
+			defer stop()
+
+			node.config.PruneBuckets = true
+			err := node.store.Apply(UpsertBucketCommand, BucketState(couchbase.BucketConfig{Name: "old", BucketType: "couchbase"}))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			result := &ReconcileResult{}
+			err = node.reconcileBuckets(context.Background(), result)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			_, kept := node.fsm.State().Buckets["old"]
+			if kept != test.kept {
+				t.Fatalf("expected kept %t, got %t with %+v", test.kept, kept, result)
+			}
+			if kept && len(result.Errors) == 0 {
+				t.Fatalf("expected the failed delete to be reported")
+			}
+		})
+	}
+}
+
+func TestReconcileUndeclaredIndexes(t *testing.T) {
+	tests := []struct {
+		name     string
+		query    bool
+		warnings []string
+	}{
+		{"reported without declared indexes", true, []string{"index orders/by_date is not declared in the config"}},
+		{"no query service", false, nil},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			node, stop := testLeader(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				switch r.URL.Path {
+				case "/pools/default/nodeServices":
+					services := `{"kv":11210}`
+					if test.query {
+						_, port, _ := net.SplitHostPort(r.Host)
+						services = fmt.Sprintf(`{"kv":11210,"n1ql":%s}`, port)
+					}
+					fmt.Fprintf(w, `{"nodesExt":[{"thisNode":true,"services":%s}]}`, services)
+				case "/query/service":
+					w.Write([]byte(`{"results":[{"name":"by_date","keyspace_id":"orders","state":"online","index_key":["` + "`date`" + `"]}]}`))
+				}
+			}))
+			defer stop()
+
+			result := &ReconcileResult{}
+			err := node.reconcileIndexes(context.Background(), result)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(result.Warnings, test.warnings) {
+				t.Fatalf("expected warnings %v, got %v", test.warnings, result.Warnings)
+			}
+		})
+	}
+}
+
+func TestReconcileSettings(t *testing.T) {
+	var mutex sync.Mutex
+	posted := make([]string, 0)
+	node, stop := testLeader(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "POST" {
+			mutex.Lock()
+			posted = append(posted, r.URL.Path)
+			mutex.Unlock()
+			return
+		}
+
+		switch r.URL.Path {
+		case "/pools/default":
+			w.Write([]byte(`{"memoryQuota":512}`))
+		case "/settings/indexes":
+			w.Write([]byte(`{"storageMode":"forestdb"}`))
+		case "/settings/autoFailover":
+			w.Write([]byte(`{"enabled":true,"timeout":3600,"failoverOnDataDiskIssues":{"enabled":false,"timePeriod":120}}`))
+		}
+	}))
+	defer stop()
+	node.config.Cluster = couchbase.ClusterConfig{MemoryQuotaMB: 1024, IndexStorageMode: "plasma"}
+
+	result := &ReconcileResult{}
+	err := node.reconcileSettings(context.Background(), result)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	if !reflect.DeepEqual(posted, []string{"/pools/default"}) {
+		t.Fatalf("expected only the drifted memory quota to be applied, got %v", posted)
+	}
+	if len(result.Warnings) != 1 || !strings.Contains(result.Warnings[0], "indexes.storageMode") {
+		t.Fatalf("expected the storage mode drift to be reported, got %v", result.Warnings)
+	}
+}
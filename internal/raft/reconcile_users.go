@@ -0,0 +1,99 @@
+package raft
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+
+	"github.com/devgenie/scout/internal/couchbase"
+)
+
+// reconcileUsers saves declared users that are missing, drifted or changed
+// since they were last applied and revokes users that were removed from the
+// config. Users scout never managed are left alone.
+func (node *RaftNode) reconcileUsers(ctx context.Context, result *ReconcileResult) error {
+	existing, err := node.couchbaseNode.Users(ctx)
+	if err != nil {
+		return err
+	}
+
+	actual := make(map[string]couchbase.UserConfig)
+	for _, user := range existing {
+		actual[user.Name] = user
+	}
+
+	known := node.fsm.State().Users
+	declared := make(map[string]bool)
+
+	for _, user := range node.config.Users {
+		declared[user.Name] = true
+		desired := userState(user, node.config.Password)
+
+		current, managed := actual[user.Name]
+		applied, ok := known[user.Name]
+		if managed && ok && current.SameRoles(user) && applied.PasswordHash == desired.PasswordHash && applied.FullName == desired.FullName {
+			continue
+		}
+
+		err = node.couchbaseNode.UpsertUser(ctx, user)
+		if err != nil {
+			result.Errors = append(result.Errors, err.Error())
+			continue
+		}
+
+		err = node.store.Apply(UpsertUserCommand, desired)
+		if err != nil {
+			return err
+		}
+		result.Changes = append(result.Changes, fmt.Sprintf("saved user %s", user.Name))
+	}
+
+	for name := range known {
+		if declared[name] {
+			continue
+		}
+
+		err = node.couchbaseNode.DeleteUser(ctx, name)
+		if err != nil && !couchbase.IsNotFound(err) {
+			result.Errors = append(result.Errors, err.Error())
+			continue
+		}
+
+		err = node.store.Apply(RemoveUserCommand, name)
+		if err != nil {
+			return err
+		}
+		result.Changes = append(result.Changes, fmt.Sprintf("revoked user %s", name))
+	}
+
+	return nil
+}
+
+// userState is the replicated record of a user. The password is only
+// recorded as an HMAC keyed with the admin password, which every node reads
+// from its config and which never enters the raft log, so the log cannot be
+// used to guess user passwords.
+func userState(user couchbase.UserConfig, secret string) UserState {
+	return UserState{
+		Name:         user.Name,
+		FullName:     user.FullName,
+		Roles:        append([]string(nil), user.Roles...),
+		PasswordHash: fingerprint(secret, user.Name, user.Password),
+	}
+}
+
+// fingerprint is an HMAC of parts keyed with secret, it tells whether a
+// password changed without replicating anything the password can be guessed
+// from. Parts are separated by a zero byte.
+func fingerprint(secret string, parts ...string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	for i, part := range parts {
+		if i > 0 {
+			mac.Write([]byte{0})
+		}
+		mac.Write([]byte(part))
+	}
+	return hex.EncodeToString(mac.Sum(nil))
+}
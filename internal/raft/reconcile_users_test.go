@@ -0,0 +1,37 @@
+package raft
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/devgenie/scout/internal/couchbase"
+)
+
+func TestUserStatePassword(t *testing.T) {
+	user := couchbase.UserConfig{Name: "app", Password: "secret"}
+	base := userState(user, "admin").PasswordHash
+
+	tests := []struct {
+		name   string
+		user   couchbase.UserConfig
+		key    string
+		differ bool
+	}{
+		{"same password and key", user, "admin", false},
+		{"changed password", couchbase.UserConfig{Name: "app", Password: "other"}, "admin", true},
+		{"changed key", user, "rotated", true},
+		{"name and password boundary", couchbase.UserConfig{Name: "app:", Password: "ecret"}, "admin", true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			hash := userState(test.user, test.key).PasswordHash
+			if (hash != base) != test.differ {
+				t.Fatalf("expected differ %t, got %s and %s", test.differ, base, hash)
+			}
+			if strings.Contains(hash, test.user.Password) {
+				t.Fatalf("password leaked into %s", hash)
+			}
+		})
+	}
+}
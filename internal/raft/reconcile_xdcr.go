@@ -0,0 +1,127 @@
+package raft
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/devgenie/scout/internal/couchbase"
+)
+
+// reconcileXDCR makes sure the declared remote cluster references and
+// replications exist with the declared settings and reports replications
+// that are not healthy. Couchbase never reports the password of a remote
+// cluster, a fingerprint of the one last saved is replicated instead.
+func (node *RaftNode) reconcileXDCR(ctx context.Context, result *ReconcileResult) error {
+	if len(node.config.RemoteClusters) == 0 && len(node.config.Replications) == 0 {
+		return nil
+	}
+
+	clusters, err := node.couchbaseNode.RemoteClusters(ctx)
+	if err != nil {
+		return err
+	}
+
+	remotes := make(map[string]couchbase.RemoteClusterInfo)
+	for _, cluster := range clusters {
+		remotes[cluster.Name] = cluster
+	}
+
+	for _, declared := range node.config.RemoteClusters {
+		key := remotePasswordKey(declared.Name)
+		password := fingerprint(node.config.Password, declared.Name, declared.Username, declared.Password)
+		saved, _ := node.fsm.Setting(key)
+
+		current, exists := remotes[declared.Name]
+		if exists && sameHost(current.Hostname, declared.Hostname) && current.Username == declared.Username && saved == password {
+			continue
+		}
+
+		err = node.couchbaseNode.SaveRemoteCluster(ctx, declared, exists)
+		if err != nil {
+			result.Errors = append(result.Errors, err.Error())
+			continue
+		}
+
+		err = node.store.Apply(SetSettingCommand, Setting{Key: key, Value: password})
+		if err != nil {
+			return err
+		}
+		result.Changes = append(result.Changes, fmt.Sprintf("saved remote cluster %s", declared.Name))
+	}
+
+	// Replications reference remote clusters by uuid, reload them so new
+	// references are known.
+	clusters, err = node.couchbaseNode.RemoteClusters(ctx)
+	if err != nil {
+		return err
+	}
+
+	uuids := make(map[string]string)
+	for _, cluster := range clusters {
+		uuids[cluster.Name] = cluster.UUID
+	}
+
+	replications, err := node.couchbaseNode.Replications(ctx)
+	if err != nil {
+		return err
+	}
+
+	running := make(map[string]couchbase.ReplicationInfo)
+	for _, replication := range replications {
+		running[replication.RemoteUUID+"/"+replication.Bucket+"/"+replication.RemoteBucket] = replication
+	}
+
+	for _, declared := range node.config.Replications {
+		uuid, ok := uuids[declared.RemoteCluster]
+		if !ok {
+			result.Errors = append(result.Errors, fmt.Sprintf("replication of %s targets unknown remote cluster %s", declared.Bucket, declared.RemoteCluster))
+			continue
+		}
+
+		id := uuid + "/" + declared.Bucket + "/" + declared.RemoteBucket
+		replication, ok := running[id]
+		if !ok {
+			err = node.couchbaseNode.CreateReplication(ctx, declared)
+			if err != nil {
+				result.Errors = append(result.Errors, err.Error())
+				continue
+			}
+			result.Changes = append(result.Changes, fmt.Sprintf("replicating %s to %s/%s", declared.Bucket, declared.RemoteCluster, declared.RemoteBucket))
+			continue
+		}
+
+		settings, err := node.couchbaseNode.ReplicationSettings(ctx, replication.ID)
+		if err != nil {
+			result.Errors = append(result.Errors, err.Error())
+		} else if settings.Drifted(declared) {
+			err = node.couchbaseNode.UpdateReplication(ctx, replication.ID, declared)
+			if err != nil {
+				result.Errors = append(result.Errors, err.Error())
+			} else {
+				result.Changes = append(result.Changes, fmt.Sprintf("updated replication %s", id))
+			}
+		}
+
+		if replication.Status != "running" {
+			result.Warnings = append(result.Warnings, fmt.Sprintf("replication %s is %s", id, replication.Status))
+		}
+		if len(replication.Errors) > 0 {
+			result.Warnings = append(result.Warnings, fmt.Sprintf("replication %s reports: %s", id, strings.Join(replication.Errors, "; ")))
+		}
+	}
+
+	return nil
+}
+
+func remotePasswordKey(name string) string {
+	return "xdcr.remoteClusters." + name + ".password"
+}
+
+// sameHost compares hostnames with and without the default REST port.
+func sameHost(current string, declared string) bool {
+	trim := func(host string) string {
+		return strings.TrimSuffix(host, fmt.Sprintf(":%d", couchbase.DefaultPort))
+	}
+	return trim(current) == trim(declared)
+}
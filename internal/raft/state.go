@@ -0,0 +1,152 @@
+package raft
+
+import (
+	"time"
+
+	"github.com/devgenie/scout/internal/backup"
+	"github.com/devgenie/scout/internal/monitor"
+)
+
+const (
+	NodeActive = "active"
+	NodeLeft   = "left"
+	NodeFailed = "failed"
+)
+
+const (
+	OperationPending   = "pending"
+	OperationRunning   = "running"
+	OperationCompleted = "completed"
+	OperationFailed    = "failed"
+	OperationStalled   = "stalled"
+)
+
+// ClusterState is the desired model of the couchbase cluster, it is
+// replicated to every scout node through the raft log.
+type ClusterState struct {
+	Nodes      map[string]NodeState
+	Buckets    map[string]BucketState
+	Settings   map[string]string
+	Operations map[string]Operation
+	Users      map[string]UserState
+	Backups    map[string]backup.Run
+	Alerts     map[string]monitor.Alert
+}
+
+type NodeState struct {
+	Name     string
+	Address  string
+	Services []string
+	Zone     string
+	MemoryMB int
+	Status   string
+	Updated  time.Time
+}
+
+type BucketState struct {
+	Name            string
+	BucketType      string
+	RAMQuotaMB      int
+	ReplicaNumber   int
+	ReplicaIndex    bool
+	EvictionPolicy  string
+	FlushEnabled    bool
+	ThreadsNumber   int
+	CompressionMode string
+}
+
+// UserState records a couchbase user managed by scout. Only a keyed hash of
+// the password is replicated, it tells the leader when the password changed.
+type UserState struct {
+	Name         string
+	FullName     string
+	Roles        []string
+	PasswordHash string
+}
+
+// Operation tracks long running cluster work such as a rebalance so that a
+// new leader knows what its predecessor was doing.
+type Operation struct {
+	ID       string    `json:"id"`
+	Type     string    `json:"type"`
+	Status   string    `json:"status"`
+	Nodes    []string  `json:"nodes"`
+	Progress float64   `json:"progress"`
+	Message  string    `json:"message,omitempty"`
+	Created  time.Time `json:"created"`
+	Updated  time.Time `json:"updated"`
+}
+
+func newClusterState() *ClusterState {
+	return &ClusterState{
+		Nodes:      make(map[string]NodeState),
+		Buckets:    make(map[string]BucketState),
+		Settings:   make(map[string]string),
+		Operations: make(map[string]Operation),
+		Users:      make(map[string]UserState),
+		Backups:    make(map[string]backup.Run),
+		Alerts:     make(map[string]monitor.Alert),
+	}
+}
+
+func (state *ClusterState) clone() ClusterState {
+	copied := newClusterState()
+
+	for name, node := range state.Nodes {
+		node.Services = append([]string(nil), node.Services...)
+		copied.Nodes[name] = node
+	}
+
+	for name, bucket := range state.Buckets {
+		copied.Buckets[name] = bucket
+	}
+
+	for key, value := range state.Settings {
+		copied.Settings[key] = value
+	}
+
+	for id, operation := range state.Operations {
+		operation.Nodes = append([]string(nil), operation.Nodes...)
+		copied.Operations[id] = operation
+	}
+
+	for name, user := range state.Users {
+		user.Roles = append([]string(nil), user.Roles...)
+		copied.Users[name] = user
+	}
+
+	for id, run := range state.Backups {
+		copied.Backups[id] = run
+	}
+
+	for id, alert := range state.Alerts {
+		copied.Alerts[id] = alert
+	}
+
+	return *copied
+}
+
+// normalize replaces maps that gob leaves nil when they were encoded empty.
+func (state *ClusterState) normalize() {
+	if state.Nodes == nil {
+		state.Nodes = make(map[string]NodeState)
+	}
+	if state.Buckets == nil {
+		state.Buckets = make(map[string]BucketState)
+	}
+	if state.Settings == nil {
+		state.Settings = make(map[string]string)
+	}
+	if state.Operations == nil {
+		state.Operations = make(map[string]Operation)
+	}
+	if state.Users == nil {
+		state.Users = make(map[string]UserState)
+	}
+	if state.Backups == nil {
+		state.Backups = make(map[string]backup.Run)
+	}
+	if state.Alerts == nil {
+		state.Alerts = make(map[string]monitor.Alert)
+	}
+}
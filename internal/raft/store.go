@@ -5,6 +5,7 @@ import (
 	"os"
 	"time"
 
+	"github.com/devgenie/scout/internal/couchbase"
 	"github.com/hashicorp/raft"
 	raftboltdb "github.com/hashicorp/raft-boltdb"
 )
@@ -18,6 +19,7 @@ type RaftStore struct {
 	transport       *raft.NetworkTransport
 	config          *raft.Config
 	localMembership raft.Configuration
+	fsm             *FSM
 }
 
 func (store *RaftStore) Init() error {
@@ -49,7 +51,7 @@ func (store *RaftStore) Init() error {
 	store.config.LogOutput = os.Stdout
 	store.config.LocalID = raft.ServerID(store.raftAddr)
 
-	rafter, err := raft.NewRaft(store.config, &FSM{}, store.raftDB, store.raftDB, store.snapshotStore, store.transport)
+	rafter, err := raft.NewRaft(store.config, store.fsm, store.raftDB, store.raftDB, store.snapshotStore, store.transport)
 
 	if err != nil {
 		log.Fatal(err)
@@ -96,12 +98,15 @@ func (store *RaftStore) Reset() error {
 	}
 	store.transport = transport
 
-	err = raft.RecoverCluster(store.config, &FSM{}, store.raftDB, store.raftDB, store.snapshotStore, store.transport, store.localMembership)
+	err = raft.RecoverCluster(store.config, NewFSM(), store.raftDB, store.raftDB, store.snapshotStore, store.transport, store.localMembership)
 	if err != nil {
 		return err
 	}
 
-	newRaft, err := raft.NewRaft(store.config, &FSM{}, store.raftDB, store.raftDB, store.snapshotStore, store.transport)
+	// The new raft instance replays the snapshot and log into the FSM, start
+	// from an empty state so commands are not applied twice.
+	store.fsm.reset()
+	newRaft, err := raft.NewRaft(store.config, store.fsm, store.raftDB, store.raftDB, store.snapshotStore, store.transport)
 	if err != nil {
 		log.Fatal(err)
 		return err
@@ -110,3 +115,27 @@ func (store *RaftStore) Reset() error {
 
 	return nil
 }
+
+// Apply replicates a command through the raft log, it must be called on the
+// leader.
+func (store *RaftStore) Apply(cmdType CommandType, payload interface{}) error {
+	command, err := NewCommand(cmdType, payload)
+	if err != nil {
+		return err
+	}
+
+	data, err := couchbase.Encode(command)
+	if err != nil {
+		return err
+	}
+
+	applyFuture := store.raft.Apply(data, 10*time.Second)
+	if err := applyFuture.Error(); err != nil {
+		return err
+	}
+
+	if err, ok := applyFuture.Response().(error); ok {
+		return err
+	}
+	return nil
+}
@@ -56,5 +56,5 @@ overridePort "ssl_proxy_upstream_port"
     exec /usr/sbin/runsvdir-start
 }
 
-exec /root/.gvm/pkgsets/go1.12.5/global/src/scout/scout
+exec /root/.gvm/pkgsets/go1.12.5/global/src/scout/scout agent
 exec "$@"
\ No newline at end of file